@@ -0,0 +1,468 @@
+// Package bridgetest provides an in-process fake of the bridge for tests: a TLS
+// MQTT 3.1.1 broker plus a fake token check endpoint of the identity provider.
+//
+// A typical test starts a server, points the connector at it and connects:
+//
+//	srv, err := bridgetest.NewServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Close()
+//	connector.SetValidateTokenUrl(srv.TokenURL())
+//
+//	c := connector.GetInstance()
+//	res, err := c.ConnectHost(srv.ConnectRequest("testuser"))
+//
+// Payloads are then pushed to the client with PublishMarketFeed and PublishUpdate.
+package bridgetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pack "github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// Server is a fake bridge. Its zero value is not usable; create one with NewServer.
+type Server struct {
+	listener net.Listener
+	token    *httptest.Server
+
+	mu            sync.Mutex
+	sessions      map[*session]struct{}
+	failTopics    map[string]bool
+	connackCode   byte
+	tokenMessage  string
+	delay         time.Duration
+	subscribes    []int
+	unsubscribes  []int
+	connects      int
+	lastUsername  string
+	lastClientId  string
+	lastPassword  string
+	wg            sync.WaitGroup
+	closed        bool
+	closeOnce     sync.Once
+	acceptStopped chan struct{}
+}
+
+type session struct {
+	conn   net.Conn
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+// NewServer starts a broker on a random local port with a self-signed certificate
+// and a token check endpoint that accepts every token.
+func NewServer() (*Server, error) {
+	certificate, err := selfSignedCertificate()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:      listener,
+		sessions:      map[*session]struct{}{},
+		failTopics:    map[string]bool{},
+		acceptStopped: make(chan struct{}),
+	}
+	s.token = httptest.NewServer(http.HandlerFunc(s.checkToken))
+	go s.accept()
+	return s, nil
+}
+
+// Close stops the broker and the token endpoint and drops every connection.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		s.listener.Close()
+		<-s.acceptStopped
+		s.DropConnections()
+		s.wg.Wait()
+		s.token.Close()
+	})
+}
+
+// Host returns the host the broker listens on.
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the broker listens on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// TokenURL returns the URL of the fake token check endpoint.
+func (s *Server) TokenURL() string {
+	return s.token.URL + "/v1/access/check/token"
+}
+
+// Token returns an unsigned JWT whose "preferred_username" claim is the user name.
+func Token(userName string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"preferred_username": userName,
+		"exp":                time.Now().Add(24 * time.Hour).Unix(),
+	})
+	return header + "." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbmF0dXJl"
+}
+
+// ConnectRequest returns the JSON connect request for ConnectHost that points at the
+// broker, authenticating as the user name.
+func (s *Server) ConnectRequest(userName string) string {
+	request, _ := json.Marshal(map[string]interface{}{
+		"host":     s.Host(),
+		"port":     s.Port(),
+		"password": Token(userName),
+	})
+	return string(request)
+}
+
+// PublishMarketFeed publishes a payload on a market feed, e.g.
+// PublishMarketFeed("mw", "nseeq/2885", payload) publishes on
+// "prod/marketfeed/mw/v1/nseeq/2885". It returns the number of clients it was delivered to.
+func (s *Server) PublishMarketFeed(feed string, topic string, payload []byte) int {
+	return s.Publish("prod/marketfeed/"+feed+"/v1/"+topic, payload)
+}
+
+// PublishUpdate publishes a payload on an update feed, e.g.
+// PublishUpdate("order", "CLIENT1", payload) publishes on "prod/updates/order/v1/CLIENT1".
+// It returns the number of clients it was delivered to.
+func (s *Server) PublishUpdate(feed string, topic string, payload []byte) int {
+	return s.Publish("prod/updates/"+feed+"/v1/"+topic, payload)
+}
+
+// Publish publishes a payload with QoS 0 to every client subscribed to the full MQTT
+// topic. It returns the number of clients it was delivered to.
+func (s *Server) Publish(topic string, payload []byte) int {
+	delivered := 0
+	for _, sess := range s.sessionList() {
+		sess.mu.Lock()
+		subscribed := false
+		for filter := range sess.topics {
+			if matches(filter, topic) {
+				subscribed = true
+				break
+			}
+		}
+		if subscribed {
+			packet := pack.NewControlPacket(pack.Publish).(*pack.PublishPacket)
+			packet.TopicName = topic
+			packet.Payload = payload
+			if packet.Write(sess.conn) == nil {
+				delivered++
+			}
+		}
+		sess.mu.Unlock()
+	}
+	return delivered
+}
+
+// FailSubscription makes the broker answer SUBSCRIBE requests for the full MQTT topics
+// with the failure return code 0x80.
+func (s *Server) FailSubscription(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range topics {
+		s.failTopics[topic] = true
+	}
+}
+
+// SetConnackCode sets the return code of the CONNACK sent to new connections.
+// The default 0 accepts the connection.
+func (s *Server) SetConnackCode(code byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connackCode = code
+}
+
+// RejectTokens makes the token check endpoint reject every token with the message.
+// An empty message accepts tokens again.
+func (s *Server) RejectTokens(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenMessage = message
+}
+
+// SetDelay delays every CONNACK, SUBACK, UNSUBACK and token check response.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = delay
+}
+
+// DropConnections closes every client connection without a DISCONNECT.
+func (s *Server) DropConnections() {
+	for _, sess := range s.sessionList() {
+		sess.conn.Close()
+	}
+}
+
+// Subscriptions returns the full MQTT topics subscribed by connected clients, sorted.
+func (s *Server) Subscriptions() []string {
+	var topics []string
+	for _, sess := range s.sessionList() {
+		sess.mu.Lock()
+		for topic := range sess.topics {
+			topics = append(topics, topic)
+		}
+		sess.mu.Unlock()
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// SubscribePackets returns the number of topics in each SUBSCRIBE packet received, in order.
+func (s *Server) SubscribePackets() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.subscribes...)
+}
+
+// UnsubscribePackets returns the number of topics in each UNSUBSCRIBE packet received, in order.
+func (s *Server) UnsubscribePackets() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.unsubscribes...)
+}
+
+// Connects returns the number of CONNECT packets received since the server started.
+func (s *Server) Connects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connects
+}
+
+// Connections returns the number of clients currently connected.
+func (s *Server) Connections() int {
+	return len(s.sessionList())
+}
+
+// LastConnect returns the client id, user name and password of the last CONNECT received.
+func (s *Server) LastConnect() (clientId string, userName string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastClientId, s.lastUsername, s.lastPassword
+}
+
+func (s *Server) sessionList() []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		list = append(list, sess)
+	}
+	return list
+}
+
+func (s *Server) responseDelay() {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func (s *Server) accept() {
+	defer close(s.acceptStopped)
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	packet, err := pack.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+	connect, ok := packet.(*pack.ConnectPacket)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.connects++
+	s.lastClientId = connect.ClientIdentifier
+	s.lastUsername = connect.Username
+	s.lastPassword = string(connect.Password)
+	code := s.connackCode
+	s.mu.Unlock()
+
+	s.responseDelay()
+	connack := pack.NewControlPacket(pack.Connack).(*pack.ConnackPacket)
+	connack.ReturnCode = code
+	if connack.Write(conn) != nil || code != pack.Accepted {
+		return
+	}
+
+	sess := &session{conn: conn, topics: map[string]bool{}}
+	s.mu.Lock()
+	s.sessions[sess] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+	}()
+
+	for {
+		packet, err := pack.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *pack.SubscribePacket:
+			s.mu.Lock()
+			s.subscribes = append(s.subscribes, len(p.Topics))
+			codes := make([]byte, len(p.Topics))
+			for n, topic := range p.Topics {
+				if s.failTopics[topic] {
+					codes[n] = 0x80
+				}
+			}
+			s.mu.Unlock()
+
+			s.responseDelay()
+			suback := pack.NewControlPacket(pack.Suback).(*pack.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = codes
+			sess.mu.Lock()
+			for n, topic := range p.Topics {
+				if codes[n] != 0x80 {
+					sess.topics[topic] = true
+				}
+			}
+			err = suback.Write(conn)
+			sess.mu.Unlock()
+
+		case *pack.UnsubscribePacket:
+			s.mu.Lock()
+			s.unsubscribes = append(s.unsubscribes, len(p.Topics))
+			s.mu.Unlock()
+
+			s.responseDelay()
+			unsuback := pack.NewControlPacket(pack.Unsuback).(*pack.UnsubackPacket)
+			unsuback.MessageID = p.MessageID
+			sess.mu.Lock()
+			for _, topic := range p.Topics {
+				delete(sess.topics, topic)
+			}
+			err = unsuback.Write(conn)
+			sess.mu.Unlock()
+
+		case *pack.PingreqPacket:
+			sess.mu.Lock()
+			err = pack.NewControlPacket(pack.Pingresp).Write(conn)
+			sess.mu.Unlock()
+
+		case *pack.DisconnectPacket:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) checkToken(w http.ResponseWriter, r *http.Request) {
+	s.responseDelay()
+
+	var request struct {
+		UserId string `json:"userId"`
+		Token  string `json:"token"`
+	}
+	result := map[string]string{"status": "Success", "message": "Token is valid"}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		result = map[string]string{"status": "Failed", "message": "Invalid request"}
+	}
+
+	s.mu.Lock()
+	if s.tokenMessage != "" {
+		result = map[string]string{"status": "Failed", "message": s.tokenMessage}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+}
+
+// matches reports whether an MQTT topic filter, possibly containing "+" and "#"
+// wildcards, matches the topic.
+func matches(filter string, topic string) bool {
+	if filter == topic {
+		return true
+	}
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for n, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if n >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[n] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bridgetest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,207 @@
+package bridgetest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// connect connects a plain MQTT client to the server.
+func connect(t *testing.T, srv *Server, lost chan<- error) (mqtt.Client, mqtt.Token) {
+	t.Helper()
+	opts := mqtt.NewClientOptions().
+		AddBroker("ssl://" + srv.Host() + ":" + strconv.Itoa(srv.Port())).
+		SetClientID("client1").
+		SetUsername("testuser").
+		SetPassword("secret").
+		SetTLSConfig(&tls.Config{InsecureSkipVerify: true}).
+		SetProtocolVersion(4).
+		SetAutoReconnect(false).
+		SetConnectRetry(false)
+	opts.OnConnectionLost = func(client mqtt.Client, err error) {
+		if lost != nil {
+			lost <- err
+		}
+	}
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(5 * time.Second) {
+		t.Fatal("CONNECT timed out")
+	}
+	t.Cleanup(func() {
+		if client.IsConnected() {
+			client.Disconnect(0)
+		}
+	})
+	return client, token
+}
+
+func TestConnect(t *testing.T) {
+	srv := newServer(t)
+	client, token := connect(t, srv, nil)
+	if token.Error() != nil || !client.IsConnected() {
+		t.Fatalf("CONNECT failed: %v", token.Error())
+	}
+	if srv.Connects() != 1 || srv.Connections() != 1 {
+		t.Errorf("%d connects and %d connections, want 1 and 1", srv.Connects(), srv.Connections())
+	}
+	if id, user, password := srv.LastConnect(); id != "client1" || user != "testuser" || password != "secret" {
+		t.Errorf("last CONNECT %q %q %q", id, user, password)
+	}
+
+	srv.SetConnackCode(5)
+	_, token = connect(t, srv, nil)
+	if token.Error() == nil || token.(*mqtt.ConnectToken).ReturnCode() != 5 {
+		t.Errorf("CONNECT returned %v, want return code 5", token.Error())
+	}
+}
+
+func TestTokenCheck(t *testing.T) {
+	srv := newServer(t)
+	check := func(token string) (string, string) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"userId": "testuser", "token": token})
+		response, err := http.Post(srv.TokenURL(), "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var result struct {
+			Result struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Result.Status, result.Result.Message
+	}
+
+	tests := []struct {
+		name    string
+		reject  string
+		token   string
+		status  string
+		message string
+	}{
+		{"valid", "", Token("testuser"), "Success", "Token is valid"},
+		{"empty", "", "", "Failed", "Invalid request"},
+		{"rejected", "Token expired", Token("testuser"), "Failed", "Token expired"},
+	}
+	for _, test := range tests {
+		srv.RejectTokens(test.reject)
+		if status, message := check(test.token); status != test.status || message != test.message {
+			t.Errorf("%s: %s %q, want %s %q", test.name, status, message, test.status, test.message)
+		}
+	}
+}
+
+func TestFailSubscription(t *testing.T) {
+	srv := newServer(t)
+	client, _ := connect(t, srv, nil)
+	srv.FailSubscription("prod/marketfeed/mw/v1/nseeq/2")
+
+	token := client.SubscribeMultiple(map[string]byte{
+		"prod/marketfeed/mw/v1/nseeq/1": 0,
+		"prod/marketfeed/mw/v1/nseeq/2": 0,
+	}, nil)
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("SUBSCRIBE failed: %v", token.Error())
+	}
+	want := map[string]byte{"prod/marketfeed/mw/v1/nseeq/1": 0, "prod/marketfeed/mw/v1/nseeq/2": 0x80}
+	if got := token.(*mqtt.SubscribeToken).Result(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SUBACK %v, want %v", got, want)
+	}
+	if got := srv.Subscriptions(); !reflect.DeepEqual(got, []string{"prod/marketfeed/mw/v1/nseeq/1"}) {
+		t.Errorf("subscriptions %v, want the accepted topic only", got)
+	}
+	if got := srv.SubscribePackets(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("SUBSCRIBE packets %v, want [2]", got)
+	}
+
+	token = client.Unsubscribe("prod/marketfeed/mw/v1/nseeq/1")
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("UNSUBSCRIBE failed: %v", token.Error())
+	}
+	if got := srv.UnsubscribePackets(); !reflect.DeepEqual(got, []int{1}) || len(srv.Subscriptions()) != 0 {
+		t.Errorf("UNSUBSCRIBE packets %v and subscriptions %v", got, srv.Subscriptions())
+	}
+}
+
+func TestPublish(t *testing.T) {
+	srv := newServer(t)
+	client, _ := connect(t, srv, nil)
+	received := make(chan string, 1)
+	token := client.Subscribe("prod/marketfeed/mw/v1/nseeq/+", 0, func(client mqtt.Client, msg mqtt.Message) {
+		received <- msg.Topic() + " " + string(msg.Payload())
+	})
+	token.WaitTimeout(5 * time.Second)
+
+	if n := srv.PublishMarketFeed("mw", "nseeq/2885", []byte("tick")); n != 1 {
+		t.Fatalf("delivered to %d clients, want 1", n)
+	}
+	if n := srv.PublishUpdate("order", "CLIENT1", []byte("order")); n != 0 {
+		t.Errorf("an unsubscribed topic was delivered to %d clients", n)
+	}
+	select {
+	case got := <-received:
+		if got != "prod/marketfeed/mw/v1/nseeq/2885 tick" {
+			t.Errorf("received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not delivered")
+	}
+}
+
+func TestDelay(t *testing.T) {
+	srv := newServer(t)
+	client, _ := connect(t, srv, nil)
+	srv.SetDelay(100 * time.Millisecond)
+
+	start := time.Now()
+	client.Subscribe("prod/marketfeed/mw/v1/nseeq/1", 0, nil).WaitTimeout(5 * time.Second)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("SUBACK after %v, want the delay applied", elapsed)
+	}
+}
+
+func TestDropConnections(t *testing.T) {
+	srv := newServer(t)
+	lost := make(chan error, 1)
+	client, _ := connect(t, srv, lost)
+
+	srv.DropConnections()
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client did not see the connection drop")
+	}
+	if client.IsConnected() {
+		t.Error("the client is still connected")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Connections() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := srv.Connections(); n != 0 {
+		t.Errorf("%d connections after dropping them", n)
+	}
+}
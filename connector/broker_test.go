@@ -0,0 +1,205 @@
+package connector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/bridgetest"
+)
+
+// connectTest starts a fake bridge and connects the connector instance to it. The
+// instance is a singleton, so the tests of this package do not run in parallel.
+func connectTest(t *testing.T, restore string) (*bridgetest.Server, *Connect, connectResponse) {
+	t.Helper()
+	srv, err := bridgetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := validateTokenUrl
+	SetValidateTokenUrl(srv.TokenURL())
+
+	c := GetInstance()
+	*c = Connect{}
+	t.Cleanup(func() {
+		if c.IsConnected() {
+			c.DisconnectHost()
+		}
+		*c = Connect{}
+		srv.Close()
+		SetValidateTokenUrl(url)
+	})
+
+	var request map[string]interface{}
+	json.Unmarshal([]byte(srv.ConnectRequest("testuser")), &request)
+	if restore != "" {
+		request["restoreSubscriptions"] = restore
+	}
+	data, _ := json.Marshal(request)
+	res, err := c.ConnectHost(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := decode[connectResponse](t, res)
+	if response.Status != 0 {
+		t.Fatalf("ConnectHost: %s", res)
+	}
+	return srv, c, response
+}
+
+func fullTopics(feed Feed, topics ...string) []string {
+	full := make([]string, len(topics))
+	for i, topic := range topics {
+		full[i] = string(feed) + topic
+	}
+	return full
+}
+
+func TestConnectHostRejectedToken(t *testing.T) {
+	srv, err := bridgetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	url := validateTokenUrl
+	SetValidateTokenUrl(srv.TokenURL())
+	defer SetValidateTokenUrl(url)
+	srv.RejectTokens("Token expired")
+
+	c := &Connect{}
+	res, err := c.ConnectHost(srv.ConnectRequest("testuser"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := decode[connectResponse](t, res); response.Status != 1 || response.Message != "Token expired" {
+		t.Errorf("ConnectHost: %s, want the token rejected", res)
+	}
+	if srv.Connects() != 0 {
+		t.Errorf("the broker received %d CONNECT packets", srv.Connects())
+	}
+}
+
+func TestBrokerSubscribe(t *testing.T) {
+	srv, c, _ := connectTest(t, "")
+	srv.FailSubscription(string(FeedMarketWatch) + "nseeq/2")
+
+	res, err := c.SubscribeFeed(listRequest("subscriptionList", topicList(1025)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := map[int16]int{}
+	for _, result := range decode[subscribeResponse](t, res).SubscriptionResult {
+		codes[result.ResultCode]++
+	}
+	if want := map[int16]int{0: 1024, 0x80: 1}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("result codes %v, want %v", codes, want)
+	}
+	if got := srv.SubscribePackets(); !reflect.DeepEqual(got, []int{1024, 1}) {
+		t.Errorf("SUBSCRIBE packets %v, want [1024 1]", got)
+	}
+	if got := len(srv.Subscriptions()); got != 1024 {
+		t.Errorf("broker has %d subscriptions, want 1024", got)
+	}
+
+	c.UnsubscribeFeed(listRequest("UnsubscriptionList", topicList(1025)...))
+	if got := srv.UnsubscribePackets(); !reflect.DeepEqual(got, []int{1024, 1}) {
+		t.Errorf("UNSUBSCRIBE packets %v, want [1024 1]", got)
+	}
+	if got := len(srv.Subscriptions()); got != 0 {
+		t.Errorf("broker has %d subscriptions after unsubscribing", got)
+	}
+}
+
+func TestRestoreOnConnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	data := `{"version": 1, "feeds": {"mw": ["nseeq/2885", "nsefo/35001"], "order": ["AB1234"]}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _, response := connectTest(t, path)
+	if response.Restore == nil || response.Restore.Status != 0 || len(response.Restore.Feeds) != 2 {
+		t.Fatalf("Restore %+v, want both feeds restored", response.Restore)
+	}
+	want := append(fullTopics(FeedMarketWatch, "nseeq/2885", "nsefo/35001"), fullTopics(FeedOrderUpdates, "AB1234")...)
+	if got := srv.Subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("broker has %v, want %v", got, want)
+	}
+}
+
+func TestRestoreOnConnectMissingFile(t *testing.T) {
+	_, _, response := connectTest(t, filepath.Join(t.TempDir(), "subscriptions.json"))
+	if response.Restore != nil {
+		t.Errorf("Restore %+v for a missing file, want none", response.Restore)
+	}
+}
+
+func TestDroppedConnection(t *testing.T) {
+	srv, c, _ := connectTest(t, "")
+	disconnected := make(chan error, 1)
+	c.OnDisconnect = func(err error) { disconnected <- err }
+
+	subscription, _, err := c.Acquire(FeedMarketWatch, "nseeq/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subscription.Active() {
+		t.Fatal("new subscription is not active")
+	}
+	srv.DropConnections()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnDisconnect was not called")
+	}
+	if c.IsConnected() {
+		t.Error("still connected after the connection dropped")
+	}
+	if got := c.subscriptions.count(); got != 0 {
+		t.Errorf("registry has %d topics after the session ended", got)
+	}
+	if subscription.Active() {
+		t.Error("subscription of the previous session is active")
+	}
+
+	res, err := c.ConnectHost(srv.ConnectRequest("testuser"))
+	if err != nil || decode[connectResponse](t, res).Status != 0 {
+		t.Fatalf("reconnecting: %s %v", res, err)
+	}
+	if _, err := subscription.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.UnsubscribePackets(); len(got) != 0 {
+		t.Errorf("a handle of the previous session sent UNSUBSCRIBE packets %v", got)
+	}
+	res, _ = c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1"))
+	if response := decode[subscribeResponse](t, res); response.Status != 0 {
+		t.Fatalf("subscribing after reconnecting: %s", res)
+	}
+}
+
+func TestHandlerReceivesPublishedPayload(t *testing.T) {
+	srv, c, _ := connectTest(t, "")
+	type message struct {
+		payload string
+		topic   string
+	}
+	received := make(chan message, 1)
+	c.MWHandler = func(payload []byte, topic string) { received <- message{string(payload), topic} }
+
+	c.SubscribeFeed(listRequest("subscriptionList", "nseeq/2885"))
+	if n := srv.PublishMarketFeed("mw", "nseeq/2885", []byte("tick")); n != 1 {
+		t.Fatalf("published to %d clients, want 1", n)
+	}
+	select {
+	case got := <-received:
+		if got != (message{"tick", "nseeq/2885"}) {
+			t.Errorf("received %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MWHandler was not called")
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
-	"regexp"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,8 +32,61 @@ const (
 	trade        = "prod/updates/trade/v1/"
 )
 
+// Feed identifies one of the data streams published by the bridge.
+type Feed string
+
+const (
+	FeedMarketWatch  Feed = mw
+	FeedIndex        Feed = index
+	FeedOpenInterest Feed = oi
+	FeedMarketStatus Feed = marketStatus
+	FeedLpp          Feed = lpp
+	FeedHigh52Week   Feed = high52Week
+	FeedLow52Week    Feed = low52Week
+	FeedUpperCircuit Feed = upperCircuit
+	FeedLowerCircuit Feed = lowerCircuit
+	FeedOrderUpdates Feed = order
+	FeedTradeUpdates Feed = trade
+)
+
+var feeds = []Feed{
+	FeedMarketWatch,
+	FeedIndex,
+	FeedOpenInterest,
+	FeedMarketStatus,
+	FeedLpp,
+	FeedHigh52Week,
+	FeedLow52Week,
+	FeedUpperCircuit,
+	FeedLowerCircuit,
+	FeedOrderUpdates,
+	FeedTradeUpdates,
+}
+
+// Name returns the short name of the feed, e.g. "mw" for FeedMarketWatch.
+func (f Feed) Name() string {
+	parts := strings.Split(strings.TrimSuffix(string(f), "/v1/"), "/")
+	return parts[len(parts)-1]
+}
+
+// FeedByName returns the feed with the given short name, e.g. "mw" or "uppercircuit".
+func FeedByName(name string) (Feed, bool) {
+	for _, feed := range feeds {
+		if feed.Name() == name {
+			return feed, true
+		}
+	}
+	return "", false
+}
+
 var validateTokenUrl = "https://idaas.iiflsecurities.com/v1/access/check/token"
 
+// SetValidateTokenUrl overrides the identity provider endpoint ConnectHost uses to
+// check the token, e.g. to point at the fake endpoint of the bridgetest package.
+func SetValidateTokenUrl(url string) {
+	validateTokenUrl = url
+}
+
 type Connect struct {
 	client              mqtt.Client
 	OnDisconnect        onDisconnectHnadler
@@ -47,6 +101,13 @@ type Connect struct {
 	LowerCircuitHandler messageHandler
 	OrderUpdatesHandler messageHandler
 	TradeUpdatesHandler messageHandler
+	RawHandler          messageHandler
+	Instruments         *InstrumentMaster
+
+	SubscriptionBatchDelay time.Duration
+	MaxSubscriptions       int
+
+	subscriptions registry
 }
 
 var instance *Connect
@@ -56,6 +117,12 @@ var once sync.Once
 type messageHandler func([]byte, string)
 type onDisconnectHnadler func(error)
 
+// subscribeResult is implemented by the SUBSCRIBE tokens of the client, e.g.
+// *mqtt.SubscribeToken, which report the SUBACK return code of each topic.
+type subscribeResult interface {
+	Result() map[string]byte
+}
+
 var subackReturnCodes = map[uint8]string{
 	0x00: "Success",
 	0x01: "Success",
@@ -84,7 +151,10 @@ var subackReturnCodes = map[uint8]string{
 //     The user must set this to process incoming Index data.
 //     Example:
 //     instance.IndexHandler = func(payload []byte, topic string) {
-//     fmt.Printf("Index Data: %s, Topic: %s\n", payload, topic)
+//     tick, err := connector.DecodeIndex(payload)
+//     if err == nil {
+//     fmt.Printf("Index: %s, Value: %.2f\n", topic, tick.Price(tick.Value))
+//     }
 //     }
 //
 //   - `OpenInterstHandler`: A callback function to handle Open Interest data messages.
@@ -149,6 +219,25 @@ var subackReturnCodes = map[uint8]string{
 //     instance.TradeUpdatesHandler = func(payload []byte, topic string) {
 //     fmt.Printf("Trade Updates Data: %s, Topic: %s\n", payload, topic)
 //     }
+//
+// Optional properties of the `connect` instance:
+//
+//   - `RawHandler`: A callback function that receives every message from the broker,
+//     with its full MQTT topic, before it is passed to the handler of its feed.
+//     Example:
+//     instance.RawHandler = func(payload []byte, topic string) {
+//     fmt.Printf("Raw Data: %x, Topic: %s\n", payload, topic)
+//     }
+//
+//   - `Instruments`: The instrument master used by SubscribeSymbols to resolve symbols.
+//     Example:
+//     instance.Instruments, err = connector.LoadInstrumentMaster("contracts.csv")
+//
+//   - `SubscriptionBatchDelay`: The pause between the SUBSCRIBE and UNSUBSCRIBE packets
+//     of a request that is split in batches of 1024 topics. Zero sends them back to back.
+//
+//   - `MaxSubscriptions`: The number of topics the server allows per session. Requests
+//     that would exceed it are rejected with status 108. Zero disables the check.
 func GetInstance() *Connect {
 	once.Do(func() {
 		instance = &Connect{}
@@ -169,6 +258,10 @@ func GetInstance() *Connect {
 //	    "password": "your_password"
 //	}
 //
+// The optional "restoreSubscriptions" parameter names a file written by
+// ExportSubscriptions. When it exists, its subscriptions are restored once connected
+// and the result is reported under "Restore", as returned by ImportSubscriptions.
+//
 // Sample response:
 //
 //	{
@@ -279,6 +372,12 @@ func (c *Connect) ConnectHost(connectReq string) (string, error) {
 	connectToken := token.(*mqtt.ConnectToken)
 	response.Message = pack.ConnackReturnCodes[uint8(connectToken.ReturnCode())]
 	response.Status = int16(connectToken.ReturnCode())
+	if request.RestoreSubscriptions != "" {
+		restored, err := c.importSubscriptions(request.RestoreSubscriptions)
+		if err == nil || !os.IsNotExist(err) {
+			response.Restore = &restored
+		}
+	}
 	jsonData, err := json.Marshal(response)
 	if err != nil {
 		return "", err
@@ -305,6 +404,11 @@ func (c *Connect) ConnectHost(connectReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -334,6 +438,11 @@ func (c *Connect) SubscribeFeed(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -363,6 +472,11 @@ func (c *Connect) SubscribeIndex(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -392,6 +506,11 @@ func (c *Connect) SubscribeOpenInterest(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -421,6 +540,11 @@ func (c *Connect) SubscribeMarketStatus(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -450,6 +574,11 @@ func (c *Connect) SubscribeLpp(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -479,6 +608,11 @@ func (c *Connect) SubscribeHigh52Week(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -508,6 +642,11 @@ func (c *Connect) SubscribeLow52Week(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -537,6 +676,11 @@ func (c *Connect) SubscribeUpperCircuit(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -566,6 +710,11 @@ func (c *Connect) SubscribeLowerCircuit(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -595,6 +744,11 @@ func (c *Connect) SubscribeOrderUpdates(subscribeReq string) (string, error) {
 //	    "Status": 0,
 //	    "SubscriptionResult": [
 //	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
 //	            "ResultCode": 0,
 //	            "Result": "Subscribed successfully",
 //	            "Topic": "nseeq/2885"
@@ -605,7 +759,7 @@ func (c *Connect) SubscribeTradeUpdates(subscribeReq string) (string, error) {
 	return c.subscribe(subscribeReq, trade)
 }
 
-func (c *Connect) subscribe(subscribeReq string, feedType string) (string, error) {
+func (c *Connect) subscribe(subscribeReq string, feedType Feed) (string, error) {
 
 	var response subscribeResponse
 	if c.client == nil || c.client.IsConnected() == false {
@@ -633,8 +787,8 @@ func (c *Connect) subscribe(subscribeReq string, feedType string) (string, error
 
 	err := json.Unmarshal([]byte(subscribeReq), &request)
 
-	if request.SubscriptionList == nil || len(request.SubscriptionList) > 1024 {
-		response.Message = "TopicList cannot be nil and no. of topics should be less than 1024"
+	if request.SubscriptionList == nil {
+		response.Message = "TopicList cannot be nil"
 		response.Status = 102
 		response.SubscriptionResult = nil
 		jsonData, err := json.Marshal(response)
@@ -644,38 +798,145 @@ func (c *Connect) subscribe(subscribeReq string, feedType string) (string, error
 		return string(jsonData), nil
 	}
 
-	filter := map[string]byte{}
-	for _, value := range request.SubscriptionList {
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+	response, err = c.subscribeTopics(request.SubscriptionList, feedType, false, response)
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	return string(jsonData), err
+}
 
-		match, err := regexp.MatchString(`^[A-Za-z0-9\/]+$`, value)
+// subscribeTopics sends SUBSCRIBE packets for the valid topics of the list, split in
+// batches of at most 1024 topics, and records the per-topic results on the response.
+//
+// held reports whether the topics are taken for a Subscription handle rather than
+// through the Subscribe methods. The caller must hold the registry changes lock.
+func (c *Connect) subscribeTopics(topics []string, feedType Feed, held bool, response subscribeResponse) (subscribeResponse, error) {
+	var valid []string
+	seen := map[string]bool{}
+	for _, value := range topics {
+		topic, err := ParseTopic(feedType, value)
 		if err != nil {
-			return "", err
+			response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: 104, Result: "Invalid Topic: " + err.Error(), Topic: value})
+			continue
 		}
-		if match {
-			filter[feedType+value] = 0
-		} else {
-			response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: 104, Result: "Invalid Topic", Topic: value})
+		if !seen[topic.String()] {
+			seen[topic.String()] = true
+			valid = append(valid, topic.String())
 		}
 	}
-	if len(filter) != 0 {
+	if len(valid) == 0 {
+		response.Message = "Subscription Failed"
+		response.Status = 103
+		return response, nil
+	}
+
+	if c.MaxSubscriptions > 0 {
+		added := 0
+		for _, topic := range valid {
+			if !c.subscriptions.has(feedType, topic) {
+				added++
+			}
+		}
+		if active := c.subscriptions.count(); active+added > c.MaxSubscriptions {
+			response.Message = fmt.Sprintf("Subscription limit exceeded: %d topics active, %d requested, limit is %d", active, added, c.MaxSubscriptions)
+			response.Status = 108
+			return response, nil
+		}
+	}
+
+	for n, batch := range batches(valid) {
+		if n > 0 && c.SubscriptionBatchDelay > 0 {
+			time.Sleep(c.SubscriptionBatchDelay)
+		}
+		filter := make(map[string]byte, len(batch))
+		for _, topic := range batch {
+			filter[string(feedType)+topic] = 0
+		}
 		token := c.client.SubscribeMultiple(filter, messagehandler)
 		if token.Wait() && token.Error() != nil {
+			for _, topic := range valid[n*maxTopicsPerPacket:] {
+				response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: -1, Result: token.Error().Error(), Topic: topic})
+			}
 			response.Status = -1
 			response.Message = token.Error().Error()
-			jsonData, err := json.Marshal(response)
-			if err != nil {
-				return "", nil
+			return response, token.Error()
+		}
+		result := token.(subscribeResult).Result()
+		var subscribed []string
+		for _, topic := range batch {
+			value := result[string(feedType)+topic]
+			if value < 0x80 {
+				subscribed = append(subscribed, topic)
 			}
-			return string(jsonData), token.Error()
+			response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: int16(value), Result: subackReturnCodes[uint8(value)], Topic: topic})
+		}
+		c.subscriptions.add(feedType, held, subscribed...)
+	}
+
+	response.Message = "Success"
+	response.Status = 0
+	return response, nil
+}
+
+// SubscribeSymbols subscribes the feed to instruments given by symbol instead of topic.
+// Symbols are resolved against the `Instruments` master, which must be loaded first
+// with LoadInstrumentMaster. Accepted forms are "EXCHANGE:TRADINGSYMBOL",
+// "EXCHANGE:ISIN" and plain topics such as "nseeq/2885".
+// Parameters:
+// - feed: The feed to subscribe, e.g. FeedMarketWatch
+// - symbols: The symbols to resolve and subscribe
+// Returns:
+// - A JSON string containing the subscription response. Symbols that cannot be
+// resolved are reported with result code 107.
+//
+// Sample response:
+//
+//	{
+//	    "Message": "Success",
+//	    "Status": 0,
+//	    "SubscriptionResult": [
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885",
+//	            "Symbol": "NSE:RELIANCE"
+//	        },
+//	        {
+//	            "ResultCode": 107,
+//	            "Result": "NFO:NIFTY24OCTFUTX: instrument not found",
+//	            "Topic": "",
+//	            "Symbol": "NFO:NIFTY24OCTFUTX"
+//	        }
+//	    ]
+//	}
+func (c *Connect) SubscribeSymbols(feed Feed, symbols ...string) (string, error) {
+	var response subscribeResponse
+	if c.client == nil || c.client.IsConnected() == false {
+		response.Message = "Client not connected"
+		response.Status = 106
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return "", err
 		}
-		subscribeToken := token.(*mqtt.SubscribeToken)
-		re := regexp.MustCompile("(v1/)")
-		for key, value := range subscribeToken.Result() {
-			response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: int16(value), Result: subackReturnCodes[uint8(value)], Topic: re.Split(key, -1)[1]})
+		return string(jsonData), nil
+	}
+
+	if c.Instruments == nil {
+		response.Message = "Instrument master is not loaded"
+		response.Status = 101
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return "", err
 		}
+		return string(jsonData), nil
+	}
 
-		response.Message = "Success"
-		response.Status = 0
+	if len(symbols) == 0 {
+		response.Message = "Symbol list should not be empty"
+		response.Status = 102
 		jsonData, err := json.Marshal(response)
 		if err != nil {
 			return "", err
@@ -683,13 +944,55 @@ func (c *Connect) subscribe(subscribeReq string, feedType string) (string, error
 		return string(jsonData), nil
 	}
 
-	response.Message = "Subscription Failed"
-	response.Status = 103
-	jsonData, err := json.Marshal(response)
-	if err != nil {
-		return "", err
+	var topics []string
+	resolved := make([]string, len(symbols))
+	failures := make([]error, len(symbols))
+	requested := map[string]bool{}
+	for n, symbol := range symbols {
+		instrument, err := c.Instruments.Lookup(symbol)
+		if err != nil {
+			failures[n] = err
+			continue
+		}
+		resolved[n] = instrument.Topic()
+		if !requested[resolved[n]] {
+			requested[resolved[n]] = true
+			topics = append(topics, resolved[n])
+		}
 	}
-	return string(jsonData), nil
+
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+	response, err := c.subscribeTopics(topics, feed, false, response)
+	response.SubscriptionResult = symbolResults(symbols, resolved, failures, response)
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	return string(jsonData), err
+}
+
+// symbolResults returns one result per requested symbol, in request order, so that
+// symbols resolving to the same topic each get the result of that topic.
+func symbolResults(symbols []string, resolved []string, failures []error, response subscribeResponse) []subscriptionResult {
+	byTopic := make(map[string]subscriptionResult, len(response.SubscriptionResult))
+	for _, result := range response.SubscriptionResult {
+		byTopic[result.Topic] = result
+	}
+	results := make([]subscriptionResult, 0, len(symbols))
+	for n, symbol := range symbols {
+		if failures[n] != nil {
+			results = append(results, subscriptionResult{ResultCode: 107, Result: failures[n].Error(), Symbol: symbol})
+			continue
+		}
+		result, ok := byTopic[resolved[n]]
+		if !ok {
+			result = subscriptionResult{ResultCode: -1, Result: response.Message, Topic: resolved[n]}
+		}
+		result.Symbol = symbol
+		results = append(results, result)
+	}
+	return results
 }
 
 // UnsubscribeFeed unsubscribes from the MarketWatch data
@@ -708,7 +1011,19 @@ func (c *Connect) subscribe(subscribeReq string, feedType string) (string, error
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeFeed(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, mw)
@@ -730,7 +1045,19 @@ func (c *Connect) UnsubscribeFeed(unsubscribeReq string) (string, error) {
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeIndex(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, index)
@@ -752,7 +1079,19 @@ func (c *Connect) UnsubscribeIndex(unsubscribeReq string) (string, error) {
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeOpenInterest(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, oi)
@@ -774,7 +1113,19 @@ func (c *Connect) UnsubscribeOpenInterest(unsubscribeReq string) (string, error)
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeMarketStatus(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, marketStatus)
@@ -796,7 +1147,19 @@ func (c *Connect) UnsubscribeMarketStatus(unsubscribeReq string) (string, error)
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeLpp(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, lpp)
@@ -818,7 +1181,19 @@ func (c *Connect) UnsubscribeLpp(unsubscribeReq string) (string, error) {
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeHigh52Week(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, high52Week)
@@ -840,7 +1215,19 @@ func (c *Connect) UnsubscribeHigh52Week(unsubscribeReq string) (string, error) {
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeLow52Week(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, low52Week)
@@ -862,7 +1249,19 @@ func (c *Connect) UnsubscribeLow52Week(unsubscribeReq string) (string, error) {
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeUpperCircuit(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, upperCircuit)
@@ -884,7 +1283,19 @@ func (c *Connect) UnsubscribeUpperCircuit(unsubscribeReq string) (string, error)
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeLowerCircuit(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, lowerCircuit)
@@ -906,7 +1317,19 @@ func (c *Connect) UnsubscribeLowerCircuit(unsubscribeReq string) (string, error)
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeOrderUpdates(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, order)
@@ -928,13 +1351,25 @@ func (c *Connect) UnsubscribeOrderUpdates(unsubscribeReq string) (string, error)
 //
 //	{
 //	    "Message": "Unsubscribed Successfully",
-//	    "Status": 0
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        },
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
 //	}
 func (c *Connect) UnsubscribeTradeUpdates(unsubscribeReq string) (string, error) {
 	return c.unsubscribe(unsubscribeReq, trade)
 }
 
-func (c *Connect) unsubscribe(unsubscribeReq string, feedType string) (string, error) {
+func (c *Connect) unsubscribe(unsubscribeReq string, feedType Feed) (string, error) {
 
 	var response unsubscribeResponse
 	if c.client == nil || c.client.IsConnected() == false {
@@ -951,10 +1386,9 @@ func (c *Connect) unsubscribe(unsubscribeReq string, feedType string) (string, e
 
 	err := json.Unmarshal([]byte(unsubscribeReq), &request)
 
-	if request.UnSubscriptionList == nil || len(request.UnSubscriptionList) > 1024 {
-		response.Message = "TopicList cannot be nil and no. of topics should be less than 1024"
+	if request.UnSubscriptionList == nil {
+		response.Message = "TopicList cannot be nil"
 		response.Status = 102
-		// response.UnSubscriptionResult = nil
 		jsonData, err := json.Marshal(response)
 		if err != nil {
 			return "", err
@@ -962,46 +1396,94 @@ func (c *Connect) unsubscribe(unsubscribeReq string, feedType string) (string, e
 		return string(jsonData), nil
 	}
 
-	var filter []string
-	for _, value := range request.UnSubscriptionList {
-		match, err := regexp.MatchString(`^[A-Za-z0-9\/]+$`, value)
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+	response, err = c.unsubscribeTopics(request.UnSubscriptionList, feedType, response)
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	return string(jsonData), err
+}
+
+// unsubscribeTopics sends UNSUBSCRIBE packets for the valid topics of the list that are
+// not held by a Subscription handle, and records the per-topic results on the response.
+// The caller must hold the registry changes lock.
+func (c *Connect) unsubscribeTopics(topics []string, feedType Feed, response unsubscribeResponse) (unsubscribeResponse, error) {
+	var valid []string
+	seen := map[string]bool{}
+	for _, value := range topics {
+		topic, err := ParseTopic(feedType, value)
 		if err != nil {
-			return "", err
+			response.UnsubscriptionResult = append(response.UnsubscriptionResult, subscriptionResult{ResultCode: 104, Result: "Invalid Topic: " + err.Error(), Topic: value})
+			continue
 		}
-		if match {
-			filter = append(filter, feedType+value)
+		if seen[topic.String()] {
+			continue
+		}
+		seen[topic.String()] = true
+		if refs := c.subscriptions.dropDirect(feedType, topic.String()); refs > 0 {
+			response.UnsubscriptionResult = append(response.UnsubscriptionResult, subscriptionResult{ResultCode: 0, Result: fmt.Sprintf("Retained: held by %d subscriptions", refs), Topic: topic.String()})
+			continue
+		}
+		valid = append(valid, topic.String())
+	}
+	if len(valid) == 0 {
+		if len(seen) != 0 {
+			response.Message = "Unsubscribed Successfully"
+			response.Status = 0
+			return response, nil
 		}
+		response.Message = "Unsubscription Failed"
+		response.Status = 103
+		return response, nil
 	}
+	response, err := c.sendUnsubscribe(valid, feedType, response)
+	c.subscriptions.restore(feedType, false, failedTopics(response.UnsubscriptionResult)...)
+	return response, err
+}
 
-	if len(filter) != 0 {
+// sendUnsubscribe sends UNSUBSCRIBE packets for already validated topics, split in
+// batches of at most 1024 topics, and records the per-topic results on the response.
+func (c *Connect) sendUnsubscribe(topics []string, feedType Feed, response unsubscribeResponse) (unsubscribeResponse, error) {
+	for n, batch := range batches(topics) {
+		if n > 0 && c.SubscriptionBatchDelay > 0 {
+			time.Sleep(c.SubscriptionBatchDelay)
+		}
+		filter := make([]string, 0, len(batch))
+		for _, topic := range batch {
+			filter = append(filter, string(feedType)+topic)
+		}
 		token := c.client.Unsubscribe(filter...)
 		if token.Wait() && token.Error() != nil {
+			for _, topic := range topics[n*maxTopicsPerPacket:] {
+				response.UnsubscriptionResult = append(response.UnsubscriptionResult, subscriptionResult{ResultCode: -1, Result: token.Error().Error(), Topic: topic})
+			}
 			response.Message = token.Error().Error()
 			response.Status = -1
-			jsonData, err := json.Marshal(response)
-			if err != nil {
-				return "", err
-			}
-			return string(jsonData), token.Error()
-
-		} else {
-			response.Message = "Unsubscribed Successfully"
-			response.Status = 0
-			jsonData, err := json.Marshal(response)
-			if err != nil {
-				return "", err
-			}
-			return string(jsonData), nil
+			return response, token.Error()
+		}
+		for _, topic := range batch {
+			response.UnsubscriptionResult = append(response.UnsubscriptionResult, subscriptionResult{ResultCode: 0, Result: "Success", Topic: topic})
 		}
+		c.subscriptions.remove(feedType, batch...)
 	}
 
-	response.Message = "Unsubscription Failed"
-	response.Status = 103
-	jsonData, err := json.Marshal(response)
-	if err != nil {
-		return "", err
+	response.Message = "Unsubscribed Successfully"
+	response.Status = 0
+	return response, nil
+}
+
+// failedTopics returns the topics the broker did not confirm. Topics rejected before
+// being sent, e.g. invalid ones, are not included.
+func failedTopics(results []subscriptionResult) []string {
+	var failed []string
+	for _, result := range results {
+		if result.ResultCode == -1 {
+			failed = append(failed, result.Topic)
+		}
 	}
-	return string(jsonData), nil
+	return failed
 }
 
 // DisconnectHost disconnects from the broker
@@ -1043,6 +1525,7 @@ func (c *Connect) DisconnectHost() (string, error) {
 	}
 
 	c.client = nil
+	c.subscriptions.reset()
 	return string(jsonData), nil
 }
 
@@ -1133,62 +1616,71 @@ func validateToken(userName string, token string) (int, string, error) {
 }
 
 var messagehandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	topic := msg.Topic()
-	re := regexp.MustCompile("(v1/)")
-	parts := re.Split(topic, -1)
-	payload := msg.Payload()
+	if instance.RawHandler != nil {
+		instance.RawHandler(msg.Payload(), msg.Topic())
+	}
+	instance.Dispatch(msg.Topic(), msg.Payload())
+}
+
+// Dispatch delivers a message to the handler of its feed, exactly as if it had been
+// received from the broker. The topic is the full MQTT topic, e.g.
+// "prod/marketfeed/mw/v1/nseeq/2885". RawHandler is not called, so that replaying
+// recorded messages does not record them again.
+func (c *Connect) Dispatch(fullTopic string, payload []byte) {
+	feed, topic := SplitTopic(fullTopic)
 
-	switch parts[0] + "v1/" {
+	switch feed {
 
 	case mw:
-		if instance.MWHandler != nil {
-			instance.MWHandler(payload, parts[1])
+		if c.MWHandler != nil {
+			c.MWHandler(payload, topic)
 		}
 	case index:
-		if instance.IndexHandler != nil {
-			instance.IndexHandler(payload, parts[1])
+		if c.IndexHandler != nil {
+			c.IndexHandler(payload, topic)
 		}
 	case oi:
-		if instance.OpenInterstHandler != nil {
-			instance.OpenInterstHandler(payload, parts[1])
+		if c.OpenInterstHandler != nil {
+			c.OpenInterstHandler(payload, topic)
 		}
 	case marketStatus:
-		if instance.MarketStatusHandler != nil {
-			instance.MarketStatusHandler(payload, parts[1])
+		if c.MarketStatusHandler != nil {
+			c.MarketStatusHandler(payload, topic)
 		}
 	case lpp:
-		if instance.LppHandler != nil {
-			instance.LppHandler(payload, parts[1])
+		if c.LppHandler != nil {
+			c.LppHandler(payload, topic)
 		}
 	case high52Week:
-		if instance.High52WeekHandler != nil {
-			instance.High52WeekHandler(payload, parts[1])
+		if c.High52WeekHandler != nil {
+			c.High52WeekHandler(payload, topic)
 		}
 	case low52Week:
-		if instance.Low52WeekHandler != nil {
-			instance.Low52WeekHandler(payload, parts[1])
+		if c.Low52WeekHandler != nil {
+			c.Low52WeekHandler(payload, topic)
 		}
 	case upperCircuit:
-		if instance.UpperCircuitHandler != nil {
-			instance.UpperCircuitHandler(payload, parts[1])
+		if c.UpperCircuitHandler != nil {
+			c.UpperCircuitHandler(payload, topic)
 		}
 	case lowerCircuit:
-		if instance.LowerCircuitHandler != nil {
-			instance.LowerCircuitHandler(payload, parts[1])
+		if c.LowerCircuitHandler != nil {
+			c.LowerCircuitHandler(payload, topic)
 		}
 	case order:
-		if instance.OrderUpdatesHandler != nil {
-			instance.OrderUpdatesHandler(payload, parts[1])
+		if c.OrderUpdatesHandler != nil {
+			c.OrderUpdatesHandler(payload, topic)
 		}
 	case trade:
-		if instance.TradeUpdatesHandler != nil {
-			instance.TradeUpdatesHandler(payload, parts[1])
+		if c.TradeUpdatesHandler != nil {
+			c.TradeUpdatesHandler(payload, topic)
 		}
 	default:
 	}
 }
 
 var onDisconnect mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
+	instance.subscriptions.reset()
 	if instance.OnDisconnect != nil {
 		instance.client = nil
 		instance.OnDisconnect(err)
@@ -0,0 +1,540 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient is an mqtt.Client that answers SUBSCRIBE and UNSUBSCRIBE requests without
+// a broker and records the size of each packet.
+type fakeClient struct {
+	mqtt.Client
+
+	mu                 sync.Mutex
+	subscribed         map[string]bool
+	rejected           map[string]bool
+	subscribePackets   []int
+	unsubscribePackets []int
+	subscribeErr       error
+	unsubscribeErr     error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{subscribed: map[string]bool{}, rejected: map[string]bool{}}
+}
+
+func (f *fakeClient) IsConnected() bool {
+	return true
+}
+
+func (f *fakeClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribeErr != nil {
+		return &fakeToken{err: f.subscribeErr}
+	}
+	f.subscribePackets = append(f.subscribePackets, len(filters))
+	result := make(map[string]byte, len(filters))
+	for topic := range filters {
+		if f.rejected[topic] {
+			result[topic] = 0x80
+			continue
+		}
+		f.subscribed[topic] = true
+	}
+	return &fakeToken{result: result}
+}
+
+func (f *fakeClient) Unsubscribe(topics ...string) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.unsubscribeErr != nil {
+		return &fakeToken{err: f.unsubscribeErr}
+	}
+	f.unsubscribePackets = append(f.unsubscribePackets, len(topics))
+	for _, topic := range topics {
+		delete(f.subscribed, topic)
+	}
+	return &fakeToken{}
+}
+
+// reject makes the broker refuse the topic of the feed with SUBACK return code 0x80.
+func (f *fakeClient) reject(feed Feed, topic string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rejected[string(feed)+topic] = true
+}
+
+func (f *fakeClient) failSubscribe(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribeErr = err
+}
+
+func (f *fakeClient) failUnsubscribe(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unsubscribeErr = err
+}
+
+// subscriptions returns the topics of the feed subscribed on the broker, sorted.
+func (f *fakeClient) subscriptions(feed Feed) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var topics []string
+	for topic := range f.subscribed {
+		if len(topic) > len(feed) && topic[:len(feed)] == string(feed) {
+			topics = append(topics, topic[len(feed):])
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (f *fakeClient) packets() (subscribe []int, unsubscribe []int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.subscribePackets...), append([]int(nil), f.unsubscribePackets...)
+}
+
+type fakeToken struct {
+	result map[string]byte
+	err    error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+func (t *fakeToken) Result() map[string]byte        { return t.result }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func fakeConnect() (*fakeClient, *Connect) {
+	client := newFakeClient()
+	return client, &Connect{client: client}
+}
+
+func decode[T any](t *testing.T, res string) T {
+	t.Helper()
+	var response T
+	if err := json.Unmarshal([]byte(res), &response); err != nil {
+		t.Fatalf("decoding %q: %v", res, err)
+	}
+	return response
+}
+
+func topicList(n int) []string {
+	topics := make([]string, n)
+	for i := range topics {
+		topics[i] = fmt.Sprintf("nseeq/%d", i+1)
+	}
+	return topics
+}
+
+func listRequest(key string, topics ...string) string {
+	data, _ := json.Marshal(map[string][]string{key: topics})
+	return string(data)
+}
+
+func TestSubscribeBatches(t *testing.T) {
+	tests := []struct {
+		topics  int
+		packets []int
+	}{
+		{topics: 1, packets: []int{1}},
+		{topics: 1024, packets: []int{1024}},
+		{topics: 1025, packets: []int{1024, 1}},
+		{topics: 2500, packets: []int{1024, 1024, 452}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.topics), func(t *testing.T) {
+			client, c := fakeConnect()
+			topics := topicList(test.topics)
+
+			res, err := c.SubscribeFeed(listRequest("subscriptionList", topics...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response := decode[subscribeResponse](t, res)
+			if response.Status != 0 || len(response.SubscriptionResult) != test.topics {
+				t.Fatalf("status %d with %d results, want 0 with %d", response.Status, len(response.SubscriptionResult), test.topics)
+			}
+			if got := len(client.subscriptions(FeedMarketWatch)); got != test.topics {
+				t.Errorf("broker has %d subscriptions, want %d", got, test.topics)
+			}
+
+			res, err = c.UnsubscribeFeed(listRequest("UnsubscriptionList", topics...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response := decode[unsubscribeResponse](t, res); response.Status != 0 || len(response.UnsubscriptionResult) != test.topics {
+				t.Fatalf("UnsubscribeFeed: status %d with %d results", response.Status, len(response.UnsubscriptionResult))
+			}
+			subscribe, unsubscribe := client.packets()
+			if !reflect.DeepEqual(subscribe, test.packets) || !reflect.DeepEqual(unsubscribe, test.packets) {
+				t.Errorf("SUBSCRIBE packets %v and UNSUBSCRIBE packets %v, want %v", subscribe, unsubscribe, test.packets)
+			}
+			if got := c.subscriptions.count(); got != 0 {
+				t.Errorf("registry has %d topics after unsubscribing", got)
+			}
+		})
+	}
+}
+
+func TestSubscribeBatchDelay(t *testing.T) {
+	_, c := fakeConnect()
+	c.SubscriptionBatchDelay = 20 * time.Millisecond
+
+	start := time.Now()
+	c.SubscribeFeed(listRequest("subscriptionList", topicList(3000)...))
+	if elapsed := time.Since(start); elapsed < 2*c.SubscriptionBatchDelay {
+		t.Errorf("three batches took %v, want at least two delays", elapsed)
+	}
+}
+
+func TestSubscribeResultCodes(t *testing.T) {
+	client, c := fakeConnect()
+	client.reject(FeedMarketWatch, "nseeq/2")
+
+	res, err := c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1", "nseeq/2", "nsee/3", "NSEEQ/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := map[string]int16{}
+	for _, result := range decode[subscribeResponse](t, res).SubscriptionResult {
+		codes[result.Topic] = result.ResultCode
+	}
+	want := map[string]int16{"nseeq/1": 0, "nseeq/2": 0x80, "nsee/3": 104}
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("result codes %v, want %v", codes, want)
+	}
+	if got := c.subscriptions.list(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/1"}) {
+		t.Errorf("registry %v, want only the accepted topic", got)
+	}
+}
+
+func TestSubscribeFailure(t *testing.T) {
+	client, c := fakeConnect()
+	client.failSubscribe(errors.New("connection lost"))
+
+	res, err := c.SubscribeFeed(listRequest("subscriptionList", topicList(1500)...))
+	if err == nil {
+		t.Fatal("SubscribeFeed succeeded while SUBSCRIBE fails")
+	}
+	response := decode[subscribeResponse](t, res)
+	if response.Status != -1 || len(response.SubscriptionResult) != 1500 || response.SubscriptionResult[0].ResultCode != -1 {
+		t.Errorf("status %d with %d results, want -1 for every topic", response.Status, len(response.SubscriptionResult))
+	}
+	if got := c.subscriptions.count(); got != 0 {
+		t.Errorf("registry has %d topics after the failure", got)
+	}
+}
+
+func TestMaxSubscriptions(t *testing.T) {
+	client, c := fakeConnect()
+	c.MaxSubscriptions = 2
+
+	res, _ := c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1", "nseeq/2"))
+	if response := decode[subscribeResponse](t, res); response.Status != 0 {
+		t.Fatalf("subscribing up to the limit: %s", res)
+	}
+	res, _ = c.SubscribeFeed(listRequest("subscriptionList", "nseeq/2", "nseeq/3"))
+	if response := decode[subscribeResponse](t, res); response.Status != 108 {
+		t.Fatalf("subscribing over the limit: %s, want status 108", res)
+	}
+	res, _ = c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1"))
+	if response := decode[subscribeResponse](t, res); response.Status != 0 {
+		t.Fatalf("subscribing an active topic at the limit: %s", res)
+	}
+	if subscribe, _ := client.packets(); !reflect.DeepEqual(subscribe, []int{2, 1}) {
+		t.Errorf("SUBSCRIBE packets %v, want the rejected request not sent", subscribe)
+	}
+}
+
+func TestUnsubscribeFailure(t *testing.T) {
+	client, c := fakeConnect()
+	c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1", "nseeq/2"))
+	client.failUnsubscribe(errors.New("connection lost"))
+
+	res, err := c.UnsubscribeFeed(listRequest("UnsubscriptionList", "nseeq/1", "nseeq/x"))
+	if err == nil {
+		t.Fatal("UnsubscribeFeed succeeded while UNSUBSCRIBE fails")
+	}
+	codes := map[string]int16{}
+	for _, result := range decode[unsubscribeResponse](t, res).UnsubscriptionResult {
+		codes[result.Topic] = result.ResultCode
+	}
+	if want := map[string]int16{"nseeq/1": -1, "nseeq/x": 104}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("result codes %v, want %v", codes, want)
+	}
+	if got := c.subscriptions.list(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/1", "nseeq/2"}) {
+		t.Errorf("registry %v, want the topics kept", got)
+	}
+}
+
+func TestSubscribeSymbols(t *testing.T) {
+	client, c := fakeConnect()
+	c.Instruments = NewInstrumentMaster([]*Instrument{
+		{Exchange: "NSE", Segment: "nseeq", InstrumentId: 2885, TradingSymbol: "RELIANCE", ISIN: "INE002A01018"},
+		{Exchange: "NSE", Segment: "nseeq", InstrumentId: 1594, TradingSymbol: "INFY"},
+	})
+	client.reject(FeedMarketWatch, "nseeq/1594")
+
+	res, err := c.SubscribeSymbols(FeedMarketWatch, "NSE:RELIANCE", "NSE:INE002A01018", "NSE:TCS", "NSE:INFY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		symbol string
+		topic  string
+		code   int16
+	}
+	var got []result
+	for _, r := range decode[subscribeResponse](t, res).SubscriptionResult {
+		got = append(got, result{r.Symbol, r.Topic, r.ResultCode})
+	}
+	want := []result{
+		{"NSE:RELIANCE", "nseeq/2885", 0},
+		{"NSE:INE002A01018", "nseeq/2885", 0},
+		{"NSE:TCS", "", 107},
+		{"NSE:INFY", "nseeq/1594", 0x80},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results %v, want %v", got, want)
+	}
+	if subscribe, _ := client.packets(); !reflect.DeepEqual(subscribe, []int{2}) {
+		t.Errorf("SUBSCRIBE packets %v, want one with each topic once", subscribe)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	client, c := fakeConnect()
+
+	first, _, err := c.Acquire(FeedMarketWatch, "nseeq/1", "nseeq/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := c.Acquire(FeedMarketWatch, "nseeq/2", "nseeq/3", "nseeq/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscribe, _ := client.packets(); !reflect.DeepEqual(subscribe, []int{2, 1}) {
+		t.Errorf("SUBSCRIBE packets %v, want a held topic not subscribed again", subscribe)
+	}
+	if got := second.Topics(); !reflect.DeepEqual(got, []string{"nseeq/2", "nseeq/3"}) {
+		t.Errorf("second subscription holds %v", got)
+	}
+
+	if _, err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.subscriptions(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/2", "nseeq/3"}) {
+		t.Errorf("broker has %v after the first release, want the shared topic kept", got)
+	}
+	if first.Active() || !second.Active() {
+		t.Errorf("Active is %v and %v, want only the unreleased subscription active", first.Active(), second.Active())
+	}
+	if _, err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, unsubscribe := client.packets(); !reflect.DeepEqual(unsubscribe, []int{1}) {
+		t.Errorf("UNSUBSCRIBE packets %v, want one for the unshared topic only", unsubscribe)
+	}
+
+	res, _ := c.SubscribeFeed(listRequest("subscriptionList", "nseeq/3"))
+	if response := decode[subscribeResponse](t, res); response.Status != 0 {
+		t.Fatalf("SubscribeFeed: %s", res)
+	}
+	if _, err := second.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.subscriptions(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/3"}) {
+		t.Errorf("broker has %v, want the directly subscribed topic kept", got)
+	}
+}
+
+func TestAcquireResultCodes(t *testing.T) {
+	client, c := fakeConnect()
+	client.reject(FeedMarketWatch, "nseeq/2")
+	c.MaxSubscriptions = 3
+
+	subscription, res, err := c.Acquire(FeedMarketWatch, "nseeq/1", "nseeq/2", "nsee/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := subscription.Topics(); !reflect.DeepEqual(got, []string{"nseeq/1"}) {
+		t.Errorf("subscription holds %v, want the topic that did not fail", got)
+	}
+	if response := decode[subscribeResponse](t, res); len(response.SubscriptionResult) != 3 {
+		t.Errorf("%d results, want one per topic", len(response.SubscriptionResult))
+	}
+
+	if _, res, _ = c.Acquire(FeedMarketWatch, "nseeq/4", "nseeq/5", "nseeq/6"); decode[subscribeResponse](t, res).Status != 108 {
+		t.Errorf("acquiring over the limit: %s, want status 108", res)
+	}
+	if _, res, _ = c.Acquire(FeedMarketWatch, "nsee/3"); decode[subscribeResponse](t, res).Status != 103 {
+		t.Errorf("acquiring only invalid topics: %s, want status 103", res)
+	}
+}
+
+func TestFailedReleaseIsRetried(t *testing.T) {
+	client, c := fakeConnect()
+	subscription, _, err := c.Acquire(FeedMarketWatch, "nseeq/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.failUnsubscribe(errors.New("connection lost"))
+	if _, err := subscription.Release(); err == nil {
+		t.Fatal("Release succeeded while UNSUBSCRIBE fails")
+	}
+	if got := subscription.Topics(); !reflect.DeepEqual(got, []string{"nseeq/1"}) {
+		t.Errorf("subscription holds %v after the failure, want the failed topic", got)
+	}
+	if entry := c.subscriptions.topics[string(FeedMarketWatch)+"nseeq/1"]; entry == nil || entry.refs != 1 {
+		t.Errorf("registry entry %+v after the failure, want the reference restored", entry)
+	}
+
+	client.failUnsubscribe(nil)
+	if _, err := subscription.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.subscriptions(FeedMarketWatch); len(got) != 0 {
+		t.Errorf("broker has %v after the retry", got)
+	}
+	if got := c.subscriptions.count(); got != 0 {
+		t.Errorf("registry has %d topics after the retry", got)
+	}
+}
+
+func TestReleaseAfterSessionEnded(t *testing.T) {
+	client, c := fakeConnect()
+	subscription, _, err := c.Acquire(FeedMarketWatch, "nseeq/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.subscriptions.reset()
+	c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1"))
+
+	if _, err := subscription.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, unsubscribe := client.packets(); len(unsubscribe) != 0 {
+		t.Errorf("a handle of the previous session sent UNSUBSCRIBE packets %v", unsubscribe)
+	}
+	if got := c.subscriptions.list(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/1"}) {
+		t.Errorf("registry %v, want the topic of the new session kept", got)
+	}
+}
+
+func TestSetSubscriptions(t *testing.T) {
+	client, c := fakeConnect()
+	set := func(topics ...string) reconcileResponse {
+		t.Helper()
+		res, err := c.SetSubscriptions(FeedMarketWatch, topics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decode[reconcileResponse](t, res)
+	}
+
+	response := set("nseeq/1", "nseeq/2")
+	if !reflect.DeepEqual(response.Added, []string{"nseeq/1", "nseeq/2"}) {
+		t.Errorf("Added %v", response.Added)
+	}
+
+	response = set("nseeq/2", "nseeq/3", "nsee/4")
+	if !reflect.DeepEqual(response.Added, []string{"nseeq/3"}) ||
+		!reflect.DeepEqual(response.Removed, []string{"nseeq/1"}) ||
+		!reflect.DeepEqual(response.Unchanged, []string{"nseeq/2"}) ||
+		len(response.Failed) != 1 || response.Failed[0].ResultCode != 104 {
+		t.Errorf("second reconcile %+v", response)
+	}
+	if got := client.subscriptions(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/2", "nseeq/3"}) {
+		t.Errorf("broker has %v", got)
+	}
+
+	if _, _, err := c.Acquire(FeedMarketWatch, "nseeq/5"); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := client.packets()
+	set("nseeq/5")
+	if after, _ := client.packets(); len(after) != len(before) {
+		t.Errorf("a topic held by a handle was subscribed again")
+	}
+	set()
+	if got := client.subscriptions(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/5"}) {
+		t.Errorf("broker has %v, want the held topic kept", got)
+	}
+	if got := c.subscriptions.direct(FeedMarketWatch); len(got) != 0 {
+		t.Errorf("direct topics %v, want none", got)
+	}
+}
+
+func TestSetSubscriptionsLimit(t *testing.T) {
+	_, c := fakeConnect()
+	c.MaxSubscriptions = 2
+	c.SetSubscriptions(FeedMarketWatch, []string{"nseeq/1", "nseeq/2"})
+
+	// The stale topics are removed before the new ones are counted against the limit.
+	res, _ := c.SetSubscriptions(FeedMarketWatch, []string{"nseeq/3", "nseeq/4"})
+	if response := decode[reconcileResponse](t, res); response.Status != 0 || len(response.Added) != 2 {
+		t.Errorf("replacing the list at the limit: %s", res)
+	}
+	res, _ = c.SetSubscriptions(FeedMarketWatch, []string{"nseeq/3", "nseeq/4", "nseeq/5"})
+	if response := decode[reconcileResponse](t, res); response.Status != 108 {
+		t.Errorf("growing the list over the limit: %s, want status 108", res)
+	}
+}
+
+func TestFailedUnsubscribeIsRetried(t *testing.T) {
+	t.Run("SetSubscriptions", func(t *testing.T) {
+		client, c := fakeConnect()
+		if _, err := c.SetSubscriptions(FeedMarketWatch, []string{"nseeq/1"}); err != nil {
+			t.Fatal(err)
+		}
+		client.failUnsubscribe(errors.New("connection lost"))
+		res, err := c.SetSubscriptions(FeedMarketWatch, nil)
+		if err == nil {
+			t.Fatal("SetSubscriptions succeeded while UNSUBSCRIBE fails")
+		}
+		if response := decode[reconcileResponse](t, res); len(response.Failed) != 1 || response.Failed[0].Topic != "nseeq/1" {
+			t.Errorf("Failed %v, want nseeq/1", response.Failed)
+		}
+		client.failUnsubscribe(nil)
+		res, err = c.SetSubscriptions(FeedMarketWatch, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response := decode[reconcileResponse](t, res); !reflect.DeepEqual(response.Removed, []string{"nseeq/1"}) {
+			t.Errorf("Removed %v on the retry, want nseeq/1", response.Removed)
+		}
+		if got := client.subscriptions(FeedMarketWatch); len(got) != 0 {
+			t.Errorf("broker has %v after the retry", got)
+		}
+	})
+
+	t.Run("UnsubscribeFeed", func(t *testing.T) {
+		client, c := fakeConnect()
+		c.SubscribeFeed(listRequest("subscriptionList", "nseeq/1"))
+		client.failUnsubscribe(errors.New("connection lost"))
+		if _, err := c.UnsubscribeFeed(listRequest("UnsubscriptionList", "nseeq/1")); err == nil {
+			t.Fatal("UnsubscribeFeed succeeded while UNSUBSCRIBE fails")
+		}
+		if got := c.subscriptions.direct(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/1"}) {
+			t.Errorf("direct topics %v after the failure, want nseeq/1", got)
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// ExchangeEpoch is the origin of LastTradedTime, which counts seconds from it.
+var ExchangeEpoch = time.Unix(0, 0)
+
+// IST is the time zone of the exchange sessions.
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+// MWBOCombined is the MarketWatch payload of the prod/marketfeed/mw/v1/ feed.
+type MWBOCombined struct {
+	Ltp                int32     `json:"ltp"`
+	LastTradedQuantity uint32    `json:"lastTradedQuantity"`
+	TradedVolume       uint32    `json:"tradedVolume"`
+	High               int32     `json:"high"`
+	Low                int32     `json:"low"`
+	Open               int32     `json:"open"`
+	Close              int32     `json:"close"`
+	AverageTradedPrice int32     `json:"averageTradedPrice"`
+	Reserved           uint16    `json:"reserved"`
+	BestBidQuantity    uint32    `json:"bestBidQuantity"`
+	BestBidPrice       int32     `json:"bestBidPrice"`
+	BestAskQuantity    uint32    `json:"bestAskQuantity"`
+	BestAskPrice       int32     `json:"bestAskPrice"`
+	TotalBidQuantity   uint32    `json:"totalBidQuantity"`
+	TotalAskQuantity   uint32    `json:"totalAskQuantity"`
+	PriceDivisor       int32     `json:"priceDivisor"`
+	LastTradedTime     int32     `json:"lastTradedTime"`
+	MarketDepth        [10]Depth `json:"marketDepth"` // Array of 10 Depth structures
+}
+
+// Depth is one level of the market depth carried by MWBOCombined.
+type Depth struct {
+	Quantity        uint32 `json:"quantity"`
+	Price           int32  `json:"price"`
+	Orders          int16  `json:"orders"`
+	TransactionType int16  `json:"transactionType"`
+}
+
+// Transaction types of a Depth level.
+const (
+	TransactionTypeBuy  int16 = 'B'
+	TransactionTypeSell int16 = 'S'
+)
+
+// IndexTick is the payload of the prod/marketfeed/index/v1/ feed. The values are raw
+// index points scaled by PriceDivisor.
+//
+// The bridge does not document the index payload. This layout is provisional: eight
+// little endian 32 bit fields in the order below, modelled on the MarketWatch payload,
+// whose prices are also int32 scaled by a PriceDivisor and whose times count seconds
+// from ExchangeEpoch. Check it against live payloads before relying on it.
+type IndexTick struct {
+	Value        int32 `json:"value"`
+	Open         int32 `json:"open"`
+	High         int32 `json:"high"`
+	Low          int32 `json:"low"`
+	Close        int32 `json:"close"`
+	Change       int32 `json:"change"`
+	PriceDivisor int32 `json:"priceDivisor"`
+	// Timestamp counts seconds from ExchangeEpoch, like LastTradedTime.
+	Timestamp int32 `json:"timestamp"`
+}
+
+// OpenInterestData is the payload of the prod/marketfeed/oi/v1/ feed.
+type OpenInterestData struct {
+	OpenInterest int32 `json:"openInterest"`
+	DayHighOi    int32 `json:"dayHighOi"`
+	DayLowOi     int32 `json:"dayLowOi"`
+	PreviousOi   int32 `json:"previousOi"`
+}
+
+// LppData is the payload of the prod/marketfeed/lpp/v1/ feed.
+type LppData struct {
+	LppHigh      uint32 `json:"lppHigh"`
+	LppLow       uint32 `json:"lppLow"`
+	PriceDivisor int32  `json:"priceDivisor"`
+}
+
+// UpperCircuitData is the payload of the prod/marketfeed/uppercircuit/v1/ feed.
+type UpperCircuitData struct {
+	InstrumentId uint32 `json:"instrumentId"`
+	UpperCircuit uint32 `json:"upperCircuit"`
+	PriceDivisor int32  `json:"priceDivisor"`
+}
+
+// LowerCircuitData is the payload of the prod/marketfeed/lowercircuit/v1/ feed.
+type LowerCircuitData struct {
+	InstrumentId uint32 `json:"instrumentId"`
+	LowerCircuit uint32 `json:"lowerCircuit"`
+	PriceDivisor int32  `json:"priceDivisor"`
+}
+
+// MarketStatusData is the payload of the prod/marketfeed/marketStatus/v1/ feed.
+type MarketStatusData struct {
+	MarketStatusCode uint16 `json:"MarketStatusCode"`
+}
+
+// High52WeekData is the payload of the prod/marketfeed/high52week/v1/ feed.
+type High52WeekData struct {
+	InstrumentId uint32 `json:"instrumentId"`
+	High52Week   uint32 `json:"52WeekHigh"`
+	PriceDivisor int32  `json:"priceDivisor"`
+}
+
+// Low52WeekData is the payload of the prod/marketfeed/low52week/v1/ feed.
+type Low52WeekData struct {
+	InstrumentId uint32 `json:"instrumentId"`
+	Low52Week    uint32 `json:"52WeekLow"`
+	PriceDivisor int32  `json:"priceDivisor"`
+}
+
+// Price converts a raw price of the payload to rupees using its PriceDivisor.
+func (m *MWBOCombined) Price(raw int32) float64 {
+	return toPrice(int64(raw), m.PriceDivisor)
+}
+
+// TradedAt returns LastTradedTime as a time.
+func (m *MWBOCombined) TradedAt() time.Time {
+	return ExchangeEpoch.Add(time.Duration(m.LastTradedTime) * time.Second)
+}
+
+// Price converts a raw value of the payload to index points using its PriceDivisor,
+// e.g. tick.Price(tick.Value).
+func (i *IndexTick) Price(raw int32) float64 {
+	return toPrice(int64(raw), i.PriceDivisor)
+}
+
+// ChangePercent returns Change in percent of the previous Close, or zero without a close.
+func (i *IndexTick) ChangePercent() float64 {
+	if i.Close == 0 {
+		return 0
+	}
+	return float64(i.Change) / float64(i.Close) * 100
+}
+
+// UpdatedAt returns Timestamp as a time.
+func (i *IndexTick) UpdatedAt() time.Time {
+	return ExchangeEpoch.Add(time.Duration(i.Timestamp) * time.Second)
+}
+
+// Range returns the LPP band in rupees.
+func (l *LppData) Range() (low float64, high float64) {
+	return toPrice(int64(l.LppLow), l.PriceDivisor), toPrice(int64(l.LppHigh), l.PriceDivisor)
+}
+
+// Price returns the upper circuit limit in rupees.
+func (u *UpperCircuitData) Price() float64 {
+	return toPrice(int64(u.UpperCircuit), u.PriceDivisor)
+}
+
+// Price returns the lower circuit limit in rupees.
+func (l *LowerCircuitData) Price() float64 {
+	return toPrice(int64(l.LowerCircuit), l.PriceDivisor)
+}
+
+// Price returns the 52 week high in rupees.
+func (h *High52WeekData) Price() float64 {
+	return toPrice(int64(h.High52Week), h.PriceDivisor)
+}
+
+// Price returns the 52 week low in rupees.
+func (l *Low52WeekData) Price() float64 {
+	return toPrice(int64(l.Low52Week), l.PriceDivisor)
+}
+
+func toPrice(raw int64, divisor int32) float64 {
+	if divisor == 0 {
+		divisor = 1
+	}
+	return float64(raw) / float64(divisor)
+}
+
+// DecodeFeed decodes a little endian binary payload into one of the feed structures,
+// e.g. a *MWBOCombined or a *LppData.
+func DecodeFeed(payload []byte, data interface{}) error {
+	return binary.Read(bytes.NewReader(payload), binary.LittleEndian, data)
+}
+
+// EncodeFeed encodes one of the feed structures as the little endian binary payload
+// published by the bridge.
+func EncodeFeed(data interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := binary.Write(&buffer, binary.LittleEndian, data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecodeMW decodes a MarketWatch payload.
+func DecodeMW(payload []byte) (MWBOCombined, error) {
+	var data MWBOCombined
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeIndex decodes an Index payload.
+func DecodeIndex(payload []byte) (IndexTick, error) {
+	var data IndexTick
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeOpenInterest decodes an Open Interest payload.
+func DecodeOpenInterest(payload []byte) (OpenInterestData, error) {
+	var data OpenInterestData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeLpp decodes an LPP payload.
+func DecodeLpp(payload []byte) (LppData, error) {
+	var data LppData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeUpperCircuit decodes an Upper Circuit payload.
+func DecodeUpperCircuit(payload []byte) (UpperCircuitData, error) {
+	var data UpperCircuitData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeLowerCircuit decodes a Lower Circuit payload.
+func DecodeLowerCircuit(payload []byte) (LowerCircuitData, error) {
+	var data LowerCircuitData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeMarketStatus decodes a Market Status payload.
+func DecodeMarketStatus(payload []byte) (MarketStatusData, error) {
+	var data MarketStatusData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeHigh52Week decodes a High 52 Week payload.
+func DecodeHigh52Week(payload []byte) (High52WeekData, error) {
+	var data High52WeekData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
+
+// DecodeLow52Week decodes a Low 52 Week payload.
+func DecodeLow52Week(payload []byte) (Low52WeekData, error) {
+	var data Low52WeekData
+	err := DecodeFeed(payload, &data)
+	return data, err
+}
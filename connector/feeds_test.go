@@ -0,0 +1,51 @@
+package connector
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestDecodeIndex(t *testing.T) {
+	// NIFTY at 24854.05, up 104.20 from 24749.85, at 2024-10-18 15:30:00 IST.
+	payload, err := hex.DecodeString("" +
+		"9dec2500" + // value 2485405
+		"a2b62500" + // open 2471586
+		"c3432600" + // high 2507715
+		"5eb12400" + // low 2404702
+		"e9c32500" + // close 2474985
+		"b4280000" + // change 10420
+		"64000000" + // price divisor 100
+		"a0311267") // timestamp 1729245600
+	if err != nil {
+		t.Fatal(err)
+	}
+	tick, err := DecodeIndex(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IndexTick{Value: 2485405, Open: 2471586, High: 2507715, Low: 2404702, Close: 2474985, Change: 10420, PriceDivisor: 100, Timestamp: 1729245600}
+	if tick != want {
+		t.Fatalf("DecodeIndex = %+v, want %+v", tick, want)
+	}
+	if got := tick.Price(tick.Value); got != 24854.05 {
+		t.Errorf("Price(Value) = %v, want 24854.05", got)
+	}
+	if got := tick.ChangePercent(); got < 0.42101 || got > 0.42102 {
+		t.Errorf("ChangePercent = %v, want 0.42101...", got)
+	}
+	if got, want := tick.UpdatedAt(), time.Date(2024, 10, 18, 15, 30, 0, 0, IST); !got.Equal(want) {
+		t.Errorf("UpdatedAt = %v, want %v", got, want)
+	}
+
+	encoded, err := EncodeFeed(&tick)
+	if err != nil || hex.EncodeToString(encoded) != hex.EncodeToString(payload) {
+		t.Errorf("EncodeFeed = %x, %v; want the decoded payload", encoded, err)
+	}
+	if _, err := DecodeIndex(payload[:31]); err == nil {
+		t.Error("DecodeIndex of a short payload succeeded")
+	}
+	if (&IndexTick{Change: 5}).ChangePercent() != 0 {
+		t.Error("ChangePercent without a close is not zero")
+	}
+}
@@ -0,0 +1,473 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInstrumentNotFound is returned when a symbol cannot be resolved against the instrument master.
+var ErrInstrumentNotFound = errors.New("instrument not found")
+
+// exchangeSegments maps the exchange prefixes accepted in symbols to bridge segments.
+var exchangeSegments = map[string]string{
+	"NSE":   "nseeq",
+	"NFO":   "nsefo",
+	"CDS":   "nsecurr",
+	"NCO":   "nsecomm",
+	"BSE":   "bseeq",
+	"BFO":   "bsefo",
+	"BCD":   "bsecurr",
+	"BCO":   "bsecomm",
+	"MCX":   "mcxcomm",
+	"NCDEX": "ncdexcomm",
+}
+
+// Instrument describes a single contract of the exchange contract master.
+type Instrument struct {
+	Exchange               string    `json:"exchange"`
+	Segment                string    `json:"segment"`
+	InstrumentId           uint32    `json:"instrumentId"`
+	TradingSymbol          string    `json:"tradingSymbol"`
+	Name                   string    `json:"name"`
+	ISIN                   string    `json:"isin"`
+	Expiry                 time.Time `json:"expiry"`
+	Strike                 float64   `json:"strike"`
+	OptionType             string    `json:"optionType"`
+	LotSize                int32     `json:"lotSize"`
+	TickSize               float64   `json:"tickSize"`
+	PriceDivisor           int32     `json:"priceDivisor"`
+	UnderlyingInstrumentId uint32    `json:"underlyingInstrumentId"`
+}
+
+// Topic returns the bridge topic of the instrument, e.g. "nseeq/2885".
+func (i *Instrument) Topic() string {
+	return i.Segment + "/" + strconv.FormatUint(uint64(i.InstrumentId), 10)
+}
+
+// IsOption reports whether the instrument is a call or put option.
+func (i *Instrument) IsOption() bool {
+	return i.OptionType == "CE" || i.OptionType == "PE"
+}
+
+// InstrumentMaster is an in-memory index of the exchange contract master.
+// It is safe for concurrent reads once loaded.
+type InstrumentMaster struct {
+	instruments []*Instrument
+	bySymbol    map[string]*Instrument
+	byId        map[string]*Instrument
+	byISIN      map[string][]*Instrument
+	byName      map[string][]*Instrument
+}
+
+// LoadInstrumentMaster loads a contract master from a local CSV or JSON file.
+// The format is chosen from the file extension, falling back to the content when
+// the extension is neither ".csv" nor ".json".
+//
+// CSV files must have a header row. JSON files hold an array of objects, optionally
+// wrapped in an object under "result" or "data". Column and key names are matched
+// case-insensitively, e.g. "instrumentId", "tradingSymbol", "isin", "expiry",
+// "strikePrice", "optionType", "lotSize", "tickSize", "priceDivisor".
+//
+// A record whose exchange or segment does not map to a bridge segment fails the load,
+// since its topic could not be subscribed.
+func LoadInstrumentMaster(path string) (*InstrumentMaster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		records, err = readJSONRecords(data)
+	case ".csv":
+		records, err = readCSVRecords(data)
+	default:
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+			records, err = readJSONRecords(data)
+		} else {
+			records, err = readCSVRecords(data)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	instruments := make([]*Instrument, 0, len(records))
+	for n, record := range records {
+		instrument, err := parseInstrument(record)
+		if err != nil {
+			return nil, fmt.Errorf("instrument master %s: record %d: %w", path, n+1, err)
+		}
+		instruments = append(instruments, instrument)
+	}
+	return NewInstrumentMaster(instruments), nil
+}
+
+// NewInstrumentMaster builds an instrument master from already parsed instruments.
+func NewInstrumentMaster(instruments []*Instrument) *InstrumentMaster {
+	m := &InstrumentMaster{
+		instruments: instruments,
+		bySymbol:    make(map[string]*Instrument, len(instruments)),
+		byId:        make(map[string]*Instrument, len(instruments)),
+		byISIN:      map[string][]*Instrument{},
+		byName:      map[string][]*Instrument{},
+	}
+	for _, instrument := range instruments {
+		m.byId[instrument.Topic()] = instrument
+		if instrument.TradingSymbol != "" {
+			m.bySymbol[instrument.Segment+":"+strings.ToUpper(instrument.TradingSymbol)] = instrument
+		}
+		if instrument.ISIN != "" {
+			isin := strings.ToUpper(instrument.ISIN)
+			m.byISIN[isin] = append(m.byISIN[isin], instrument)
+		}
+		if instrument.Name != "" && !instrument.Expiry.IsZero() {
+			name := strings.ToUpper(instrument.Name)
+			m.byName[name] = append(m.byName[name], instrument)
+		}
+	}
+	for _, list := range m.byName {
+		sort.Slice(list, func(a, b int) bool {
+			if !list[a].Expiry.Equal(list[b].Expiry) {
+				return list[a].Expiry.Before(list[b].Expiry)
+			}
+			if list[a].Strike != list[b].Strike {
+				return list[a].Strike < list[b].Strike
+			}
+			return list[a].OptionType < list[b].OptionType
+		})
+	}
+	return m
+}
+
+// Len returns the number of instruments in the master.
+func (m *InstrumentMaster) Len() int {
+	return len(m.instruments)
+}
+
+// Instruments returns all instruments in load order.
+func (m *InstrumentMaster) Instruments() []*Instrument {
+	return m.instruments
+}
+
+// Lookup resolves a symbol to an instrument. Accepted forms are
+// "EXCHANGE:TRADINGSYMBOL" (e.g. "NSE:RELIANCE", "NFO:NIFTY24OCTFUT"),
+// "EXCHANGE:ISIN" and a bridge topic such as "nseeq/2885".
+// The exchange may also be given as a bridge segment, e.g. "nseeq:RELIANCE".
+func (m *InstrumentMaster) Lookup(symbol string) (*Instrument, error) {
+	symbol = strings.TrimSpace(symbol)
+	if segment, id, found := strings.Cut(symbol, "/"); found {
+		value, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid instrument id", symbol)
+		}
+		if instrument, ok := m.ByInstrumentId(segment, uint32(value)); ok {
+			return instrument, nil
+		}
+		return nil, fmt.Errorf("%s: %w", symbol, ErrInstrumentNotFound)
+	}
+
+	exchange, name, found := strings.Cut(symbol, ":")
+	if !found || name == "" {
+		return nil, fmt.Errorf("%s: symbol should be of the form EXCHANGE:SYMBOL", symbol)
+	}
+	segment, ok := segmentOf(exchange)
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown exchange %q", symbol, exchange)
+	}
+	name = strings.ToUpper(name)
+	if instrument, ok := m.bySymbol[segment+":"+name]; ok {
+		return instrument, nil
+	}
+	for _, instrument := range m.byISIN[name] {
+		if instrument.Segment == segment {
+			return instrument, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", symbol, ErrInstrumentNotFound)
+}
+
+// ByInstrumentId returns the instrument with the given segment and instrument id.
+func (m *InstrumentMaster) ByInstrumentId(segment string, id uint32) (*Instrument, bool) {
+	instrument, ok := m.byId[strings.ToLower(segment)+"/"+strconv.FormatUint(uint64(id), 10)]
+	return instrument, ok
+}
+
+// ByISIN returns every instrument listed under the ISIN, across exchanges.
+func (m *InstrumentMaster) ByISIN(isin string) []*Instrument {
+	return m.byISIN[strings.ToUpper(isin)]
+}
+
+// Derivatives returns the contracts on an underlying sorted by expiry, strike and
+// option type. Zero values of expiry, strike and optionType match any contract;
+// use optionType "FUT" to select futures only.
+func (m *InstrumentMaster) Derivatives(underlying string, expiry time.Time, strike float64, optionType string) []*Instrument {
+	var result []*Instrument
+	optionType = strings.ToUpper(optionType)
+	for _, instrument := range m.byName[strings.ToUpper(underlying)] {
+		if !expiry.IsZero() && !sameDay(instrument.Expiry, expiry) {
+			continue
+		}
+		if strike != 0 && instrument.Strike != strike {
+			continue
+		}
+		switch {
+		case optionType == "":
+		case optionType == "FUT":
+			if instrument.IsOption() {
+				continue
+			}
+		case instrument.OptionType != optionType:
+			continue
+		}
+		result = append(result, instrument)
+	}
+	return result
+}
+
+// Expiries returns the distinct expiry dates of the contracts on an underlying in ascending order.
+func (m *InstrumentMaster) Expiries(underlying string) []time.Time {
+	var result []time.Time
+	for _, instrument := range m.byName[strings.ToUpper(underlying)] {
+		if len(result) == 0 || !sameDay(result[len(result)-1], instrument.Expiry) {
+			result = append(result, instrument.Expiry)
+		}
+	}
+	return result
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func segmentOf(exchange string) (string, bool) {
+	if segment, ok := exchangeSegments[strings.ToUpper(exchange)]; ok {
+		return segment, true
+	}
+	exchange = strings.ToLower(exchange)
+	for _, segment := range exchangeSegments {
+		if segment == exchange {
+			return segment, true
+		}
+	}
+	return "", false
+}
+
+func exchangeOf(segment string) string {
+	for exchange, value := range exchangeSegments {
+		if value == segment {
+			return exchange
+		}
+	}
+	return ""
+}
+
+// instrumentColumns lists the accepted header names of each instrument field,
+// in the normalised form produced by normaliseColumn.
+var instrumentColumns = map[string][]string{
+	"exchange":               {"exchange", "exch"},
+	"segment":                {"segment", "exchangesegment"},
+	"instrumentId":           {"instrumentid", "exchangeinstrumentid", "token", "scripcode"},
+	"tradingSymbol":          {"tradingsymbol"},
+	"name":                   {"name", "underlying", "underlyingsymbol", "symbol"},
+	"isin":                   {"isin"},
+	"expiry":                 {"expiry", "expirydate"},
+	"strike":                 {"strike", "strikeprice"},
+	"optionType":             {"optiontype", "opttype"},
+	"lotSize":                {"lotsize", "marketlot"},
+	"tickSize":               {"ticksize"},
+	"priceDivisor":           {"pricedivisor", "divisor"},
+	"underlyingInstrumentId": {"underlyinginstrumentid", "underlyingtoken"},
+}
+
+var expiryLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"02-Jan-2006",
+	"02Jan2006",
+	"02-01-2006",
+	"02/01/2006",
+	"20060102",
+}
+
+func normaliseColumn(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func field(record map[string]string, key string) string {
+	for _, column := range instrumentColumns[key] {
+		if value, ok := record[column]; ok && value != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func parseInstrument(record map[string]string) (*Instrument, error) {
+	var instrument Instrument
+
+	id, err := strconv.ParseUint(field(record, "instrumentId"), 10, 32)
+	if err != nil || id == 0 {
+		return nil, fmt.Errorf("invalid instrument id %q", field(record, "instrumentId"))
+	}
+	instrument.InstrumentId = uint32(id)
+
+	instrument.Exchange = strings.ToUpper(field(record, "exchange"))
+	instrument.Segment = strings.ToLower(field(record, "segment"))
+	if instrument.Segment == "" {
+		segment, ok := segmentOf(instrument.Exchange)
+		if !ok {
+			return nil, fmt.Errorf("unknown exchange %q", instrument.Exchange)
+		}
+		instrument.Segment = segment
+	} else if segment, ok := segmentOf(instrument.Segment); ok {
+		instrument.Segment = segment
+	} else {
+		return nil, fmt.Errorf("unknown segment %q", instrument.Segment)
+	}
+	if _, ok := exchangeSegments[instrument.Exchange]; !ok {
+		instrument.Exchange = exchangeOf(instrument.Segment)
+	}
+
+	instrument.TradingSymbol = field(record, "tradingSymbol")
+	instrument.Name = field(record, "name")
+	instrument.ISIN = strings.ToUpper(field(record, "isin"))
+	instrument.OptionType = strings.ToUpper(field(record, "optionType"))
+
+	if value := field(record, "expiry"); value != "" && value != "0" {
+		expiry, err := parseExpiry(value)
+		if err != nil {
+			return nil, err
+		}
+		instrument.Expiry = expiry
+	}
+	if value := field(record, "strike"); value != "" {
+		if instrument.Strike, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid strike %q", value)
+		}
+	}
+	if value := field(record, "lotSize"); value != "" {
+		lotSize, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lot size %q", value)
+		}
+		instrument.LotSize = int32(lotSize)
+	}
+	if value := field(record, "tickSize"); value != "" {
+		if instrument.TickSize, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid tick size %q", value)
+		}
+	}
+	if value := field(record, "priceDivisor"); value != "" {
+		divisor, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price divisor %q", value)
+		}
+		instrument.PriceDivisor = int32(divisor)
+	}
+	if value := field(record, "underlyingInstrumentId"); value != "" {
+		underlying, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid underlying instrument id %q", value)
+		}
+		instrument.UnderlyingInstrumentId = uint32(underlying)
+	}
+	return &instrument, nil
+}
+
+func parseExpiry(value string) (time.Time, error) {
+	for _, layout := range expiryLayouts {
+		if expiry, err := time.Parse(layout, value); err == nil {
+			return expiry, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q", value)
+}
+
+func readCSVRecords(data []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for n := range header {
+		header[n] = normaliseColumn(header[n])
+	}
+
+	var records []map[string]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := make(map[string]string, len(header))
+		for n, value := range row {
+			if n < len(header) {
+				record[header[n]] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func readJSONRecords(data []byte) ([]map[string]string, error) {
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		var wrapped map[string]json.RawMessage
+		if json.Unmarshal(data, &wrapped) != nil {
+			return nil, err
+		}
+		list, ok := wrapped["result"]
+		if !ok {
+			list = wrapped["data"]
+		}
+		if err := json.Unmarshal(list, &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	records := make([]map[string]string, 0, len(raw))
+	for _, object := range raw {
+		record := make(map[string]string, len(object))
+		for key, value := range object {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				record[normaliseColumn(key)] = v
+			case float64:
+				record[normaliseColumn(key)] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[normaliseColumn(key)] = fmt.Sprint(v)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,179 @@
+package connector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const instrumentsCSV = `Exchange,ExchangeSegment,ExchangeInstrumentID,TradingSymbol,Name,ISIN,ExpiryDate,StrikePrice,OptionType,LotSize,TickSize,PriceDivisor
+NSE,,2885,RELIANCE,RELIANCE,INE002A01018,,,,1,0.05,100
+BSE,,500325,RELIANCE,RELIANCE,INE002A01018,,,,1,0.05,100
+NFO,,35001,NIFTY24OCTFUT,NIFTY,,31-Oct-2024,,,25,0.05,100
+NFO,,35002,NIFTY24OCT25000CE,NIFTY,,31-Oct-2024,25000,CE,25,0.05,100
+NFO,,35003,NIFTY24OCT25000PE,NIFTY,,31-Oct-2024,25000,PE,25,0.05,100
+NFO,,35101,NIFTY24NOVFUT,NIFTY,,28-Nov-2024,,,25,0.05,100
+`
+
+const instrumentsJSON = `{"result": [
+	{"exchange": "NSE", "instrumentId": 2885, "tradingSymbol": "RELIANCE", "isin": "INE002A01018", "lotSize": 1},
+	{"segment": "nsefo", "instrumentId": "35001", "tradingSymbol": "NIFTY24OCTFUT", "name": "NIFTY", "expiry": "2024-10-31", "lotSize": 25}
+]}`
+
+func writeMaster(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadMaster(t *testing.T, name string, content string) *InstrumentMaster {
+	t.Helper()
+	master, err := LoadInstrumentMaster(writeMaster(t, name, content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+func TestLoadInstrumentMaster(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		count   int
+	}{
+		{"csv", "master.csv", instrumentsCSV, 6},
+		{"json", "master.json", instrumentsJSON, 2},
+		{"json by content", "master.txt", instrumentsJSON, 2},
+		{"csv by content", "master.txt", instrumentsCSV, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			master := loadMaster(t, test.file, test.content)
+			if master.Len() != test.count {
+				t.Fatalf("loaded %d instruments, want %d", master.Len(), test.count)
+			}
+			future, err := master.Lookup("NFO:NIFTY24OCTFUT")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Instrument{Exchange: "NFO", Segment: "nsefo", InstrumentId: 35001, TradingSymbol: "NIFTY24OCTFUT", Name: "NIFTY",
+				Expiry: time.Date(2024, 10, 31, 0, 0, 0, 0, time.UTC), LotSize: 25}
+			future.TickSize, future.PriceDivisor = 0, 0
+			if !reflect.DeepEqual(*future, want) {
+				t.Errorf("NIFTY24OCTFUT is %+v, want %+v", *future, want)
+			}
+		})
+	}
+}
+
+func TestLoadInstrumentMasterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown exchange", "exchange,instrumentId\nNSX,1\n", `record 1: unknown exchange "NSX"`},
+		{"unknown segment", "segment,instrumentId\nnseidx,1\n", `record 1: unknown segment "nseidx"`},
+		{"zero instrument id", "exchange,instrumentId\nNSE,0\n", `record 1: invalid instrument id "0"`},
+		{"invalid expiry", "exchange,instrumentId,expiry\nNFO,1,31/31/2024\n", `record 1: invalid expiry "31/31/2024"`},
+	}
+	for _, test := range tests {
+		_, err := LoadInstrumentMaster(writeMaster(t, "master.csv", test.content))
+		if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	master := loadMaster(t, "master.csv", instrumentsCSV)
+	tests := []struct {
+		symbol string
+		topic  string
+		err    error
+	}{
+		{symbol: "NSE:RELIANCE", topic: "nseeq/2885"},
+		{symbol: "nse:reliance", topic: "nseeq/2885"},
+		{symbol: "BSE:INE002A01018", topic: "bseeq/500325"},
+		{symbol: "nseeq:RELIANCE", topic: "nseeq/2885"},
+		{symbol: "nsefo/35002", topic: "nsefo/35002"},
+		{symbol: " NFO:NIFTY24NOVFUT ", topic: "nsefo/35101"},
+		{symbol: "NSE:INFY", err: ErrInstrumentNotFound},
+		{symbol: "nseeq/1", err: ErrInstrumentNotFound},
+		{symbol: "NSX:RELIANCE"},
+		{symbol: "RELIANCE"},
+		{symbol: "nseeq/x"},
+	}
+	for _, test := range tests {
+		instrument, err := master.Lookup(test.symbol)
+		switch {
+		case test.topic != "":
+			if err != nil || instrument.Topic() != test.topic {
+				t.Errorf("Lookup(%q) = %v, %v; want %s", test.symbol, instrument, err, test.topic)
+			}
+		case test.err != nil:
+			if !errors.Is(err, test.err) {
+				t.Errorf("Lookup(%q) error %v, want %v", test.symbol, err, test.err)
+			}
+		case err == nil:
+			t.Errorf("Lookup(%q) = %s, want an error", test.symbol, instrument.Topic())
+		}
+	}
+}
+
+func TestDerivatives(t *testing.T) {
+	master := loadMaster(t, "master.csv", instrumentsCSV)
+	october := time.Date(2024, 10, 31, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		expiry     time.Time
+		strike     float64
+		optionType string
+		ids        []uint32
+	}{
+		{name: "all", ids: []uint32{35001, 35002, 35003, 35101}},
+		{name: "expiry", expiry: october, ids: []uint32{35001, 35002, 35003}},
+		{name: "futures", optionType: "FUT", ids: []uint32{35001, 35101}},
+		{name: "calls at strike", strike: 25000, optionType: "ce", ids: []uint32{35002}},
+	}
+	for _, test := range tests {
+		var ids []uint32
+		for _, instrument := range master.Derivatives("nifty", test.expiry, test.strike, test.optionType) {
+			ids = append(ids, instrument.InstrumentId)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: %v, want %v", test.name, ids, test.ids)
+		}
+	}
+	if expiries := master.Expiries("NIFTY"); len(expiries) != 2 {
+		t.Errorf("expiries %v, want 2", expiries)
+	}
+}
+
+func TestSymbolResults(t *testing.T) {
+	symbols := []string{"NSE:RELIANCE", "NSE:INE002A01018", "NSE:INFY", "BSE:RELIANCE"}
+	resolved := []string{"nseeq/2885", "nseeq/2885", "", "bseeq/500325"}
+	failures := []error{nil, nil, ErrInstrumentNotFound, nil}
+	response := subscribeResponse{Message: "Success", SubscriptionResult: []subscriptionResult{
+		{ResultCode: 0, Result: "Success", Topic: "nseeq/2885"},
+		{ResultCode: 0x80, Result: "Failure", Topic: "bseeq/500325"},
+	}}
+
+	want := []subscriptionResult{
+		{ResultCode: 0, Result: "Success", Topic: "nseeq/2885", Symbol: "NSE:RELIANCE"},
+		{ResultCode: 0, Result: "Success", Topic: "nseeq/2885", Symbol: "NSE:INE002A01018"},
+		{ResultCode: 107, Result: ErrInstrumentNotFound.Error(), Symbol: "NSE:INFY"},
+		{ResultCode: 0x80, Result: "Failure", Topic: "bseeq/500325", Symbol: "BSE:RELIANCE"},
+	}
+	if got := symbolResults(symbols, resolved, failures, response); !reflect.DeepEqual(got, want) {
+		t.Errorf("results %+v, want %+v", got, want)
+	}
+}
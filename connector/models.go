@@ -1,14 +1,16 @@
 package connector
 
 type connectRequest struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Password string `json:"password"`
+	Host                 string `json:"host"`
+	Port                 int    `json:"port"`
+	Password             string `json:"password"`
+	RestoreSubscriptions string `json:"restoreSubscriptions"`
 }
 
 type connectResponse struct {
-	Message string `json:"message"`
-	Status  int16  `json:"status"`
+	Message string          `json:"message"`
+	Status  int16           `json:"status"`
+	Restore *importResponse `json:"restore,omitempty"`
 }
 
 type subscribeRequest struct {
@@ -25,6 +27,7 @@ type subscriptionResult struct {
 	ResultCode int16  `json:"resultCode"`
 	Result     string `json:"result"`
 	Topic      string `json:"topic"`
+	Symbol     string `json:"symbol,omitempty"`
 }
 
 type unsubscribeRequest struct {
@@ -32,8 +35,30 @@ type unsubscribeRequest struct {
 }
 
 type unsubscribeResponse struct {
+	Status               int16                `json:"status"`
+	Message              string               `json:"message"`
+	UnsubscriptionResult []subscriptionResult `json:"unsubscriptionResult,omitempty"`
+}
+
+type reconcileResponse struct {
+	Status    int16                `json:"status"`
+	Message   string               `json:"message"`
+	Added     []string             `json:"added"`
+	Removed   []string             `json:"removed"`
+	Unchanged []string             `json:"unchanged"`
+	Failed    []subscriptionResult `json:"failed"`
+}
+
+type exportResponse struct {
 	Status  int16  `json:"status"`
 	Message string `json:"message"`
+	Topics  int    `json:"topics"`
+}
+
+type importResponse struct {
+	Status  int16                        `json:"status"`
+	Message string                       `json:"message"`
+	Feeds   map[string]reconcileResponse `json:"feeds,omitempty"`
 }
 
 type disconnectResponse struct {
@@ -0,0 +1,205 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// subscriptionFileVersion is the version of the file written by ExportSubscriptions.
+const subscriptionFileVersion = 1
+
+// subscriptionFile is the layout of the file written by ExportSubscriptions, e.g.
+//
+//	{
+//	    "version": 1,
+//	    "savedAt": "2024-10-18T10:15:00+05:30",
+//	    "feeds": {
+//	        "mw": ["nseeq/2885", "nsefo/54452"],
+//	        "marketStatus": ["nseeq"],
+//	        "order": ["93080048"]
+//	    }
+//	}
+type subscriptionFile struct {
+	Version int                 `json:"version"`
+	SavedAt time.Time           `json:"savedAt"`
+	Feeds   map[string][]string `json:"feeds"`
+}
+
+// ExportSubscriptions writes the topics subscribed through the Subscribe methods and
+// SetSubscriptions on every feed to a versioned JSON file, so that a restarted process
+// can restore them with ImportSubscriptions or the "restoreSubscriptions" connect
+// parameter. Topics held only by Subscription handles are not written: they belong to
+// the handles, which the restarted process takes again with Acquire.
+// The file is replaced atomically.
+// Parameters:
+// - path: The file to write
+// Returns:
+// - A JSON string containing the export response
+//
+// Sample response:
+//
+//	{
+//	    "Status": 0,
+//	    "Message": "Success",
+//	    "Topics": 3
+//	}
+func (c *Connect) ExportSubscriptions(path string) (string, error) {
+	var response exportResponse
+
+	c.subscriptions.changes.Lock()
+	file := subscriptionFile{Version: subscriptionFileVersion, SavedAt: time.Now(), Feeds: map[string][]string{}}
+	for _, feed := range feeds {
+		if topics := c.subscriptions.direct(feed); len(topics) != 0 {
+			file.Feeds[feed.Name()] = topics
+			response.Topics += len(topics)
+		}
+	}
+	c.subscriptions.changes.Unlock()
+
+	data, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", err
+	}
+
+	response.Message = "Success"
+	response.Status = 0
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData), nil
+}
+
+// ImportSubscriptions restores the subscriptions saved by ExportSubscriptions. Each feed
+// present in the file is reconciled as with SetSubscriptions; feeds absent from the file
+// are left unchanged. When a feed cannot be restored, e.g. because it would exceed
+// MaxSubscriptions, the other feeds are still restored and the status and message of
+// the first failed feed are reported at the top level. Topics the broker refuses are
+// listed under Failed of their feed.
+// Parameters:
+// - path: The file to read
+// Returns:
+// - A JSON string containing the per-feed reconciliation reports
+//
+// Sample response:
+//
+//	{
+//	    "Status": 0,
+//	    "Message": "Success",
+//	    "Feeds": {
+//	        "mw": {
+//	            "Status": 0,
+//	            "Message": "Success",
+//	            "Added": ["nseeq/2885"],
+//	            "Removed": null,
+//	            "Unchanged": null,
+//	            "Failed": null
+//	        }
+//	    }
+//	}
+func (c *Connect) ImportSubscriptions(path string) (string, error) {
+	response, err := c.importSubscriptions(path)
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	if response.Status == -1 {
+		return string(jsonData), err
+	}
+	return string(jsonData), nil
+}
+
+// importSubscriptions restores a subscription file. The returned error is the cause of
+// a non-zero status, so that callers can tell a missing file apart.
+func (c *Connect) importSubscriptions(path string) (importResponse, error) {
+	var response importResponse
+	if c.client == nil || c.client.IsConnected() == false {
+		response.Message = "Client not connected"
+		response.Status = 106
+		return response, fmt.Errorf("client not connected")
+	}
+
+	file, err := readSubscriptionFile(path)
+	if err != nil {
+		response.Message = err.Error()
+		response.Status = 101
+		return response, err
+	}
+
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+
+	response.Feeds = map[string]reconcileResponse{}
+	for _, feed := range feeds {
+		topics, ok := file.Feeds[feed.Name()]
+		if !ok {
+			continue
+		}
+		result, err := c.reconcile(feed, topics)
+		response.Feeds[feed.Name()] = result
+		if err != nil {
+			response.Message = err.Error()
+			response.Status = -1
+			return response, err
+		}
+		if result.Status != 0 && response.Status == 0 {
+			response.Message = feed.Name() + ": " + result.Message
+			response.Status = result.Status
+		}
+	}
+
+	if response.Status != 0 {
+		return response, nil
+	}
+	response.Message = "Success"
+	response.Status = 0
+	return response, nil
+}
+
+func readSubscriptionFile(path string) (subscriptionFile, error) {
+	var file subscriptionFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("subscription file %s: %w", path, err)
+	}
+	if file.Version != subscriptionFileVersion {
+		return file, fmt.Errorf("subscription file %s: unsupported version %d", path, file.Version)
+	}
+	for name := range file.Feeds {
+		if _, ok := FeedByName(name); !ok {
+			return file, fmt.Errorf("subscription file %s: unknown feed %q", path, name)
+		}
+	}
+	return file, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
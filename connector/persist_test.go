@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImportSubscriptions(t *testing.T) {
+	client, c := fakeConnect()
+	c.SubscribeFeed(listRequest("subscriptionList", "nseeq/2885", "nsefo/35001"))
+	c.SetSubscriptions(FeedMarketStatus, []string{"nseeq"})
+	c.SetSubscriptions(FeedOrderUpdates, []string{"AB1234"})
+	if _, _, err := c.Acquire(FeedMarketWatch, "nseeq/1594"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "subscriptions.json")
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.ExportSubscriptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := decode[exportResponse](t, res); response.Status != 0 || response.Topics != 4 {
+		t.Errorf("ExportSubscriptions: %s, want 4 topics", res)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file subscriptionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"mw":           {"nseeq/2885", "nsefo/35001"},
+		"marketStatus": {"nseeq"},
+		"order":        {"AB1234"},
+	}
+	if file.Version != 1 || file.SavedAt.IsZero() || !reflect.DeepEqual(file.Feeds, want) {
+		t.Errorf("file %+v, want version 1 with feeds %v", file, want)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files in the directory, want the temporary file renamed", len(entries))
+	}
+
+	restored, r := fakeConnect()
+	r.SubscribeFeed(listRequest("subscriptionList", "nseeq/1"))
+	res, err = r.ImportSubscriptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := decode[importResponse](t, res)
+	if response.Status != 0 || len(response.Feeds) != 3 {
+		t.Fatalf("ImportSubscriptions: %s", res)
+	}
+	if mw := response.Feeds["mw"]; !reflect.DeepEqual(mw.Removed, []string{"nseeq/1"}) || len(mw.Added) != 2 {
+		t.Errorf("mw reconciled as %+v", mw)
+	}
+	for feed, topics := range want {
+		feed, _ := FeedByName(feed)
+		if got := restored.subscriptions(feed); !reflect.DeepEqual(got, topics) {
+			t.Errorf("%s restored %v, want %v", feed.Name(), got, topics)
+		}
+	}
+	if got := client.subscriptions(FeedMarketWatch); len(got) != 3 {
+		t.Errorf("exporting changed the subscriptions to %v", got)
+	}
+}
+
+func TestImportSubscriptionsStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	data := `{"version": 1, "feeds": {"mw": ["nseeq/1", "nseeq/2", "nseeq/3"], "index": ["nseeq/999920000"]}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, c := fakeConnect()
+	c.MaxSubscriptions = 2
+	res, err := c.ImportSubscriptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := decode[importResponse](t, res)
+	if response.Status != 108 || !strings.HasPrefix(response.Message, "mw: Subscription limit exceeded") {
+		t.Errorf("status %d %q, want the limit of the mw feed reported", response.Status, response.Message)
+	}
+	if got := client.subscriptions(FeedIndex); !reflect.DeepEqual(got, []string{"nseeq/999920000"}) {
+		t.Errorf("index restored %v, want the feed within the limit restored", got)
+	}
+}
+
+func TestImportSubscriptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"missing", "", "no such file"},
+		{"invalid", "{", "unexpected end of JSON input"},
+		{"version", `{"version": 2, "feeds": {}}`, "unsupported version 2"},
+		{"feed", `{"version": 1, "feeds": {"ticks": ["nseeq/1"]}}`, `unknown feed "ticks"`},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "subscriptions.json")
+		if test.content != "" {
+			if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, c := fakeConnect()
+		res, err := c.ImportSubscriptions(path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if response := decode[importResponse](t, res); response.Status != 101 || !strings.Contains(response.Message, test.err) {
+			t.Errorf("%s: status %d %q, want 101 with %q", test.name, response.Status, response.Message, test.err)
+		}
+	}
+
+	var c Connect
+	if res, _ := c.ImportSubscriptions("subscriptions.json"); decode[importResponse](t, res).Status != 106 {
+		t.Errorf("importing while not connected: %s, want status 106", res)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "subscriptions.json"), []byte("{}")); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+	path := filepath.Join(dir, "subscriptions.json")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != content {
+			t.Errorf("file holds %q, want %q", data, content)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files in the directory, want no temporary files left", len(entries))
+	}
+}
@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// SetSubscriptions makes the topics subscribed on the feed through the Subscribe methods
+// equal to the desired list. Only the difference against the current subscriptions is
+// sent to the broker, in batches of at most 1024 topics. Topics held by Subscription
+// handles are left alone: they are not subscribed again when desired, and stay on the
+// broker when removed from the desired list. Topics that fail to unsubscribe are
+// reported in Failed and stay subscribed, so that the next call retries them.
+// Parameters:
+// - feed: The feed to reconcile, e.g. FeedMarketWatch
+// - desired: The topics that should be subscribed, e.g. "nseeq/2885"
+// Returns:
+// - A JSON string containing the report of added, removed, unchanged and failed topics
+//
+// Sample response:
+//
+//	{
+//	    "Status": 0,
+//	    "Message": "Success",
+//	    "Added": ["nseeq/11536"],
+//	    "Removed": ["nseeq/1594"],
+//	    "Unchanged": ["nseeq/2885"],
+//	    "Failed": [
+//	        {
+//	            "ResultCode": 104,
+//	            "Result": "Invalid Topic: unknown segment \"nsee\"",
+//	            "Topic": "nsee/2886"
+//	        }
+//	    ]
+//	}
+func (c *Connect) SetSubscriptions(feed Feed, desired []string) (string, error) {
+	var response reconcileResponse
+	if c.client == nil || c.client.IsConnected() == false {
+		response.Message = "Client not connected"
+		response.Status = 106
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonData), nil
+	}
+
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+
+	response, err := c.reconcile(feed, desired)
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	return string(jsonData), err
+}
+
+// reconcile computes and applies the difference between the direct subscriptions of
+// the feed and the desired topics. The caller must hold the registry changes lock.
+func (c *Connect) reconcile(feed Feed, desired []string) (reconcileResponse, error) {
+	var response reconcileResponse
+
+	wanted := map[string]bool{}
+	for _, value := range desired {
+		topic, err := ParseTopic(feed, value)
+		if err != nil {
+			response.Failed = append(response.Failed, subscriptionResult{ResultCode: 104, Result: "Invalid Topic: " + err.Error(), Topic: value})
+			continue
+		}
+		wanted[topic.String()] = true
+	}
+
+	current := map[string]bool{}
+	var stale []string
+	for _, topic := range c.subscriptions.direct(feed) {
+		current[topic] = true
+		if wanted[topic] {
+			response.Unchanged = append(response.Unchanged, topic)
+		} else {
+			stale = append(stale, topic)
+		}
+	}
+
+	var held, pending []string
+	for topic := range wanted {
+		if current[topic] {
+			continue
+		}
+		if c.subscriptions.has(feed, topic) {
+			held = append(held, topic)
+		} else {
+			pending = append(pending, topic)
+		}
+	}
+	sort.Strings(held)
+	sort.Strings(pending)
+
+	// Stale topics are unsubscribed first so that replacing a watchlist does not
+	// transiently exceed the session limit.
+	var unused []string
+	for _, topic := range stale {
+		if c.subscriptions.dropDirect(feed, topic) == 0 {
+			unused = append(unused, topic)
+		} else {
+			response.Removed = append(response.Removed, topic)
+		}
+	}
+	if len(unused) != 0 {
+		unsubscribed, err := c.sendUnsubscribe(unused, feed, unsubscribeResponse{})
+		for _, result := range unsubscribed.UnsubscriptionResult {
+			if result.ResultCode == 0 {
+				response.Removed = append(response.Removed, result.Topic)
+			} else {
+				response.Failed = append(response.Failed, result)
+			}
+		}
+		sort.Strings(response.Removed)
+		// Topics that failed to unsubscribe stay direct, so that the next call retries them.
+		c.subscriptions.restore(feed, false, failedTopics(unsubscribed.UnsubscriptionResult)...)
+		if err != nil {
+			response.Status = -1
+			response.Message = err.Error()
+			return response, err
+		}
+	}
+
+	if len(pending) != 0 {
+		subscribed, err := c.subscribeTopics(pending, feed, false, subscribeResponse{})
+		if subscribed.Status != 0 && subscribed.Status != -1 {
+			response.Status = subscribed.Status
+			response.Message = subscribed.Message
+			return response, nil
+		}
+		for _, result := range subscribed.SubscriptionResult {
+			if result.ResultCode >= 0 && result.ResultCode < 0x80 {
+				response.Added = append(response.Added, result.Topic)
+			} else {
+				response.Failed = append(response.Failed, result)
+			}
+		}
+		if err != nil {
+			response.Status = -1
+			response.Message = err.Error()
+			return response, err
+		}
+	}
+	c.subscriptions.add(feed, false, held...)
+	response.Added = append(response.Added, held...)
+	sort.Strings(response.Added)
+
+	response.Message = "Success"
+	response.Status = 0
+	return response, nil
+}
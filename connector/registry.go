@@ -0,0 +1,194 @@
+package connector
+
+import (
+	"sort"
+	"sync"
+)
+
+// maxTopicsPerPacket is the largest number of topics the bridge accepts in a single
+// SUBSCRIBE or UNSUBSCRIBE packet.
+const maxTopicsPerPacket = 1024
+
+// registry tracks the topics subscribed on the broker during the current session,
+// keyed by the full MQTT topic.
+type registry struct {
+	// changes serialises subscription changes, and is held across the broker round trip
+	// so that a topic released by one caller is never unsubscribed after another caller
+	// has acquired it.
+	changes sync.Mutex
+
+	mu         sync.Mutex
+	generation uint64
+	topics     map[string]*subscriptionEntry
+}
+
+// subscriptionEntry records who holds a subscribed topic.
+type subscriptionEntry struct {
+	feed Feed
+	// refs is the number of Subscription handles holding the topic.
+	refs int
+	// direct is set when the topic was subscribed through the Subscribe methods.
+	direct bool
+}
+
+// add records topics subscribed on the broker, either directly or for a handle.
+func (r *registry) add(feed Feed, held bool, topics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.topics == nil {
+		r.topics = map[string]*subscriptionEntry{}
+	}
+	for _, topic := range topics {
+		entry, ok := r.topics[string(feed)+topic]
+		if !ok {
+			entry = &subscriptionEntry{feed: feed}
+			r.topics[string(feed)+topic] = entry
+		}
+		if held {
+			entry.refs++
+		} else {
+			entry.direct = true
+		}
+	}
+}
+
+// retain adds a handle reference to topics that are already subscribed.
+func (r *registry) retain(feed Feed, topics ...string) {
+	r.add(feed, true, topics...)
+}
+
+// dropDirect clears the direct flag of the topic and returns the number of handles
+// still holding it.
+func (r *registry) dropDirect(feed Feed, topic string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.topics[string(feed)+topic]
+	if !ok {
+		return 0
+	}
+	entry.direct = false
+	return entry.refs
+}
+
+// release drops a handle reference from each topic of the given generation and returns
+// the topics that are no longer held by anyone.
+func (r *registry) release(feed Feed, generation uint64, topics ...string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if generation != r.generation {
+		return nil
+	}
+	var unused []string
+	for _, topic := range topics {
+		entry, ok := r.topics[string(feed)+topic]
+		if !ok {
+			continue
+		}
+		if entry.refs > 0 {
+			entry.refs--
+		}
+		if entry.refs == 0 && !entry.direct {
+			unused = append(unused, topic)
+		}
+	}
+	return unused
+}
+
+// restore gives topics whose UNSUBSCRIBE failed back the handle reference or direct
+// flag they were dropped from, so that a later call retries them. Topics forgotten
+// since, e.g. because the session ended, are left alone.
+func (r *registry) restore(feed Feed, held bool, topics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, topic := range topics {
+		entry, ok := r.topics[string(feed)+topic]
+		if !ok {
+			continue
+		}
+		if held {
+			entry.refs++
+		} else {
+			entry.direct = true
+		}
+	}
+}
+
+func (r *registry) remove(feed Feed, topics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, topic := range topics {
+		entry, ok := r.topics[string(feed)+topic]
+		if ok && entry.refs == 0 && !entry.direct {
+			delete(r.topics, string(feed)+topic)
+		}
+	}
+}
+
+func (r *registry) has(feed Feed, topic string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.topics[string(feed)+topic]
+	return ok
+}
+
+func (r *registry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.topics)
+}
+
+func (r *registry) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.generation
+}
+
+// list returns the subscribed topics of the feed, sorted.
+func (r *registry) list(feed Feed) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var topics []string
+	for key, value := range r.topics {
+		if value.feed == feed {
+			topics = append(topics, key[len(feed):])
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// direct returns the topics of the feed subscribed through the Subscribe methods, sorted.
+func (r *registry) direct(feed Feed) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var topics []string
+	for key, value := range r.topics {
+		if value.feed == feed && value.direct {
+			topics = append(topics, key[len(feed):])
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// reset forgets every topic when the session ends. Handles taken before the reset
+// become inactive.
+func (r *registry) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics = nil
+	r.generation++
+}
+
+// batches splits topics into chunks that fit in a single SUBSCRIBE or UNSUBSCRIBE packet.
+func batches(topics []string) [][]string {
+	var result [][]string
+	for len(topics) > maxTopicsPerPacket {
+		result = append(result, topics[:maxTopicsPerPacket])
+		topics = topics[maxTopicsPerPacket:]
+	}
+	if len(topics) > 0 {
+		result = append(result, topics)
+	}
+	return result
+}
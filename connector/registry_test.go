@@ -0,0 +1,60 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBatches(t *testing.T) {
+	tests := []struct {
+		topics int
+		sizes  []int
+	}{
+		{topics: 0, sizes: nil},
+		{topics: 1, sizes: []int{1}},
+		{topics: 1024, sizes: []int{1024}},
+		{topics: 1025, sizes: []int{1024, 1}},
+		{topics: 3072, sizes: []int{1024, 1024, 1024}},
+	}
+	for _, test := range tests {
+		var sizes []int
+		for _, batch := range batches(topicList(test.topics)) {
+			sizes = append(sizes, len(batch))
+		}
+		if !reflect.DeepEqual(sizes, test.sizes) {
+			t.Errorf("batches of %d topics: %v, want %v", test.topics, sizes, test.sizes)
+		}
+	}
+}
+
+func TestRegistryReferences(t *testing.T) {
+	var r registry
+	r.add(FeedMarketWatch, false, "nseeq/1", "nseeq/2")
+	r.retain(FeedMarketWatch, "nseeq/2")
+	r.add(FeedMarketWatch, true, "nseeq/3")
+	generation := r.currentGeneration()
+
+	if unused := r.release(FeedMarketWatch, generation, "nseeq/2", "nseeq/3"); !reflect.DeepEqual(unused, []string{"nseeq/3"}) {
+		t.Errorf("release left %v unused, want nseeq/3", unused)
+	}
+	r.restore(FeedMarketWatch, true, "nseeq/3")
+	if unused := r.release(FeedMarketWatch, generation, "nseeq/3"); !reflect.DeepEqual(unused, []string{"nseeq/3"}) {
+		t.Errorf("release after restore left %v unused, want nseeq/3", unused)
+	}
+	r.remove(FeedMarketWatch, "nseeq/1", "nseeq/3")
+	if got := r.list(FeedMarketWatch); !reflect.DeepEqual(got, []string{"nseeq/1", "nseeq/2"}) {
+		t.Errorf("topics %v, want the direct topics kept", got)
+	}
+	if refs := r.dropDirect(FeedMarketWatch, "nseeq/1"); refs != 0 {
+		t.Errorf("nseeq/1 held by %d handles, want 0", refs)
+	}
+
+	r.reset()
+	r.restore(FeedMarketWatch, true, "nseeq/2")
+	if unused := r.release(FeedMarketWatch, generation, "nseeq/2"); unused != nil {
+		t.Errorf("release of a previous session returned %v", unused)
+	}
+	if r.count() != 0 {
+		t.Errorf("registry has %d topics after reset", r.count())
+	}
+}
@@ -0,0 +1,202 @@
+package connector
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Subscription is a reference-counted hold on topics of a feed, returned by Acquire.
+// Several Subscriptions may hold the same topic; the broker level UNSUBSCRIBE is only
+// sent once the last of them is released and the topic is not also subscribed through
+// the Subscribe methods.
+type Subscription struct {
+	c          *Connect
+	feed       Feed
+	topics     []string
+	generation uint64
+
+	mu       sync.Mutex
+	released bool
+}
+
+// Feed returns the feed of the subscription.
+func (s *Subscription) Feed() Feed {
+	return s.feed
+}
+
+// Topics returns the topics held by the subscription.
+func (s *Subscription) Topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.topics...)
+}
+
+// Active reports whether the subscription still holds its topics on the broker. It is
+// false once released, and for handles taken before the session ended, e.g. when the
+// connection was lost: their topics must be acquired again after reconnecting.
+func (s *Subscription) Active() bool {
+	s.mu.Lock()
+	released := s.released
+	s.mu.Unlock()
+	return !released && s.generation == s.c.subscriptions.currentGeneration()
+}
+
+// Acquire takes a reference on topics of the feed and returns a handle to release them.
+// Topics that are not yet subscribed are subscribed on the broker; topics that already
+// are only gain a reference. Topics that are invalid or fail to subscribe are reported
+// in the response and are not held by the returned Subscription.
+// Parameters:
+// - feed: The feed to subscribe, e.g. FeedMarketWatch
+// - topics: The topics to hold, e.g. "nseeq/2885"
+// Returns:
+// - The Subscription handle, or nil when the client is not connected
+// - A JSON string containing the subscription response
+//
+// Sample response:
+//
+//	{
+//	    "Message": "Success",
+//	    "Status": 0,
+//	    "SubscriptionResult": [
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
+//	}
+func (c *Connect) Acquire(feed Feed, topics ...string) (*Subscription, string, error) {
+	var response subscribeResponse
+	if c.client == nil || c.client.IsConnected() == false {
+		response.Message = "Client not connected"
+		response.Status = 106
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, string(jsonData), nil
+	}
+
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+
+	subscription := &Subscription{c: c, feed: feed, generation: c.subscriptions.currentGeneration()}
+	var pending []string
+	seen := map[string]bool{}
+	for _, value := range topics {
+		topic, err := ParseTopic(feed, value)
+		if err != nil {
+			response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: 104, Result: "Invalid Topic: " + err.Error(), Topic: value})
+			continue
+		}
+		if seen[topic.String()] {
+			continue
+		}
+		seen[topic.String()] = true
+		if c.subscriptions.has(feed, topic.String()) {
+			c.subscriptions.retain(feed, topic.String())
+			subscription.topics = append(subscription.topics, topic.String())
+			response.SubscriptionResult = append(response.SubscriptionResult, subscriptionResult{ResultCode: 0, Result: subackReturnCodes[0], Topic: topic.String()})
+			continue
+		}
+		pending = append(pending, topic.String())
+	}
+
+	var err error
+	if len(pending) != 0 {
+		held := len(response.SubscriptionResult)
+		response, err = c.subscribeTopics(pending, feed, true, response)
+		for _, result := range response.SubscriptionResult[held:] {
+			if result.ResultCode >= 0 && result.ResultCode < 0x80 {
+				subscription.topics = append(subscription.topics, result.Topic)
+			}
+		}
+	} else if len(subscription.topics) != 0 {
+		response.Message = "Success"
+		response.Status = 0
+	} else {
+		response.Message = "Subscription Failed"
+		response.Status = 103
+	}
+
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return subscription, "", jsonErr
+	}
+	return subscription, string(jsonData), err
+}
+
+// Release drops the references of the subscription. Topics that are no longer held
+// by any Subscription, nor subscribed through the Subscribe methods, are unsubscribed
+// on the broker. Releasing twice, or after the session ended, sends nothing. When the
+// UNSUBSCRIBE fails, the subscription keeps holding the failed topics and Release may
+// be called again to retry them.
+// Returns:
+// - A JSON string containing the unsubscription response
+//
+// Sample response:
+//
+//	{
+//	    "Message": "Unsubscribed Successfully",
+//	    "Status": 0,
+//	    "UnsubscriptionResult": [
+//	        {
+//	            "ResultCode": 0,
+//	            "Result": "Success",
+//	            "Topic": "nseeq/2885"
+//	        }
+//	    ]
+//	}
+func (s *Subscription) Release() (string, error) {
+	var response unsubscribeResponse
+
+	s.mu.Lock()
+	released := s.released
+	s.released = true
+	s.mu.Unlock()
+
+	if released {
+		response.Message = "Subscription already released"
+		response.Status = 0
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonData), nil
+	}
+
+	c := s.c
+	c.subscriptions.changes.Lock()
+	defer c.subscriptions.changes.Unlock()
+
+	s.mu.Lock()
+	topics := s.topics
+	s.mu.Unlock()
+	unused := c.subscriptions.release(s.feed, s.generation, topics...)
+	if len(unused) == 0 || c.client == nil || c.client.IsConnected() == false {
+		c.subscriptions.remove(s.feed, unused...)
+		response.Message = "Released Successfully"
+		response.Status = 0
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonData), nil
+	}
+
+	response, err := c.sendUnsubscribe(unused, s.feed, response)
+	if failed := failedTopics(response.UnsubscriptionResult); len(failed) != 0 {
+		// Keep holding the topics the broker did not unsubscribe, so that Release can be
+		// called again to retry them.
+		c.subscriptions.restore(s.feed, true, failed...)
+		s.mu.Lock()
+		s.topics = failed
+		s.released = false
+		s.mu.Unlock()
+	}
+	jsonData, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	return string(jsonData), err
+}
@@ -0,0 +1,128 @@
+package connector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	instrumentTopicPattern = regexp.MustCompile(`^([A-Za-z]+)/([^/]*)$`)
+	segmentTopicPattern    = regexp.MustCompile(`^[A-Za-z]+$`)
+	accountTopicPattern    = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	numericPattern         = regexp.MustCompile(`^[0-9]+$`)
+	feedSeparator          = regexp.MustCompile("(v1/)")
+)
+
+// knownSegments is the set of exchange segments published by the bridge.
+var knownSegments = func() map[string]bool {
+	set := make(map[string]bool, len(exchangeSegments))
+	for _, segment := range exchangeSegments {
+		set[segment] = true
+	}
+	return set
+}()
+
+// Topic is a parsed bridge topic, i.e. the part of the MQTT topic that follows the feed prefix.
+type Topic struct {
+	// Segment is the exchange segment, e.g. "nseeq". Empty for order and trade topics.
+	Segment string
+	// InstrumentId is the instrument of the topic, or 0 for segment wide topics.
+	InstrumentId uint32
+	// Account is the client code of order and trade update topics.
+	Account string
+}
+
+// String returns the canonical form of the topic, e.g. "nseeq/2885".
+func (t Topic) String() string {
+	if t.Account != "" {
+		return t.Account
+	}
+	if t.InstrumentId == 0 {
+		return t.Segment
+	}
+	return t.Segment + "/" + strconv.FormatUint(uint64(t.InstrumentId), 10)
+}
+
+// InstrumentTopic returns the topic of an instrument on the segment of a feed topic,
+// which is either a segment, e.g. "nseeq", or an instrument topic, e.g. "nseeq/2885".
+// The circuit and 52 week feeds carry their InstrumentId in the payload, so that a
+// message received on a segment topic is placed with InstrumentTopic(topic, data.InstrumentId).
+func InstrumentTopic(topic string, instrumentId uint32) string {
+	segment, _, _ := strings.Cut(topic, "/")
+	return Topic{Segment: segment, InstrumentId: instrumentId}.String()
+}
+
+// ParseTopic validates a topic for the given feed and returns it parsed.
+//   - MarketWatch, Index, OpenInterest and Lpp topics are "segment/instrumentId".
+//   - MarketStatus topics are a segment, e.g. "nseeq".
+//   - High52Week, Low52Week, UpperCircuit and LowerCircuit topics are either a
+//     segment or "segment/instrumentId".
+//   - OrderUpdates and TradeUpdates topics are the alphanumeric client code.
+//
+// The segment must be one of the known exchange segments and is matched case-insensitively.
+func ParseTopic(feed Feed, topic string) (Topic, error) {
+	switch feed {
+	case FeedOrderUpdates, FeedTradeUpdates:
+		if !accountTopicPattern.MatchString(topic) {
+			return Topic{}, fmt.Errorf("topic %q should be an alphanumeric client code", topic)
+		}
+		return Topic{Account: topic}, nil
+
+	case FeedMarketStatus:
+		if !segmentTopicPattern.MatchString(topic) {
+			return Topic{}, fmt.Errorf("topic %q should be an exchange segment", topic)
+		}
+		return parseSegment(topic)
+
+	case FeedHigh52Week, FeedLow52Week, FeedUpperCircuit, FeedLowerCircuit:
+		if segmentTopicPattern.MatchString(topic) {
+			return parseSegment(topic)
+		}
+		return parseInstrumentTopic(topic)
+
+	case FeedMarketWatch, FeedIndex, FeedOpenInterest, FeedLpp:
+		return parseInstrumentTopic(topic)
+	}
+	return Topic{}, fmt.Errorf("unknown feed %q", feed)
+}
+
+func parseSegment(segment string) (Topic, error) {
+	segment = strings.ToLower(segment)
+	if !knownSegments[segment] {
+		return Topic{}, fmt.Errorf("unknown segment %q", segment)
+	}
+	return Topic{Segment: segment}, nil
+}
+
+func parseInstrumentTopic(topic string) (Topic, error) {
+	match := instrumentTopicPattern.FindStringSubmatch(topic)
+	if match == nil {
+		return Topic{}, fmt.Errorf("topic %q should be of the form segment/instrumentId", topic)
+	}
+	parsed, err := parseSegment(match[1])
+	if err != nil {
+		return Topic{}, err
+	}
+	if !numericPattern.MatchString(match[2]) {
+		return Topic{}, fmt.Errorf("instrument id %q should be numeric", match[2])
+	}
+	id, err := strconv.ParseUint(match[2], 10, 32)
+	if err != nil || id == 0 {
+		return Topic{}, fmt.Errorf("instrument id %q is out of range", match[2])
+	}
+	parsed.InstrumentId = uint32(id)
+	return parsed, nil
+}
+
+// SplitTopic splits a full MQTT topic into its feed and bridge topic, e.g.
+// "prod/marketfeed/mw/v1/nseeq/2885" into FeedMarketWatch and "nseeq/2885".
+// A topic without a feed prefix is returned whole with an empty feed.
+func SplitTopic(topic string) (Feed, string) {
+	parts := feedSeparator.Split(topic, 2)
+	if len(parts) != 2 {
+		return "", topic
+	}
+	return Feed(parts[0] + "v1/"), parts[1]
+}
@@ -0,0 +1,95 @@
+package connector
+
+import (
+	"testing"
+)
+
+func TestParseTopic(t *testing.T) {
+	tests := []struct {
+		feed  Feed
+		topic string
+		want  Topic
+		valid bool
+	}{
+		{FeedMarketWatch, "nseeq/2885", Topic{Segment: "nseeq", InstrumentId: 2885}, true},
+		{FeedMarketWatch, "NSEFO/35001", Topic{Segment: "nsefo", InstrumentId: 35001}, true},
+		{FeedIndex, "nseeq/999920000", Topic{Segment: "nseeq", InstrumentId: 999920000}, true},
+		{FeedOpenInterest, "mcxcomm/1", Topic{Segment: "mcxcomm", InstrumentId: 1}, true},
+		{FeedLpp, "bsefo/1", Topic{Segment: "bsefo", InstrumentId: 1}, true},
+		{FeedMarketWatch, "nsee/2886", Topic{}, false},
+		{FeedMarketWatch, "nseeq", Topic{}, false},
+		{FeedMarketWatch, "nseeq/", Topic{}, false},
+		{FeedMarketWatch, "nseeq/0", Topic{}, false},
+		{FeedMarketWatch, "nseeq/28a5", Topic{}, false},
+		{FeedMarketWatch, "nseeq/-1", Topic{}, false},
+		{FeedMarketWatch, "nseeq/4294967296", Topic{}, false},
+		{FeedMarketWatch, "nseeq/2885/1", Topic{}, false},
+		{FeedLpp, "nseeq", Topic{}, false},
+
+		{FeedMarketStatus, "nseeq", Topic{Segment: "nseeq"}, true},
+		{FeedMarketStatus, "BSEEQ", Topic{Segment: "bseeq"}, true},
+		{FeedMarketStatus, "nseeq/2885", Topic{}, false},
+		{FeedMarketStatus, "nse", Topic{}, false},
+
+		{FeedHigh52Week, "nseeq", Topic{Segment: "nseeq"}, true},
+		{FeedLow52Week, "nseeq/2885", Topic{Segment: "nseeq", InstrumentId: 2885}, true},
+		{FeedUpperCircuit, "nsefo", Topic{Segment: "nsefo"}, true},
+		{FeedLowerCircuit, "nsefo/35001", Topic{Segment: "nsefo", InstrumentId: 35001}, true},
+		{FeedUpperCircuit, "nsfo", Topic{}, false},
+		{FeedLowerCircuit, "nsefo/x", Topic{}, false},
+
+		{FeedOrderUpdates, "AB1234", Topic{Account: "AB1234"}, true},
+		{FeedTradeUpdates, "93080048", Topic{Account: "93080048"}, true},
+		{FeedOrderUpdates, "AB-1234", Topic{}, false},
+		{FeedTradeUpdates, "", Topic{}, false},
+
+		{Feed("prod/marketfeed/unknown/v1/"), "nseeq/2885", Topic{}, false},
+	}
+	for _, test := range tests {
+		got, err := ParseTopic(test.feed, test.topic)
+		if (err == nil) != test.valid || got != test.want {
+			t.Errorf("ParseTopic(%s, %q) = %+v, %v; want %+v, valid %v", test.feed, test.topic, got, err, test.want, test.valid)
+		}
+		if err == nil {
+			if again, err := ParseTopic(test.feed, got.String()); err != nil || again != got {
+				t.Errorf("ParseTopic(%s, %q) of the canonical form = %+v, %v", test.feed, got.String(), again, err)
+			}
+		}
+	}
+}
+
+func TestSplitTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		feed  Feed
+		rest  string
+	}{
+		{"prod/marketfeed/mw/v1/nseeq/2885", FeedMarketWatch, "nseeq/2885"},
+		{"prod/marketfeed/marketStatus/v1/nseeq", FeedMarketStatus, "nseeq"},
+		{"prod/updates/order/v1/AB1234", FeedOrderUpdates, "AB1234"},
+		{"nseeq/2885", "", "nseeq/2885"},
+	}
+	for _, test := range tests {
+		if feed, rest := SplitTopic(test.topic); feed != test.feed || rest != test.rest {
+			t.Errorf("SplitTopic(%q) = %q, %q; want %q, %q", test.topic, feed, rest, test.feed, test.rest)
+		}
+	}
+}
+
+func TestInstrumentTopic(t *testing.T) {
+	tests := []struct {
+		topic        string
+		instrumentId uint32
+		want         string
+	}{
+		{"nseeq", 2885, "nseeq/2885"},
+		{"nseeq/2885", 2885, "nseeq/2885"},
+		{"bsefo/0", 1594, "bsefo/1594"},
+		{"nseeq", 0, "nseeq"},
+	}
+	for _, test := range tests {
+		if got := InstrumentTopic(test.topic, test.instrumentId); got != test.want {
+			t.Errorf("InstrumentTopic(%q, %d) = %q, want %q", test.topic, test.instrumentId, got, test.want)
+		}
+	}
+}
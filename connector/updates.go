@@ -0,0 +1,90 @@
+package connector
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Transaction types of order and trade updates.
+const (
+	TransactionBuy  = "BUY"
+	TransactionSell = "SELL"
+)
+
+// TradeUpdate is a fill published as JSON on the prod/updates/trade/v1/ feed.
+type TradeUpdate struct {
+	// Exchange is the segment of the instrument, e.g. "NSEEQ".
+	Exchange        string `json:"exchange"`
+	InstrumentId    uint32 `json:"instrumentId"`
+	TradingSymbol   string `json:"tradingSymbol"`
+	ExchangeOrderId string `json:"exchangeOrderId"`
+	BrokerOrderId   string `json:"brokerOrderId"`
+	ExchangeTradeId string `json:"exchangeTradeId"`
+	// TransactionType is TransactionBuy or TransactionSell.
+	TransactionType string `json:"transactionType"`
+	// Product is the product of the order, e.g. "INTRADAY" or "DELIVERY".
+	Product        string    `json:"product"`
+	TradedQuantity int64     `json:"tradedQuantity"`
+	TradedPrice    float64   `json:"tradedPrice"`
+	ExchangeTime   time.Time `json:"exchangeTime"`
+}
+
+// DecodeTradeUpdate decodes a Trade Updates payload.
+func DecodeTradeUpdate(payload []byte) (TradeUpdate, error) {
+	var update TradeUpdate
+	err := json.Unmarshal(payload, &update)
+	return update, err
+}
+
+// Topic returns the market feed topic of the instrument, e.g. "nseeq/2885".
+func (t *TradeUpdate) Topic() string {
+	return Topic{Segment: strings.ToLower(t.Exchange), InstrumentId: t.InstrumentId}.String()
+}
+
+// SignedQuantity returns TradedQuantity, negated for a sell.
+func (t *TradeUpdate) SignedQuantity() int64 {
+	if strings.EqualFold(t.TransactionType, TransactionSell) {
+		return -t.TradedQuantity
+	}
+	return t.TradedQuantity
+}
+
+// OrderUpdate is a change of an order published as JSON on the prod/updates/order/v1/
+// feed.
+type OrderUpdate struct {
+	// Exchange is the segment of the instrument, e.g. "NSEEQ".
+	Exchange        string `json:"exchange"`
+	InstrumentId    uint32 `json:"instrumentId"`
+	TradingSymbol   string `json:"tradingSymbol"`
+	ExchangeOrderId string `json:"exchangeOrderId"`
+	BrokerOrderId   string `json:"brokerOrderId"`
+	// OrderStatus is the status of the order, e.g. "OPEN", "PARTIALLY FILLED" or
+	// "CANCELLED".
+	OrderStatus     string `json:"orderStatus"`
+	TransactionType string `json:"transactionType"`
+	Product         string `json:"product"`
+	OrderType       string `json:"orderType"`
+	OrderQuantity   int64  `json:"orderQuantity"`
+	// FilledQuantity is the cumulative quantity filled, and PendingQuantity the quantity
+	// still open.
+	FilledQuantity     int64     `json:"filledQuantity"`
+	PendingQuantity    int64     `json:"pendingQuantity"`
+	OrderPrice         float64   `json:"orderPrice"`
+	TriggerPrice       float64   `json:"triggerPrice"`
+	AverageTradedPrice float64   `json:"averageTradedPrice"`
+	RejectionReason    string    `json:"rejectionReason"`
+	ExchangeTime       time.Time `json:"exchangeTime"`
+}
+
+// DecodeOrderUpdate decodes an Order Updates payload.
+func DecodeOrderUpdate(payload []byte) (OrderUpdate, error) {
+	var update OrderUpdate
+	err := json.Unmarshal(payload, &update)
+	return update, err
+}
+
+// Topic returns the market feed topic of the instrument, e.g. "nseeq/2885".
+func (o *OrderUpdate) Topic() string {
+	return Topic{Segment: strings.ToLower(o.Exchange), InstrumentId: o.InstrumentId}.String()
+}
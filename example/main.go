@@ -50,6 +50,17 @@ type Depth struct {
 	TransactionType int16  `json:"transactionType"`
 }
 
+type IndexTick struct {
+	Value        int32 `json:"value"`
+	Open         int32 `json:"open"`
+	High         int32 `json:"high"`
+	Low          int32 `json:"low"`
+	Close        int32 `json:"close"`
+	Change       int32 `json:"change"`
+	PriceDivisor int32 `json:"priceDivisor"`
+	Timestamp    int32 `json:"timestamp"`
+}
+
 type OpenInterestData struct {
 	OpenInterest int32 `json:"openInterest"`
 	DayHighOi    int32 `json:"dayHighOi"`
@@ -114,7 +125,17 @@ func main() {
 	}
 
 	connector.IndexHandler = func(b []byte, s string) {
-		fmt.Println("IndexHandler", s, string(b))
+		buffer := bytes.NewBuffer(b)
+
+		// Create an instance of IndexTick
+		var data IndexTick
+		// Decode the byte array into the struct
+		err := binary.Read(buffer, binary.LittleEndian, &data)
+		if err != nil {
+			fmt.Println("binary.Read failed:", err)
+			return
+		}
+		fmt.Printf("Index Data of "+s+" : %+v\n", data)
 	}
 
 	//Low52WeekHandler
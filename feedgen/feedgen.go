@@ -0,0 +1,394 @@
+// Package feedgen generates synthetic but well-formed bridge payloads for strategy
+// development and load tests when the live bridge is not available.
+//
+// Prices follow a random walk that respects the tick size, price divisor and circuit
+// band of each instrument. The generated messages can be delivered straight to the
+// handlers of a connector.Connect with DispatchTo, or published into a broker, e.g.
+// the fake one of the bridgetest package, with PublishTo:
+//
+//	gen, err := feedgen.New(feedgen.Config{
+//		Instruments: []feedgen.Instrument{{Topic: "nseeq/2885", Price: 2950}},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	err = gen.Run(ctx, time.Second, feedgen.DispatchTo(connector.GetInstance()))
+package feedgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Instrument describes one instrument of the generated universe.
+type Instrument struct {
+	// Topic is the bridge topic of the instrument, e.g. "nseeq/2885".
+	Topic string
+	// Price is the previous close in rupees, from which the walk starts.
+	Price float64
+	// TickSize is the minimum price step in rupees. Defaults to 0.05.
+	TickSize float64
+	// PriceDivisor is the divisor of the raw prices. Defaults to 100.
+	PriceDivisor int32
+	// LotSize is the quantity step of trades and depth. Defaults to 1.
+	LotSize uint32
+	// Volatility is the standard deviation of the log return of one step. Defaults to 0.0005.
+	Volatility float64
+	// OpenInterest is the previous day open interest. A non-zero value makes the
+	// generator publish the Open Interest feed for the instrument.
+	OpenInterest int32
+}
+
+// Config configures a Generator.
+type Config struct {
+	Instruments []Instrument
+	// Seed seeds the random walk, so that equal configurations generate equal data.
+	Seed int64
+	// Start is the simulated time of the first tick. Defaults to the current time.
+	Start time.Time
+	// Step is the simulated time between two ticks. Defaults to one second.
+	Step time.Duration
+	// CircuitPercent is the width of the circuit band around the previous close. Defaults to 10.
+	CircuitPercent float64
+	// LppPercent is the width of the LPP band around the previous close. Defaults to 5.
+	LppPercent float64
+	// QuoteOnlyProbability is the probability that a tick only moves the quotes
+	// without a trade.
+	QuoteOnlyProbability float64
+	// MarketStatusCode is published on the Market Status feed of every segment of
+	// the universe. Defaults to 2.
+	MarketStatusCode uint16
+}
+
+// Message is one generated payload and its full MQTT topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Time is the simulated time of the message.
+	Time time.Time
+}
+
+// Sink receives generated messages by full MQTT topic.
+type Sink func(topic string, payload []byte)
+
+// DispatchTo returns a Sink that delivers messages to the handlers of the connector.
+func DispatchTo(c *connector.Connect) Sink {
+	return c.Dispatch
+}
+
+// Publisher publishes a payload on a full MQTT topic and returns the number of
+// clients it was delivered to. *bridgetest.Server is a Publisher.
+type Publisher interface {
+	Publish(topic string, payload []byte) int
+}
+
+// PublishTo returns a Sink that publishes messages with the publisher.
+func PublishTo(p Publisher) Sink {
+	return func(topic string, payload []byte) {
+		p.Publish(topic, payload)
+	}
+}
+
+// Generator produces the payloads of a synthetic universe. It is not safe for
+// concurrent use.
+type Generator struct {
+	config      Config
+	rng         *rand.Rand
+	clock       time.Time
+	instruments []*instrumentState
+}
+
+type instrumentState struct {
+	Instrument
+	topic connector.Topic
+
+	previousClose int64
+	ltp           int64
+	open          int64
+	high          int64
+	low           int64
+	upper         int64
+	lower         int64
+	volume        uint32
+	turnover      float64
+	lastQuantity  uint32
+	lastTraded    time.Time
+
+	openInterest int32
+	dayHighOi    int32
+	dayLowOi     int32
+}
+
+// New validates the configuration and returns a generator.
+func New(config Config) (*Generator, error) {
+	if len(config.Instruments) == 0 {
+		return nil, fmt.Errorf("feedgen: no instruments")
+	}
+	if config.Start.IsZero() {
+		config.Start = time.Now()
+	}
+	if config.Step <= 0 {
+		config.Step = time.Second
+	}
+	if config.CircuitPercent <= 0 {
+		config.CircuitPercent = 10
+	}
+	if config.LppPercent <= 0 {
+		config.LppPercent = 5
+	}
+	if config.MarketStatusCode == 0 {
+		config.MarketStatusCode = 2
+	}
+
+	g := &Generator{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		clock:  config.Start,
+	}
+	for _, instrument := range config.Instruments {
+		topic, err := connector.ParseTopic(connector.FeedMarketWatch, instrument.Topic)
+		if err != nil {
+			return nil, fmt.Errorf("feedgen: %w", err)
+		}
+		if instrument.TickSize <= 0 {
+			instrument.TickSize = 0.05
+		}
+		if instrument.PriceDivisor <= 0 {
+			instrument.PriceDivisor = 100
+		}
+		if instrument.LotSize == 0 {
+			instrument.LotSize = 1
+		}
+		if instrument.Volatility <= 0 {
+			instrument.Volatility = 0.0005
+		}
+		if instrument.Price <= 0 {
+			return nil, fmt.Errorf("feedgen: %s: price should be positive", instrument.Topic)
+		}
+		tick := instrument.TickSize * float64(instrument.PriceDivisor)
+		if math.Abs(tick-math.Round(tick)) > 1e-9 {
+			return nil, fmt.Errorf("feedgen: %s: tick size %v is not a multiple of 1/%d", instrument.Topic, instrument.TickSize, instrument.PriceDivisor)
+		}
+
+		state := &instrumentState{Instrument: instrument, topic: topic}
+		state.previousClose = state.roundToTick(instrument.Price)
+		state.upper = state.roundToTick(instrument.Price * (1 + config.CircuitPercent/100))
+		state.lower = state.roundToTick(instrument.Price * (1 - config.CircuitPercent/100))
+		state.ltp = state.previousClose
+		state.openInterest = instrument.OpenInterest
+		state.dayHighOi = instrument.OpenInterest
+		state.dayLowOi = instrument.OpenInterest
+		g.instruments = append(g.instruments, state)
+	}
+	return g, nil
+}
+
+// Now returns the simulated time of the next tick.
+func (g *Generator) Now() time.Time {
+	return g.clock
+}
+
+// Reference returns the reference data of the universe: the LPP band of each instrument,
+// the circuit limits and 52 week extremes on their segment topics, and the market
+// status of each segment.
+func (g *Generator) Reference() []Message {
+	var messages []Message
+	segments := map[string]bool{}
+	for _, s := range g.instruments {
+		segments[s.topic.Segment] = true
+		tick := s.tickRaw()
+		band := float64(s.previousClose) * g.config.LppPercent / 100
+		lppHigh := s.previousClose + int64(math.Round(band/float64(tick)))*tick
+		lppLow := s.previousClose - int64(math.Round(band/float64(tick)))*tick
+
+		messages = append(messages,
+			g.message(connector.FeedLpp, s.topic.String(), &connector.LppData{LppHigh: uint32(lppHigh), LppLow: uint32(lppLow), PriceDivisor: s.PriceDivisor}),
+			g.message(connector.FeedUpperCircuit, s.topic.Segment, &connector.UpperCircuitData{InstrumentId: s.topic.InstrumentId, UpperCircuit: uint32(s.upper), PriceDivisor: s.PriceDivisor}),
+			g.message(connector.FeedLowerCircuit, s.topic.Segment, &connector.LowerCircuitData{InstrumentId: s.topic.InstrumentId, LowerCircuit: uint32(s.lower), PriceDivisor: s.PriceDivisor}),
+			g.message(connector.FeedHigh52Week, s.topic.Segment, &connector.High52WeekData{InstrumentId: s.topic.InstrumentId, High52Week: uint32(s.roundToTick(s.Price * 1.25)), PriceDivisor: s.PriceDivisor}),
+			g.message(connector.FeedLow52Week, s.topic.Segment, &connector.Low52WeekData{InstrumentId: s.topic.InstrumentId, Low52Week: uint32(s.roundToTick(s.Price * 0.75)), PriceDivisor: s.PriceDivisor}),
+		)
+	}
+
+	names := make([]string, 0, len(segments))
+	for segment := range segments {
+		names = append(names, segment)
+	}
+	sort.Strings(names)
+	for _, segment := range names {
+		messages = append(messages, g.message(connector.FeedMarketStatus, segment, &connector.MarketStatusData{MarketStatusCode: g.config.MarketStatusCode}))
+	}
+	return messages
+}
+
+// Tick advances the simulated clock by one step and returns a MarketWatch payload for
+// every instrument, followed by an Open Interest payload for instruments with open interest.
+func (g *Generator) Tick() []Message {
+	var messages []Message
+	for _, s := range g.instruments {
+		messages = append(messages, g.message(connector.FeedMarketWatch, s.topic.String(), g.step(s)))
+		if s.OpenInterest != 0 {
+			messages = append(messages, g.message(connector.FeedOpenInterest, s.topic.String(), g.stepOpenInterest(s)))
+		}
+	}
+	g.clock = g.clock.Add(g.config.Step)
+	return messages
+}
+
+// Run sends the reference data and then one Tick every interval to the sink until the
+// context is done. A zero interval generates ticks as fast as the sink accepts them.
+func (g *Generator) Run(ctx context.Context, interval time.Duration, sink Sink) error {
+	for _, message := range g.Reference() {
+		sink(message.Topic, message.Payload)
+	}
+
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+	for {
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, message := range g.Tick() {
+			sink(message.Topic, message.Payload)
+		}
+	}
+}
+
+func (g *Generator) message(feed connector.Feed, topic string, data interface{}) Message {
+	payload, err := connector.EncodeFeed(data)
+	if err != nil {
+		// The feed structures only hold fixed size fields, so encoding cannot fail.
+		panic(err)
+	}
+	return Message{Topic: string(feed) + topic, Payload: payload, Time: g.clock}
+}
+
+func (g *Generator) step(s *instrumentState) *connector.MWBOCombined {
+	tick := s.tickRaw()
+	traded := g.rng.Float64() >= g.config.QuoteOnlyProbability
+
+	if traded {
+		price := float64(s.ltp) * math.Exp(s.Volatility*g.rng.NormFloat64())
+		ltp := int64(math.Round(price/float64(tick))) * tick
+		if ltp > s.upper {
+			ltp = s.upper
+		}
+		if ltp < s.lower {
+			ltp = s.lower
+		}
+		if ltp < tick {
+			ltp = tick
+		}
+		s.ltp = ltp
+
+		s.lastQuantity = s.LotSize * uint32(1+g.rng.Intn(10))
+		s.volume += s.lastQuantity
+		s.turnover += float64(s.lastQuantity) * float64(s.ltp)
+		s.lastTraded = g.clock
+		if s.open == 0 {
+			s.open, s.high, s.low = s.ltp, s.ltp, s.ltp
+		}
+		if s.ltp > s.high {
+			s.high = s.ltp
+		}
+		if s.ltp < s.low {
+			s.low = s.ltp
+		}
+	}
+
+	bid := s.ltp - tick*int64(g.rng.Intn(2))
+	ask := bid + tick*int64(1+g.rng.Intn(2))
+	if ask < s.ltp {
+		ask = s.ltp
+	}
+
+	data := &connector.MWBOCombined{
+		Ltp:                int32(s.ltp),
+		LastTradedQuantity: s.lastQuantity,
+		TradedVolume:       s.volume,
+		High:               int32(s.high),
+		Low:                int32(s.low),
+		Open:               int32(s.open),
+		Close:              int32(s.previousClose),
+		PriceDivisor:       s.PriceDivisor,
+	}
+	if s.volume > 0 {
+		data.AverageTradedPrice = int32(math.Round(s.turnover / float64(s.volume)))
+	}
+	if !s.lastTraded.IsZero() {
+		data.LastTradedTime = int32(s.lastTraded.Sub(connector.ExchangeEpoch) / time.Second)
+	}
+
+	for level := 0; level < 5; level++ {
+		bidLevel := connector.Depth{
+			Quantity:        s.LotSize * uint32(1+g.rng.Intn(50)),
+			Price:           int32(bid - int64(level)*tick),
+			TransactionType: connector.TransactionTypeBuy,
+		}
+		askLevel := connector.Depth{
+			Quantity:        s.LotSize * uint32(1+g.rng.Intn(50)),
+			Price:           int32(ask + int64(level)*tick),
+			TransactionType: connector.TransactionTypeSell,
+		}
+		bidLevel.Orders = int16(1 + g.rng.Intn(int(bidLevel.Quantity/s.LotSize)))
+		askLevel.Orders = int16(1 + g.rng.Intn(int(askLevel.Quantity/s.LotSize)))
+		if bidLevel.Price <= 0 {
+			bidLevel = connector.Depth{TransactionType: connector.TransactionTypeBuy}
+		}
+		data.MarketDepth[level] = bidLevel
+		data.MarketDepth[5+level] = askLevel
+		data.TotalBidQuantity += bidLevel.Quantity
+		data.TotalAskQuantity += askLevel.Quantity
+	}
+	data.BestBidPrice = data.MarketDepth[0].Price
+	data.BestBidQuantity = data.MarketDepth[0].Quantity
+	data.BestAskPrice = data.MarketDepth[5].Price
+	data.BestAskQuantity = data.MarketDepth[5].Quantity
+	return data
+}
+
+func (g *Generator) stepOpenInterest(s *instrumentState) *connector.OpenInterestData {
+	change := int32(g.rng.NormFloat64() * float64(s.OpenInterest) * 0.001)
+	change -= change % int32(s.LotSize)
+	if s.openInterest+change > 0 {
+		s.openInterest += change
+	}
+	if s.openInterest > s.dayHighOi {
+		s.dayHighOi = s.openInterest
+	}
+	if s.openInterest < s.dayLowOi {
+		s.dayLowOi = s.openInterest
+	}
+	return &connector.OpenInterestData{
+		OpenInterest: s.openInterest,
+		DayHighOi:    s.dayHighOi,
+		DayLowOi:     s.dayLowOi,
+		PreviousOi:   s.OpenInterest,
+	}
+}
+
+// tickRaw returns the tick size in raw price units.
+func (s *instrumentState) tickRaw() int64 {
+	return int64(math.Round(s.TickSize * float64(s.PriceDivisor)))
+}
+
+// roundToTick converts a price in rupees to raw units rounded to the tick size.
+func (s *instrumentState) roundToTick(price float64) int64 {
+	tick := s.tickRaw()
+	return int64(math.Round(price*float64(s.PriceDivisor)/float64(tick))) * tick
+}
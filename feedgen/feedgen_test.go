@@ -0,0 +1,232 @@
+package feedgen_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/bridgetest"
+	"github.com/IIFLSecurities/bridgeGo/connector"
+	"github.com/IIFLSecurities/bridgeGo/feedgen"
+)
+
+var _ feedgen.Publisher = (*bridgetest.Server)(nil)
+
+var start = time.Date(2024, 10, 18, 9, 15, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+
+func newGenerator(t *testing.T, config feedgen.Config) *feedgen.Generator {
+	t.Helper()
+	if config.Start.IsZero() {
+		config.Start = start
+	}
+	gen, err := feedgen.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+func TestTicks(t *testing.T) {
+	gen := newGenerator(t, feedgen.Config{
+		Seed: 1,
+		Instruments: []feedgen.Instrument{
+			{Topic: "nseeq/2885", Price: 2950},
+			{Topic: "nsefo/35001", Price: 24850.35, TickSize: 0.05, LotSize: 25, Volatility: 0.02, OpenInterest: 1000000},
+		},
+		CircuitPercent:       2,
+		QuoteOnlyProbability: 0.3,
+	})
+
+	volumes := map[string]uint32{}
+	for n := 0; n < 500; n++ {
+		messages := gen.Tick()
+		if len(messages) != 3 {
+			t.Fatalf("tick %d has %d messages, want 3", n, len(messages))
+		}
+		for _, message := range messages {
+			if want := start.Add(time.Duration(n) * time.Second); !message.Time.Equal(want) {
+				t.Fatalf("message at %v, want %v", message.Time, want)
+			}
+			if strings.HasPrefix(message.Topic, string(connector.FeedOpenInterest)) {
+				oi, err := connector.DecodeOpenInterest(message.Payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if oi.OpenInterest <= 0 || oi.OpenInterest%25 != 0 || oi.DayLowOi > oi.OpenInterest || oi.DayHighOi < oi.OpenInterest || oi.PreviousOi != 1000000 {
+					t.Fatalf("open interest %+v", oi)
+				}
+				continue
+			}
+			checkTick(t, message, volumes)
+		}
+	}
+}
+
+func checkTick(t *testing.T, message feedgen.Message, volumes map[string]uint32) {
+	t.Helper()
+	tick, err := connector.DecodeMW(message.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bands := map[string][2]int32{
+		string(connector.FeedMarketWatch) + "nseeq/2885":  {289100, 300900},
+		string(connector.FeedMarketWatch) + "nsefo/35001": {2435335, 2534735},
+	}
+	band, ok := bands[message.Topic]
+	if !ok {
+		t.Fatalf("unexpected topic %s", message.Topic)
+	}
+	if tick.PriceDivisor != 100 || tick.Ltp%5 != 0 || tick.Ltp < band[0] || tick.Ltp > band[1] {
+		t.Fatalf("%s: ltp %d outside the circuit band %v or off the tick", message.Topic, tick.Ltp, band)
+	}
+	if tick.TradedVolume < volumes[message.Topic] {
+		t.Fatalf("%s: volume went back from %d to %d", message.Topic, volumes[message.Topic], tick.TradedVolume)
+	}
+	volumes[message.Topic] = tick.TradedVolume
+	if tick.TradedVolume > 0 && (tick.High < tick.Ltp || tick.Low > tick.Ltp || tick.Open == 0) {
+		t.Fatalf("%s: ltp %d outside the day range %d-%d", message.Topic, tick.Ltp, tick.Low, tick.High)
+	}
+
+	var bidQuantity, askQuantity uint32
+	for level := 0; level < 5; level++ {
+		bid, ask := tick.MarketDepth[level], tick.MarketDepth[5+level]
+		if bid.TransactionType != connector.TransactionTypeBuy || ask.TransactionType != connector.TransactionTypeSell {
+			t.Fatalf("level %d has sides %c and %c", level, bid.TransactionType, ask.TransactionType)
+		}
+		if bid.Price%5 != 0 || ask.Price%5 != 0 || ask.Orders <= 0 || (bid.Price > 0 && bid.Orders <= 0) {
+			t.Fatalf("level %d: bid %+v, ask %+v", level, bid, ask)
+		}
+		if level > 0 && (bid.Price >= tick.MarketDepth[level-1].Price || ask.Price <= tick.MarketDepth[4+level].Price) {
+			t.Fatalf("level %d is out of order: %+v", level, tick.MarketDepth)
+		}
+		bidQuantity += bid.Quantity
+		askQuantity += ask.Quantity
+	}
+	if tick.BestBidPrice >= tick.BestAskPrice || tick.BestAskPrice < tick.Ltp || tick.BestBidPrice != tick.MarketDepth[0].Price {
+		t.Fatalf("best bid %d and ask %d around ltp %d", tick.BestBidPrice, tick.BestAskPrice, tick.Ltp)
+	}
+	if bidQuantity != tick.TotalBidQuantity || askQuantity != tick.TotalAskQuantity {
+		t.Fatalf("total quantities %d/%d, want %d/%d", tick.TotalBidQuantity, tick.TotalAskQuantity, bidQuantity, askQuantity)
+	}
+}
+
+func TestReference(t *testing.T) {
+	gen := newGenerator(t, feedgen.Config{
+		Instruments: []feedgen.Instrument{{Topic: "nseeq/2885", Price: 2950}, {Topic: "nseeq/1594", Price: 1500}},
+	})
+	counts := map[connector.Feed]int{}
+	for _, message := range gen.Reference() {
+		var feed connector.Feed
+		for _, f := range []connector.Feed{connector.FeedLpp, connector.FeedUpperCircuit, connector.FeedLowerCircuit,
+			connector.FeedHigh52Week, connector.FeedLow52Week, connector.FeedMarketStatus} {
+			if strings.HasPrefix(message.Topic, string(f)) {
+				feed = f
+			}
+		}
+		counts[feed]++
+		if message.Topic != string(connector.FeedLpp)+"nseeq/1594" && message.Topic != string(connector.FeedUpperCircuit)+"nseeq" &&
+			message.Topic != string(connector.FeedMarketStatus)+"nseeq" {
+			continue
+		}
+		switch feed {
+		case connector.FeedLpp:
+			lpp, _ := connector.DecodeLpp(message.Payload)
+			if low, high := lpp.Range(); low != 1425 || high != 1575 {
+				t.Errorf("LPP band %v-%v, want 1425-1575", low, high)
+			}
+		case connector.FeedUpperCircuit:
+			upper, _ := connector.DecodeUpperCircuit(message.Payload)
+			if upper.InstrumentId == 2885 && upper.Price() != 3245 {
+				t.Errorf("upper circuit %v, want 3245", upper.Price())
+			}
+		case connector.FeedMarketStatus:
+			status, _ := connector.DecodeMarketStatus(message.Payload)
+			if status.MarketStatusCode != 2 {
+				t.Errorf("market status %d, want the default 2", status.MarketStatusCode)
+			}
+		}
+	}
+	want := map[connector.Feed]int{connector.FeedLpp: 2, connector.FeedUpperCircuit: 2, connector.FeedLowerCircuit: 2,
+		connector.FeedHigh52Week: 2, connector.FeedLow52Week: 2, connector.FeedMarketStatus: 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("reference messages %v, want %v", counts, want)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	config := feedgen.Config{Seed: 7, Instruments: []feedgen.Instrument{{Topic: "nseeq/2885", Price: 2950}}}
+	first, second := newGenerator(t, config), newGenerator(t, config)
+	for n := 0; n < 50; n++ {
+		if a, b := first.Tick(), second.Tick(); !reflect.DeepEqual(a, b) {
+			t.Fatalf("tick %d differs between generators with the same seed", n)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		instrument feedgen.Instrument
+		err        string
+	}{
+		{"topic", feedgen.Instrument{Topic: "nsee/1", Price: 10}, "unknown segment"},
+		{"price", feedgen.Instrument{Topic: "nseeq/1"}, "price should be positive"},
+		{"tick size", feedgen.Instrument{Topic: "nseeq/1", Price: 10, TickSize: 0.001}, "not a multiple of 1/100"},
+	}
+	for _, test := range tests {
+		_, err := feedgen.New(feedgen.Config{Instruments: []feedgen.Instrument{test.instrument}})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+		}
+	}
+	if _, err := feedgen.New(feedgen.Config{}); err == nil {
+		t.Error("New without instruments succeeded")
+	}
+}
+
+type recorder struct {
+	topics []string
+}
+
+func (r *recorder) Publish(topic string, payload []byte) int {
+	r.topics = append(r.topics, topic)
+	return 1
+}
+
+func TestSinks(t *testing.T) {
+	config := feedgen.Config{Instruments: []feedgen.Instrument{{Topic: "nseeq/2885", Price: 2950}}}
+
+	var published recorder
+	ctx, cancel := context.WithCancel(context.Background())
+	gen := newGenerator(t, config)
+	sink := feedgen.PublishTo(&published)
+	err := gen.Run(ctx, 0, func(topic string, payload []byte) {
+		sink(topic, payload)
+		if len(published.topics) == 8 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Run returned %v, want context.Canceled", err)
+	}
+	if len(published.topics) != 8 || published.topics[6] != string(connector.FeedMarketWatch)+"nseeq/2885" {
+		t.Errorf("published %v, want the reference data then the ticks", published.topics)
+	}
+
+	var received []string
+	c := &connector.Connect{MWHandler: func(payload []byte, topic string) {
+		if _, err := connector.DecodeMW(payload); err != nil {
+			t.Error(err)
+		}
+		received = append(received, topic)
+	}}
+	dispatch := feedgen.DispatchTo(c)
+	for _, message := range newGenerator(t, config).Tick() {
+		dispatch(message.Topic, message.Payload)
+	}
+	if !reflect.DeepEqual(received, []string{"nseeq/2885"}) {
+		t.Errorf("MWHandler received %v", received)
+	}
+}
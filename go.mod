@@ -3,7 +3,11 @@ module github.com/IIFLSecurities/bridgeGo
 go 1.24.1
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.5.0 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/klauspost/compress v1.18.0
+)
+
+require (
 	github.com/golang-jwt/jwt/v4 v4.5.1 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/net v0.27.0 // indirect
@@ -0,0 +1,229 @@
+// Package journal records the raw messages received from the bridge to an append-only
+// journal and reads them back.
+//
+// A journal is a directory of segment files named <prefix>-<yyyymmdd>-<nnnn>.jnl, with
+// the extension of the codec appended when the segment is compressed, e.g.
+// bridge-20241018-0001.jnl.gz. Segments are rotated at the start of each exchange day
+// and when they reach a configured size. The uncompressed content of a segment is the
+// magic "BJNL" and a version byte, followed by records:
+//
+//	uint32  length of the body
+//	uint32  CRC-32C of the body
+//	body:
+//	int64   receive time in nanoseconds since the Unix epoch
+//	uint16  length of the feed, followed by the feed, e.g. "prod/marketfeed/mw/v1/"
+//	uint16  length of the topic, followed by the topic, e.g. "nseeq/2885"
+//	        the raw payload, up to the end of the body
+//
+// Integers are little endian, as in the feed payloads.
+package journal
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+const (
+	magic          = "BJNL"
+	formatVersion  = 1
+	segmentSuffix  = ".jnl"
+	recordHeader   = 8
+	maxRecordBytes = 1 << 24
+)
+
+var (
+	// ErrCorrupt is returned when a record fails its checksum or is malformed.
+	ErrCorrupt = errors.New("journal: corrupt record")
+	// ErrTruncated is returned when a segment ends in the middle of a record, as
+	// happens when the recording process is killed.
+	ErrTruncated = errors.New("journal: truncated record")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Record is one message received from the bridge.
+type Record struct {
+	// Time is the time the message was received.
+	Time    time.Time
+	Feed    connector.Feed
+	Topic   string
+	Payload []byte
+}
+
+// FullTopic returns the MQTT topic of the message, e.g. "prod/marketfeed/mw/v1/nseeq/2885".
+func (r Record) FullTopic() string {
+	return string(r.Feed) + r.Topic
+}
+
+// Codec compresses journal segments.
+type Codec struct {
+	// Extension is appended to the name of the compressed segments, e.g. ".gz".
+	Extension string
+	NewWriter func(io.Writer) (io.WriteCloser, error)
+	NewReader func(io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip compresses segments with gzip.
+var Gzip = &Codec{
+	Extension: ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]*Codec{Gzip.Extension: Gzip}
+)
+
+// RegisterCodec makes a codec available to readers of segments with its extension.
+// Gzip is always registered; importing the journal/zstd package registers zstd.Codec.
+func RegisterCodec(codec *Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Extension] = codec
+}
+
+func codecFor(extension string) (*Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[extension]
+	return codec, ok
+}
+
+// Segments returns the segment files of a journal in recording order.
+// Parameters:
+// - dir: The directory of the journal
+// - prefix: The prefix of the segment names, e.g. "bridge"
+func Segments(dir string, prefix string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"-*"+segmentSuffix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	var segments []segmentName
+	for _, path := range matches {
+		if name, ok := parseSegmentName(filepath.Base(path), prefix); ok {
+			name.path = path
+			segments = append(segments, name)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].day != segments[j].day {
+			return segments[i].day < segments[j].day
+		}
+		return segments[i].sequence < segments[j].sequence
+	})
+	paths := make([]string, len(segments))
+	for i, segment := range segments {
+		paths[i] = segment.path
+	}
+	return paths, nil
+}
+
+type segmentName struct {
+	path      string
+	day       string
+	sequence  int
+	extension string
+}
+
+func formatSegmentName(prefix string, day string, sequence int, codec *Codec) string {
+	name := fmt.Sprintf("%s-%s-%04d%s", prefix, day, sequence, segmentSuffix)
+	if codec != nil {
+		name += codec.Extension
+	}
+	return name
+}
+
+func parseSegmentName(name string, prefix string) (segmentName, bool) {
+	var parsed segmentName
+	rest, ok := strings.CutPrefix(name, prefix+"-")
+	if !ok {
+		return parsed, false
+	}
+	base, extension, ok := strings.Cut(rest, segmentSuffix)
+	if !ok {
+		return parsed, false
+	}
+	day, sequence, ok := strings.Cut(base, "-")
+	if !ok || len(day) != 8 {
+		return parsed, false
+	}
+	if _, err := time.Parse("20060102", day); err != nil {
+		return parsed, false
+	}
+	number, err := strconv.Atoi(sequence)
+	if err != nil || number <= 0 {
+		return parsed, false
+	}
+	parsed.day = day
+	parsed.sequence = number
+	parsed.extension = extension
+	return parsed, true
+}
+
+// appendRecord appends the framed record to buffer.
+func appendRecord(buffer []byte, record Record) []byte {
+	bodyLength := 8 + 2 + len(record.Feed) + 2 + len(record.Topic) + len(record.Payload)
+	start := len(buffer)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(bodyLength))
+	buffer = binary.LittleEndian.AppendUint32(buffer, 0)
+	body := len(buffer)
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(record.Time.UnixNano()))
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(record.Feed)))
+	buffer = append(buffer, record.Feed...)
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(record.Topic)))
+	buffer = append(buffer, record.Topic...)
+	buffer = append(buffer, record.Payload...)
+	binary.LittleEndian.PutUint32(buffer[start+4:], crc32.Checksum(buffer[body:], crcTable))
+	return buffer
+}
+
+// parseRecord decodes a record body whose checksum has been verified.
+func parseRecord(body []byte) (Record, error) {
+	var record Record
+	if len(body) < 12 {
+		return record, ErrCorrupt
+	}
+	record.Time = time.Unix(0, int64(binary.LittleEndian.Uint64(body)))
+	body = body[8:]
+
+	feed, body, ok := cutString(body)
+	if !ok {
+		return record, ErrCorrupt
+	}
+	topic, body, ok := cutString(body)
+	if !ok {
+		return record, ErrCorrupt
+	}
+	record.Feed = connector.Feed(feed)
+	record.Topic = topic
+	record.Payload = body
+	return record, nil
+}
+
+func cutString(data []byte) (string, []byte, bool) {
+	if len(data) < 2 {
+		return "", data, false
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+length {
+		return "", data, false
+	}
+	return string(data[2 : 2+length]), data[2+length:], true
+}
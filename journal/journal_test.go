@@ -0,0 +1,210 @@
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+var start = time.Date(2024, 10, 18, 23, 59, 55, 0, connector.IST)
+
+// records returns n MarketWatch records one second apart from start, which crosses
+// midnight IST after the fifth.
+func records(n int) []Record {
+	result := make([]Record, n)
+	for i := range result {
+		result[i] = Record{
+			Time:    start.Add(time.Duration(i) * time.Second),
+			Feed:    connector.FeedMarketWatch,
+			Topic:   fmt.Sprintf("nseeq/%d", i%3+1),
+			Payload: []byte(fmt.Sprintf("payload %d", i)),
+		}
+	}
+	return result
+}
+
+func record(t *testing.T, config Config, records []Record) {
+	t.Helper()
+	recorder, err := NewRecorder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		recorder.Record(record)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := recorder.Stats(); stats.Recorded != uint64(len(records)) {
+		t.Fatalf("recorded %d records, want %d", stats.Recorded, len(records))
+	}
+}
+
+func readAll(t *testing.T, reader *Reader) ([]Record, []error) {
+	t.Helper()
+	var result []Record
+	var errs []error
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return result, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result = append(result, record)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		codec    *Codec
+		maxBytes int64
+		segments []string
+	}{
+		{name: "plain", segments: []string{"bridge-20241018-0001.jnl", "bridge-20241019-0001.jnl"}},
+		{name: "gzip", codec: Gzip, segments: []string{"bridge-20241018-0001.jnl.gz", "bridge-20241019-0001.jnl.gz"}},
+		{name: "rotated", maxBytes: 100, segments: []string{
+			"bridge-20241018-0001.jnl", "bridge-20241018-0002.jnl", "bridge-20241018-0003.jnl",
+			"bridge-20241019-0001.jnl", "bridge-20241019-0002.jnl", "bridge-20241019-0003.jnl",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			want := records(10)
+			record(t, Config{Dir: dir, Codec: test.codec, MaxSegmentBytes: test.maxBytes}, want)
+
+			paths, err := Segments(dir, "bridge")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, path := range paths {
+				names = append(names, filepath.Base(path))
+			}
+			if !reflect.DeepEqual(names, test.segments) {
+				t.Errorf("segments %v, want %v", names, test.segments)
+			}
+
+			reader := NewReader(paths...)
+			defer reader.Close()
+			got, errs := readAll(t, reader)
+			if len(errs) != 0 {
+				t.Fatal(errs)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("read %d records, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !got[i].Time.Equal(want[i].Time) || got[i].Feed != want[i].Feed || got[i].Topic != want[i].Topic || string(got[i].Payload) != string(want[i].Payload) {
+					t.Errorf("record %d is %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// offset returns the offset of record i in the first segment of records(10).
+func offset(i int) int {
+	offset := len(magic) + 1
+	for _, record := range records(10)[:i] {
+		offset += len(appendRecord(nil, record))
+	}
+	return offset
+}
+
+func TestDamagedSegments(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(data []byte) []byte
+		err    error
+		// read is the number of the five records of the damaged segment that are read.
+		read int
+	}{
+		{
+			name: "checksum",
+			damage: func(data []byte) []byte {
+				data[len(data)-1] ^= 0xff
+				return data
+			},
+			err:  ErrCorrupt,
+			read: 4,
+		},
+		{
+			name: "checksum mid-segment",
+			damage: func(data []byte) []byte {
+				data[offset(3)-1] ^= 0xff
+				return data
+			},
+			err:  ErrCorrupt,
+			read: 4,
+		},
+		{
+			name: "body mid-segment",
+			damage: func(data []byte) []byte {
+				// A feed length past the end of a body with a valid checksum.
+				record := data[offset(1):offset(2)]
+				binary.LittleEndian.PutUint16(record[recordHeader+8:], 0xffff)
+				binary.LittleEndian.PutUint32(record[4:], crc32.Checksum(record[recordHeader:], crcTable))
+				return data
+			},
+			err:  ErrCorrupt,
+			read: 4,
+		},
+		{
+			name: "length mid-segment",
+			damage: func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[offset(2):], maxRecordBytes+1)
+				return data
+			},
+			err:  ErrCorrupt,
+			read: 2,
+		},
+		{
+			name:   "truncated",
+			damage: func(data []byte) []byte { return data[:len(data)-3] },
+			err:    ErrTruncated,
+			read:   4,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			record(t, Config{Dir: dir}, records(10))
+			paths, err := Segments(dir, "bridge")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(paths[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(paths[0], test.damage(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, errs := readAll(t, NewReader(paths...))
+			if len(errs) != 1 || !errors.Is(errs[0], test.err) {
+				t.Fatalf("errors %v, want one %v", errs, test.err)
+			}
+			if want := test.read + 5; len(got) != want {
+				t.Errorf("read %d records, want %d with the next segment", len(got), want)
+			}
+			if last := got[len(got)-1]; string(last.Payload) != "payload 9" {
+				t.Errorf("last record is %q, want payload 9", last.Payload)
+			}
+		})
+	}
+}
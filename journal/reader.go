@@ -0,0 +1,172 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Reader reads the records of one or more segments in order.
+type Reader struct {
+	paths  []string
+	next   int
+	path   string
+	file   *os.File
+	closer io.Closer
+	input  *bufio.Reader
+	header [recordHeader]byte
+}
+
+// NewReader returns a reader over the segments, e.g. those returned by Segments.
+func NewReader(paths ...string) *Reader {
+	return &Reader{paths: paths}
+}
+
+// OpenJournal returns a reader over all the segments of a journal.
+// Parameters:
+// - dir: The directory of the journal
+// - prefix: The prefix of the segment names, e.g. "bridge"
+func OpenJournal(dir string, prefix string) (*Reader, error) {
+	paths, err := Segments(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(paths...), nil
+}
+
+// Next returns the next record, or io.EOF after the last segment. Errors are wrapped
+// with the name of the segment:
+//   - A record whose length is intact but whose checksum or body is bad reports
+//     ErrCorrupt; the following call continues with the next record of the segment,
+//     so exactly that record is lost.
+//   - A segment that ends in a partial record reports ErrTruncated, and a record with
+//     an impossible length reports ErrCorrupt; as the records after it cannot be
+//     framed, the following call continues with the next segment.
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.input == nil {
+			if r.next >= len(r.paths) {
+				return Record{}, io.EOF
+			}
+			path := r.paths[r.next]
+			r.next++
+			if err := r.open(path); err != nil {
+				return Record{}, err
+			}
+		}
+
+		record, err := r.read()
+		if err == nil {
+			return record, nil
+		}
+		path := r.path
+		if err == ErrCorrupt {
+			// The record was skipped whole, so the segment is still in step.
+			return Record{}, fmt.Errorf("%s: %w", path, err)
+		}
+		r.closeSegment()
+		if err != io.EOF {
+			return Record{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+}
+
+// Close closes the current segment.
+func (r *Reader) Close() error {
+	return r.closeSegment()
+}
+
+func (r *Reader) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var input io.Reader = file
+	var closer io.Closer
+	if extension := segmentExtension(path); extension != "" {
+		codec, ok := codecFor(extension)
+		if !ok {
+			file.Close()
+			return fmt.Errorf("journal: %s: no codec registered for %q", path, extension)
+		}
+		decompressor, err := codec.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("journal: %s: %w", path, err)
+		}
+		input = decompressor
+		closer = decompressor
+	}
+
+	r.path = path
+	r.file = file
+	r.closer = closer
+	r.input = bufio.NewReaderSize(input, 64<<10)
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r.input, header); err != nil || string(header[:len(magic)]) != magic {
+		r.closeSegment()
+		return fmt.Errorf("journal: %s: not a journal segment", path)
+	}
+	if header[len(magic)] != formatVersion {
+		r.closeSegment()
+		return fmt.Errorf("journal: %s: unsupported version %d", path, header[len(magic)])
+	}
+	return nil
+}
+
+func (r *Reader) read() (Record, error) {
+	if _, err := io.ReadFull(r.input, r.header[:]); err != nil {
+		if err == io.EOF {
+			return Record{}, io.EOF
+		}
+		return Record{}, truncated(err)
+	}
+	length := binary.LittleEndian.Uint32(r.header[:4])
+	checksum := binary.LittleEndian.Uint32(r.header[4:])
+	if length > maxRecordBytes {
+		return Record{}, fmt.Errorf("%w: length %d", ErrCorrupt, length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.input, body); err != nil {
+		return Record{}, truncated(err)
+	}
+	if crc32.Checksum(body, crcTable) != checksum {
+		return Record{}, ErrCorrupt
+	}
+	return parseRecord(body)
+}
+
+func (r *Reader) closeSegment() error {
+	if r.file == nil {
+		return nil
+	}
+	if r.closer != nil {
+		r.closer.Close()
+	}
+	err := r.file.Close()
+	r.file = nil
+	r.closer = nil
+	r.input = nil
+	return err
+}
+
+// truncated maps the end of a segment inside a record, including the end of an
+// unterminated compressed stream, to ErrTruncated.
+func truncated(err error) error {
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+// segmentExtension returns the codec extension of a segment path, e.g. ".gz".
+func segmentExtension(path string) string {
+	_, extension, _ := strings.Cut(filepath.Base(path), segmentSuffix)
+	return extension
+}
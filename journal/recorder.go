@@ -0,0 +1,323 @@
+package journal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Config configures a Recorder.
+type Config struct {
+	// Dir is the directory of the journal. It is created if needed.
+	Dir string
+	// Prefix is the prefix of the segment names. Defaults to "bridge".
+	Prefix string
+	// Codec compresses the segments, e.g. Gzip. Nil writes them uncompressed.
+	Codec *Codec
+	// MaxSegmentBytes rotates a segment once this many uncompressed bytes were
+	// written to it. Defaults to 256 MiB.
+	MaxSegmentBytes int64
+	// BufferSize is the number of messages queued between the handler and the
+	// writer. Defaults to 65536.
+	BufferSize int
+	// Block makes the handler wait for room in a full queue. By default the message
+	// is dropped and counted in Stats.Dropped, so that a slow disk cannot stall the
+	// feed.
+	Block bool
+	// FlushInterval is how often buffered records are written to the segment.
+	// Defaults to one second.
+	FlushInterval time.Duration
+	// Location sets the day boundaries of the segments. Defaults to connector.IST.
+	Location *time.Location
+	// OnError is called from the writer goroutine when a segment cannot be written.
+	// The segment is abandoned and the next record opens a new one.
+	OnError func(error)
+}
+
+// Stats counts the messages handled by a Recorder.
+type Stats struct {
+	// Recorded is the number of records written to the journal.
+	Recorded uint64
+	// Dropped is the number of messages discarded because the queue was full or the
+	// recorder was closed.
+	Dropped uint64
+	// Failed is the number of records lost to write errors.
+	Failed uint64
+	// Segments is the number of segments opened.
+	Segments uint64
+}
+
+// Recorder writes the messages received from the bridge to a journal. The handler only
+// copies the message into a bounded queue; a background goroutine frames, compresses
+// and writes the records.
+//
+//	recorder, err := journal.NewRecorder(journal.Config{Dir: "journal", Codec: journal.Gzip})
+//	if err != nil {
+//		return err
+//	}
+//	defer recorder.Close()
+//	conn.RawHandler = recorder.Handle
+type Recorder struct {
+	config Config
+	queue  chan Record
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	recorded atomic.Uint64
+	dropped  atomic.Uint64
+	failed   atomic.Uint64
+	segments atomic.Uint64
+
+	// State of the writer goroutine.
+	file       *os.File
+	compressor io.WriteCloser
+	writer     *bufio.Writer
+	day        string
+	sequence   int
+	size       int64
+	pending    uint64
+	frame      []byte
+	err        error
+}
+
+// NewRecorder creates the journal directory and starts the writer goroutine.
+func NewRecorder(config Config) (*Recorder, error) {
+	if config.Dir == "" {
+		return nil, errors.New("journal: no directory")
+	}
+	if config.Prefix == "" {
+		config.Prefix = "bridge"
+	}
+	if config.MaxSegmentBytes <= 0 {
+		config.MaxSegmentBytes = 256 << 20
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 65536
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.Location == nil {
+		config.Location = connector.IST
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		config: config,
+		queue:  make(chan Record, config.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Handle records a message received now. It has the signature of the Connect handler
+// fields, so that it can be set as RawHandler. The payload is copied.
+// Parameters:
+// - payload: The raw payload
+// - topic: The full MQTT topic, e.g. "prod/marketfeed/mw/v1/nseeq/2885"
+func (r *Recorder) Handle(payload []byte, topic string) {
+	feed, bridgeTopic := connector.SplitTopic(topic)
+	r.Record(Record{
+		Time:    time.Now(),
+		Feed:    feed,
+		Topic:   bridgeTopic,
+		Payload: append([]byte(nil), payload...),
+	})
+}
+
+// Record queues a record as is. The payload must not be modified afterwards.
+func (r *Recorder) Record(record Record) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		r.dropped.Add(1)
+		return
+	}
+	if r.config.Block {
+		r.queue <- record
+		return
+	}
+	select {
+	case r.queue <- record:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Stats returns the counters of the recorder.
+func (r *Recorder) Stats() Stats {
+	return Stats{
+		Recorded: r.recorded.Load(),
+		Dropped:  r.dropped.Load(),
+		Failed:   r.failed.Load(),
+		Segments: r.segments.Load(),
+	}
+}
+
+// Close writes the queued records, closes the current segment and stops the writer.
+// Messages handled afterwards are dropped. It returns the last write error, if any.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	<-r.done
+	return r.err
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case record, ok := <-r.queue:
+			if !ok {
+				if r.file != nil {
+					r.fail(r.closeSegment())
+				}
+				return
+			}
+			r.fail(r.write(record))
+		case <-ticker.C:
+			if r.file != nil {
+				r.fail(r.flush())
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(record Record) error {
+	day := record.Time.In(r.config.Location).Format("20060102")
+	if r.file == nil || day != r.day || r.size >= r.config.MaxSegmentBytes {
+		if r.file != nil {
+			if err := r.closeSegment(); err != nil {
+				return err
+			}
+		}
+		if err := r.openSegment(day); err != nil {
+			r.failed.Add(1)
+			return err
+		}
+	}
+
+	r.frame = appendRecord(r.frame[:0], record)
+	if _, err := r.writer.Write(r.frame); err != nil {
+		r.pending++
+		return err
+	}
+	r.size += int64(len(r.frame))
+	r.pending++
+	return nil
+}
+
+// flush writes the buffered records through the compressor to the file.
+func (r *Recorder) flush() error {
+	if err := r.writer.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := r.compressor.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+	r.recorded.Add(r.pending)
+	r.pending = 0
+	return nil
+}
+
+func (r *Recorder) openSegment(day string) error {
+	if day != r.day {
+		r.day = day
+		r.sequence = 0
+		segments, err := Segments(r.config.Dir, r.config.Prefix)
+		if err != nil {
+			return err
+		}
+		for _, path := range segments {
+			if name, ok := parseSegmentName(filepath.Base(path), r.config.Prefix); ok && name.day == day && name.sequence > r.sequence {
+				r.sequence = name.sequence
+			}
+		}
+	}
+	r.sequence++
+
+	path := filepath.Join(r.config.Dir, formatSegmentName(r.config.Prefix, day, r.sequence, r.config.Codec))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	var compressor io.WriteCloser
+	var output io.Writer = file
+	if r.config.Codec != nil {
+		compressor, err = r.config.Codec.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("journal: %s: %w", path, err)
+		}
+		output = compressor
+	}
+
+	r.file = file
+	r.compressor = compressor
+	r.writer = bufio.NewWriterSize(output, 64<<10)
+	r.size = 0
+	r.pending = 0
+	r.segments.Add(1)
+
+	r.writer.WriteString(magic)
+	r.writer.WriteByte(formatVersion)
+	return nil
+}
+
+// closeSegment flushes and closes the current segment. The segment is released even
+// when an error is returned.
+func (r *Recorder) closeSegment() error {
+	err := r.flush()
+	if r.compressor != nil {
+		if closeErr := r.compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if syncErr := r.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.failed.Add(r.pending)
+	r.file = nil
+	r.compressor = nil
+	r.writer = nil
+	r.pending = 0
+	return err
+}
+
+// fail reports a write error and abandons the current segment.
+func (r *Recorder) fail(err error) {
+	if err == nil {
+		return
+	}
+	if r.file != nil {
+		r.closeSegment()
+	}
+	r.err = err
+	if r.config.OnError != nil {
+		r.config.OnError(err)
+	}
+}
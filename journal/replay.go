@@ -0,0 +1,131 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Speed is the replay rate relative to the recording: 1 replays at real speed,
+	// 10 ten times faster. Zero replays as fast as possible.
+	Speed float64
+	// From skips the records received before it, unless it is zero.
+	From time.Time
+	// To ends the replay at the first record received after it, unless it is zero.
+	To time.Time
+	// Feeds limits the replay to these feeds. Empty replays every feed.
+	Feeds []connector.Feed
+	// Topics limits the replay to these bridge topics, e.g. "nseeq/2885". Empty
+	// replays every topic.
+	Topics []string
+	// OnError is called with the ErrTruncated and ErrCorrupt errors of damaged
+	// segments, which are skipped. Other errors end the replay.
+	OnError func(error)
+}
+
+// ReplayStats counts the records read by Replay.
+type ReplayStats struct {
+	// Dispatched is the number of records delivered to the handlers.
+	Dispatched int
+	// Filtered is the number of records skipped by the time, feed and topic filters.
+	Filtered int
+	// Damaged is the number of damaged segments that were skipped.
+	Damaged int
+}
+
+// Replay delivers the records of a journal to the handler fields of the connector
+// through Dispatch, the code path of live messages, so that strategies can be
+// backtested and bugs reproduced against a recorded session. Records are replayed in
+// recording order, paced by their receive times unless Speed is zero. The replay ends
+// at the end of the journal, at options.To, or when the context is done.
+//
+//	reader, err := journal.OpenJournal("journal", "bridge")
+//	if err != nil {
+//		return err
+//	}
+//	defer reader.Close()
+//	stats, err := journal.Replay(ctx, reader, conn, journal.ReplayOptions{
+//		Speed:  10,
+//		Feeds:  []connector.Feed{connector.FeedMarketWatch},
+//		Topics: []string{"nseeq/2885"},
+//	})
+func Replay(ctx context.Context, reader *Reader, c *connector.Connect, options ReplayOptions) (ReplayStats, error) {
+	var stats ReplayStats
+
+	feeds := map[connector.Feed]bool{}
+	for _, feed := range options.Feeds {
+		feeds[feed] = true
+	}
+	topics := map[string]bool{}
+	for _, topic := range options.Topics {
+		topics[topic] = true
+	}
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	var origin time.Time
+	var started time.Time
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		record, err := reader.Next()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if errors.Is(err, ErrTruncated) || errors.Is(err, ErrCorrupt) {
+			stats.Damaged++
+			if options.OnError != nil {
+				options.OnError(err)
+			}
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		if !options.To.IsZero() && record.Time.After(options.To) {
+			return stats, nil
+		}
+		if (!options.From.IsZero() && record.Time.Before(options.From)) ||
+			(len(feeds) != 0 && !feeds[record.Feed]) ||
+			(len(topics) != 0 && !topics[record.Topic]) {
+			stats.Filtered++
+			continue
+		}
+
+		if options.Speed > 0 {
+			if origin.IsZero() {
+				origin = record.Time
+				started = time.Now()
+			}
+			due := started.Add(time.Duration(float64(record.Time.Sub(origin)) / options.Speed))
+			if wait := time.Until(due); wait > 0 {
+				if timer == nil {
+					timer = time.NewTimer(wait)
+				} else {
+					timer.Reset(wait)
+				}
+				select {
+				case <-ctx.Done():
+					return stats, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+
+		c.Dispatch(record.FullTopic(), record.Payload)
+		stats.Dispatched++
+	}
+}
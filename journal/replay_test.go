@@ -0,0 +1,89 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	record(t, Config{Dir: dir, Codec: Gzip}, records(10))
+
+	tests := []struct {
+		name       string
+		options    ReplayOptions
+		dispatched []string
+		filtered   int
+	}{
+		{
+			name:       "all",
+			dispatched: []string{"payload 0", "payload 1", "payload 2", "payload 3", "payload 4", "payload 5", "payload 6", "payload 7", "payload 8", "payload 9"},
+		},
+		{
+			name:       "range",
+			options:    ReplayOptions{From: start.Add(3 * time.Second), To: start.Add(6 * time.Second)},
+			dispatched: []string{"payload 3", "payload 4", "payload 5", "payload 6"},
+			filtered:   3,
+		},
+		{
+			name:       "topics",
+			options:    ReplayOptions{Topics: []string{"nseeq/2"}},
+			dispatched: []string{"payload 1", "payload 4", "payload 7"},
+			filtered:   7,
+		},
+		{
+			name:     "feeds",
+			options:  ReplayOptions{Feeds: []connector.Feed{connector.FeedIndex}},
+			filtered: 10,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var dispatched []string
+			c := &connector.Connect{MWHandler: func(payload []byte, topic string) {
+				dispatched = append(dispatched, string(payload))
+			}}
+			reader, err := OpenJournal(dir, "bridge")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			stats, err := Replay(context.Background(), reader, c, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dispatched, test.dispatched) {
+				t.Errorf("dispatched %v, want %v", dispatched, test.dispatched)
+			}
+			if stats.Dispatched != len(test.dispatched) || stats.Filtered != test.filtered {
+				t.Errorf("stats %+v, want %d dispatched and %d filtered", stats, len(test.dispatched), test.filtered)
+			}
+		})
+	}
+}
+
+func TestReplayCancelled(t *testing.T) {
+	dir := t.TempDir()
+	record(t, Config{Dir: dir}, records(10))
+	reader, err := OpenJournal(dir, "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats, err := Replay(ctx, reader, &connector.Connect{}, ReplayOptions{Speed: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Replay returned %v, want the context error", err)
+	}
+	if stats.Dispatched != 1 {
+		t.Errorf("dispatched %d records at real speed in 50ms, want 1", stats.Dispatched)
+	}
+}
@@ -0,0 +1,34 @@
+// Package zstd provides a zstd codec for journal segments. It is a separate package so
+// that only programs using it depend on the zstd implementation. Importing it registers
+// the codec, so that readers open ".zst" segments:
+//
+//	import "github.com/IIFLSecurities/bridgeGo/journal/zstd"
+//
+//	recorder, err := journal.NewRecorder(journal.Config{Dir: "journal", Codec: zstd.Codec})
+package zstd
+
+import (
+	"io"
+
+	"github.com/IIFLSecurities/bridgeGo/journal"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses segments with zstd.
+var Codec = &journal.Codec{
+	Extension: ".zst",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+func init() {
+	journal.RegisterCodec(Codec)
+}
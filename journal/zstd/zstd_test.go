@@ -0,0 +1,44 @@
+package zstd
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+	"github.com/IIFLSecurities/bridgeGo/journal"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := journal.NewRecorder(journal.Config{Dir: dir, Codec: Codec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 10, 18, 10, 0, 0, 0, connector.IST)
+	recorder.Record(journal.Record{Time: at, Feed: connector.FeedMarketWatch, Topic: "nseeq/2885", Payload: []byte("tick")})
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := journal.Segments(dir, "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Ext(paths[0]) != ".zst" {
+		t.Fatalf("segments %v, want one .zst segment", paths)
+	}
+	reader := journal.NewReader(paths...)
+	defer reader.Close()
+	record, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Time.Equal(at) || record.Topic != "nseeq/2885" || string(record.Payload) != "tick" {
+		t.Errorf("read %+v", record)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next after the last record returned %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,218 @@
+package marketdata
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// AlertKind is the kind of a price alert.
+type AlertKind int
+
+const (
+	// NearUpperCircuit is a last traded price within the proximity of the upper circuit.
+	NearUpperCircuit AlertKind = iota + 1
+	// NearLowerCircuit is a last traded price within the proximity of the lower circuit.
+	NearLowerCircuit
+	// High52WeekBreakout is a last traded price above the 52 week high.
+	High52WeekBreakout
+	// Low52WeekBreakdown is a last traded price below the 52 week low.
+	Low52WeekBreakdown
+)
+
+var alertKindNames = map[AlertKind]string{
+	NearUpperCircuit:   "near upper circuit",
+	NearLowerCircuit:   "near lower circuit",
+	High52WeekBreakout: "52 week high breakout",
+	Low52WeekBreakdown: "52 week low breakdown",
+}
+
+// String returns the name of the kind, e.g. "near upper circuit".
+func (k AlertKind) String() string {
+	if name, ok := alertKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("AlertKind(%d)", int(k))
+}
+
+// Alert is raised when the last traded price of an instrument approaches a circuit
+// limit or breaks a 52 week extreme.
+type Alert struct {
+	Kind  AlertKind
+	Topic string
+	// Time is the LastTradedTime of the tick that raised the alert.
+	Time  time.Time
+	Price float64
+	// Level is the circuit limit or 52 week extreme.
+	Level float64
+	// Distance is the distance from Price to Level, in percent of Level. It is negative
+	// once the level is crossed.
+	Distance float64
+}
+
+// AlertConfig configures an Alerter.
+type AlertConfig struct {
+	// CircuitProximityPercent raises the circuit alerts when the last traded price is
+	// within this percentage of a limit. Defaults to 1.
+	CircuitProximityPercent float64
+	// Cooldown is the minimum time between two alerts of the same kind on an instrument,
+	// measured in exchange time. Defaults to five minutes.
+	Cooldown time.Duration
+	// OnAlert is called with each alert.
+	OnAlert func(Alert)
+}
+
+// Alerter joins the MarketWatch ticks with the circuit and 52 week feeds of each
+// instrument and raises alerts. An alert is raised when its condition starts to hold,
+// not on every tick while it holds, and not again within the cooldown.
+//
+//	alerter := marketdata.NewAlerter(marketdata.AlertConfig{
+//		CircuitProximityPercent: 2,
+//		OnAlert: func(alert marketdata.Alert) {
+//			fmt.Println(alert.Topic, alert.Kind, alert.Price, alert.Level)
+//		},
+//	})
+//	conn.MWHandler = alerter.HandleMW
+//	conn.UpperCircuitHandler = alerter.HandleUpperCircuit
+//	conn.LowerCircuitHandler = alerter.HandleLowerCircuit
+//	conn.High52WeekHandler = alerter.HandleHigh52Week
+//	conn.Low52WeekHandler = alerter.HandleLow52Week
+type Alerter struct {
+	config AlertConfig
+
+	mu     sync.Mutex
+	levels map[string]*alertLevels
+}
+
+type alertLevels struct {
+	upper, lower, high52Week, low52Week float64
+	active                              map[AlertKind]bool
+	raised                              map[AlertKind]time.Time
+}
+
+// NewAlerter returns an alerter.
+func NewAlerter(config AlertConfig) *Alerter {
+	if config.CircuitProximityPercent <= 0 {
+		config.CircuitProximityPercent = 1
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 5 * time.Minute
+	}
+	return &Alerter{config: config, levels: map[string]*alertLevels{}}
+}
+
+// HandleMW checks a MarketWatch payload against the known levels of its topic. It has
+// the signature of the Connect handler fields, so that it can be set as MWHandler.
+func (a *Alerter) HandleMW(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	a.Check(topic, &tick)
+}
+
+// HandleUpperCircuit records the upper circuit limit carried by the payload.
+func (a *Alerter) HandleUpperCircuit(payload []byte, topic string) {
+	if data, err := connector.DecodeUpperCircuit(payload); err == nil {
+		a.setLevels(connector.InstrumentTopic(topic, data.InstrumentId), func(l *alertLevels) { l.upper = data.Price() })
+	}
+}
+
+// HandleLowerCircuit records the lower circuit limit carried by the payload.
+func (a *Alerter) HandleLowerCircuit(payload []byte, topic string) {
+	if data, err := connector.DecodeLowerCircuit(payload); err == nil {
+		a.setLevels(connector.InstrumentTopic(topic, data.InstrumentId), func(l *alertLevels) { l.lower = data.Price() })
+	}
+}
+
+// HandleHigh52Week records the 52 week high carried by the payload.
+func (a *Alerter) HandleHigh52Week(payload []byte, topic string) {
+	if data, err := connector.DecodeHigh52Week(payload); err == nil {
+		a.setLevels(connector.InstrumentTopic(topic, data.InstrumentId), func(l *alertLevels) { l.high52Week = data.Price() })
+	}
+}
+
+// HandleLow52Week records the 52 week low carried by the payload.
+func (a *Alerter) HandleLow52Week(payload []byte, topic string) {
+	if data, err := connector.DecodeLow52Week(payload); err == nil {
+		a.setLevels(connector.InstrumentTopic(topic, data.InstrumentId), func(l *alertLevels) { l.low52Week = data.Price() })
+	}
+}
+
+func (a *Alerter) setLevels(topic string, update func(*alertLevels)) {
+	a.mu.Lock()
+	update(a.levelsOf(topic))
+	a.mu.Unlock()
+}
+
+// Check checks a decoded MarketWatch tick of the topic and returns the alerts raised.
+func (a *Alerter) Check(topic string, tick *connector.MWBOCombined) []Alert {
+	if tick.Ltp <= 0 {
+		return nil
+	}
+	price := tick.Price(tick.Ltp)
+	at := tick.TradedAt()
+	proximity := a.config.CircuitProximityPercent
+
+	a.mu.Lock()
+	levels := a.levelsOf(topic)
+	conditions := []struct {
+		kind  AlertKind
+		level float64
+		holds bool
+	}{
+		{NearUpperCircuit, levels.upper, levels.upper > 0 && distance(price, levels.upper) <= proximity},
+		{NearLowerCircuit, levels.lower, levels.lower > 0 && -distance(price, levels.lower) <= proximity},
+		{High52WeekBreakout, levels.high52Week, levels.high52Week > 0 && price > levels.high52Week},
+		{Low52WeekBreakdown, levels.low52Week, levels.low52Week > 0 && price < levels.low52Week},
+	}
+
+	var alerts []Alert
+	for _, condition := range conditions {
+		if !condition.holds {
+			levels.active[condition.kind] = false
+			continue
+		}
+		if levels.active[condition.kind] {
+			continue
+		}
+		levels.active[condition.kind] = true
+		if last, ok := levels.raised[condition.kind]; ok && at.Sub(last) < a.config.Cooldown {
+			continue
+		}
+		levels.raised[condition.kind] = at
+
+		alert := Alert{Kind: condition.kind, Topic: topic, Time: at, Price: price, Level: condition.level}
+		switch condition.kind {
+		case NearUpperCircuit, High52WeekBreakout:
+			alert.Distance = distance(price, condition.level)
+		default:
+			alert.Distance = -distance(price, condition.level)
+		}
+		alerts = append(alerts, alert)
+	}
+	a.mu.Unlock()
+
+	if a.config.OnAlert != nil {
+		for _, alert := range alerts {
+			a.config.OnAlert(alert)
+		}
+	}
+	return alerts
+}
+
+func (a *Alerter) levelsOf(topic string) *alertLevels {
+	levels := a.levels[topic]
+	if levels == nil {
+		levels = &alertLevels{active: map[AlertKind]bool{}, raised: map[AlertKind]time.Time{}}
+		a.levels[topic] = levels
+	}
+	return levels
+}
+
+// distance returns how far price is below level, in percent of level.
+func distance(price float64, level float64) float64 {
+	return (level - price) / level * 100
+}
@@ -0,0 +1,111 @@
+package marketdata
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestAlerter(t *testing.T) {
+	type want struct {
+		kind     AlertKind
+		level    float64
+		distance float64
+	}
+	tests := []struct {
+		name   string
+		offset time.Duration
+		ltp    int32
+		want   []want
+	}{
+		{name: "inside the levels", offset: 0, ltp: 10000},
+		{name: "52 week breakout", offset: time.Minute, ltp: 10550, want: []want{{High52WeekBreakout, 105, -0.47619}}},
+		{name: "still above", offset: 2 * time.Minute, ltp: 10600},
+		{name: "near upper circuit", offset: 3 * time.Minute, ltp: 10900, want: []want{{NearUpperCircuit, 110, 0.90909}}},
+		{name: "back inside", offset: 4 * time.Minute, ltp: 10000},
+		{name: "again within the cooldown", offset: 5 * time.Minute, ltp: 10950},
+		{name: "back inside after the cooldown", offset: 10 * time.Minute, ltp: 10000},
+		{name: "again after the cooldown", offset: 11 * time.Minute, ltp: 10920, want: []want{{NearUpperCircuit, 110, 0.72727}, {High52WeekBreakout, 105, -4}}},
+		{name: "52 week breakdown", offset: 12 * time.Minute, ltp: 9400, want: []want{{Low52WeekBreakdown, 95, -1.05263}}},
+		{name: "near lower circuit", offset: 13 * time.Minute, ltp: 9050, want: []want{{NearLowerCircuit, 90, 0.55556}}},
+		{name: "lower circuit crossed", offset: 14 * time.Minute, ltp: 8950},
+		{name: "no trade price", offset: 15 * time.Minute, ltp: 0},
+	}
+
+	var raised int
+	alerter := NewAlerter(AlertConfig{OnAlert: func(Alert) { raised++ }})
+	alerter.HandleUpperCircuit(encode(t, connector.UpperCircuitData{InstrumentId: 2885, UpperCircuit: 11000, PriceDivisor: 100}), "nseeq")
+	alerter.HandleLowerCircuit(encode(t, connector.LowerCircuitData{InstrumentId: 2885, LowerCircuit: 9000, PriceDivisor: 100}), "nseeq")
+	alerter.HandleHigh52Week(encode(t, connector.High52WeekData{InstrumentId: 2885, High52Week: 10500, PriceDivisor: 100}), "nseeq")
+	alerter.HandleLow52Week(encode(t, connector.Low52WeekData{InstrumentId: 2885, Low52Week: 9500, PriceDivisor: 100}), "nseeq/2885")
+
+	expected := 0
+	for _, test := range tests {
+		at := session.Add(test.offset)
+		alerts := alerter.Check("nseeq/2885", mwTick(at, test.ltp, 1000, 10))
+		if len(alerts) != len(test.want) {
+			t.Errorf("%s: alerts %+v, want %+v", test.name, alerts, test.want)
+			continue
+		}
+		for i, alert := range alerts {
+			want := test.want[i]
+			if alert.Kind != want.kind || alert.Level != want.level || math.Abs(alert.Distance-want.distance) > 1e-4 ||
+				alert.Topic != "nseeq/2885" || !alert.Time.Equal(at) || alert.Price != float64(test.ltp)/100 {
+				t.Errorf("%s: alert %+v, want %+v", test.name, alert, want)
+			}
+		}
+		expected += len(test.want)
+	}
+	if raised != expected {
+		t.Errorf("OnAlert called %d times, want %d", raised, expected)
+	}
+}
+
+func TestAlerterConfig(t *testing.T) {
+	var alerts []Alert
+	alerter := NewAlerter(AlertConfig{
+		CircuitProximityPercent: 5,
+		Cooldown:                time.Second,
+		OnAlert:                 func(alert Alert) { alerts = append(alerts, alert) },
+	})
+	alerter.HandleUpperCircuit(encode(t, connector.UpperCircuitData{InstrumentId: 2885, UpperCircuit: 11000, PriceDivisor: 100}), "nseeq")
+	alerter.HandleUpperCircuit(encode(t, connector.UpperCircuitData{InstrumentId: 1594, UpperCircuit: 20000, PriceDivisor: 100}), "nseeq")
+
+	for i, ltp := range []int32{10500, 10000, 10500} {
+		payload := encode(t, mwTick(session.Add(time.Duration(i)*time.Second), ltp, 1000, 10))
+		alerter.HandleMW(payload, "nseeq/2885")
+		alerter.HandleMW(payload, "nseeq/1594")
+		alerter.HandleMW(payload[:7], "nseeq/2885")
+	}
+
+	// 105 is within 5% of the upper circuit of 2885 only, and raises again once the
+	// cooldown of one second has passed.
+	if len(alerts) != 2 {
+		t.Fatalf("alerts %+v, want two", alerts)
+	}
+	for i, alert := range alerts {
+		if alert.Kind != NearUpperCircuit || alert.Topic != "nseeq/2885" || !alert.Time.Equal(session.Add(time.Duration(2*i)*time.Second)) {
+			t.Errorf("alert %d is %+v", i, alert)
+		}
+	}
+}
+
+func TestAlertKindString(t *testing.T) {
+	names := map[AlertKind]string{}
+	for _, kind := range []AlertKind{NearUpperCircuit, NearLowerCircuit, High52WeekBreakout, Low52WeekBreakdown, 0} {
+		names[kind] = kind.String()
+	}
+	want := map[AlertKind]string{
+		NearUpperCircuit:   "near upper circuit",
+		NearLowerCircuit:   "near lower circuit",
+		High52WeekBreakout: "52 week high breakout",
+		Low52WeekBreakdown: "52 week low breakdown",
+		0:                  "AlertKind(0)",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names %v, want %v", names, want)
+	}
+}
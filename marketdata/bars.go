@@ -0,0 +1,282 @@
+// Package marketdata derives views and analytics from the decoded market feeds:
+// candles, order books, trade prints, stream health, alerts, open interest and rolling
+// statistics.
+package marketdata
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Bar is an OHLCV candle of one instrument.
+type Bar struct {
+	Topic    string
+	Interval time.Duration
+	// Start is the start of the bar, aligned to the session start in exchange time.
+	Start time.Time
+	Open  float64
+	High  float64
+	Low   float64
+	Close float64
+	// Volume is the sum of the increases of the cumulative TradedVolume in the bar. The
+	// first tick of an instrument only contributes its LastTradedQuantity.
+	Volume uint64
+	// Ticks is the number of trades seen in the bar.
+	Ticks int
+
+	first time.Time
+	last  time.Time
+}
+
+// End returns the end of the bar, exclusive.
+func (b Bar) End() time.Time {
+	return b.Start.Add(b.Interval)
+}
+
+// BarConfig configures a BarBuilder.
+type BarConfig struct {
+	// Intervals are the bar intervals to build. Defaults to one minute.
+	Intervals []time.Duration
+	// SessionStart is the time of day the bars are aligned to. Defaults to 9:15.
+	SessionStart time.Duration
+	// Location is the time zone of SessionStart. Defaults to connector.IST.
+	Location *time.Location
+	// Lateness keeps a bar open for this long after its end to accept late ticks.
+	// Ticks older than the open bars are dropped and counted in BarStats.Late.
+	Lateness time.Duration
+	// OnBar is called with each completed bar.
+	OnBar func(Bar)
+	// Bars receives each completed bar. The receiver must keep up, as the send blocks.
+	Bars chan<- Bar
+}
+
+// BarStats counts the ticks seen by a BarBuilder.
+type BarStats struct {
+	Ticks     uint64
+	Late      uint64
+	Malformed uint64
+}
+
+// BarBuilder aggregates MarketWatch ticks into bars per instrument. Ticks are placed by
+// their LastTradedTime, so snapshots without a new trade do not move the bars.
+// Empty intervals produce no bar.
+//
+//	builder := marketdata.NewBarBuilder(marketdata.BarConfig{
+//		Intervals: []time.Duration{time.Minute, 5 * time.Minute},
+//		OnBar: func(bar marketdata.Bar) {
+//			fmt.Println(bar.Topic, bar.Start, bar.Open, bar.High, bar.Low, bar.Close, bar.Volume)
+//		},
+//	})
+//	conn.MWHandler = builder.Handle
+type BarBuilder struct {
+	config BarConfig
+
+	mu          sync.Mutex
+	instruments map[string]*barSeries
+	stats       BarStats
+}
+
+type barSeries struct {
+	volume   uint32
+	lastTime time.Time
+	// open holds the open bars of each interval by start time.
+	open map[time.Duration][]*Bar
+}
+
+// NewBarBuilder returns a bar builder.
+func NewBarBuilder(config BarConfig) *BarBuilder {
+	if len(config.Intervals) == 0 {
+		config.Intervals = []time.Duration{time.Minute}
+	}
+	if config.SessionStart == 0 {
+		config.SessionStart = 9*time.Hour + 15*time.Minute
+	}
+	if config.Location == nil {
+		config.Location = connector.IST
+	}
+	return &BarBuilder{config: config, instruments: map[string]*barSeries{}}
+}
+
+// Handle decodes a MarketWatch payload and adds it. It has the signature of the
+// Connect handler fields, so that it can be set as MWHandler.
+func (b *BarBuilder) Handle(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		b.mu.Lock()
+		b.stats.Malformed++
+		b.mu.Unlock()
+		return
+	}
+	b.Add(topic, &tick)
+}
+
+// Add adds a decoded MarketWatch tick of the topic, e.g. "nseeq/2885".
+func (b *BarBuilder) Add(topic string, tick *connector.MWBOCombined) {
+	if tick.LastTradedTime == 0 {
+		return
+	}
+	at := tick.TradedAt()
+	price := tick.Price(tick.Ltp)
+
+	b.mu.Lock()
+	series := b.instruments[topic]
+	if series == nil {
+		series = &barSeries{open: map[time.Duration][]*Bar{}}
+		b.instruments[topic] = series
+	}
+	if at.Equal(series.lastTime) && tick.TradedVolume == series.volume {
+		// A quote update repeating the last trade.
+		b.mu.Unlock()
+		return
+	}
+	b.stats.Ticks++
+
+	now := at
+	if now.Before(series.lastTime) {
+		now = series.lastTime
+	}
+	var volume uint64
+	if series.lastTime.IsZero() {
+		// The volume traded before the first tick belongs to earlier bars.
+		volume = uint64(min(tick.LastTradedQuantity, tick.TradedVolume))
+		series.volume = tick.TradedVolume
+	} else if tick.TradedVolume > series.volume {
+		volume = uint64(tick.TradedVolume - series.volume)
+		series.volume = tick.TradedVolume
+	} else if tick.TradedVolume < series.volume && !at.Before(series.lastTime) {
+		// The cumulative volume restarted, e.g. on a new session.
+		volume = uint64(tick.TradedVolume)
+		series.volume = tick.TradedVolume
+	}
+	series.lastTime = now
+
+	var completed []Bar
+	late := false
+	for _, interval := range b.config.Intervals {
+		var bars []*Bar
+		completed, bars = b.closeBars(completed, series.open[interval], now)
+		start := b.barStart(at, interval)
+		if !now.Before(start.Add(interval + b.config.Lateness)) {
+			late = true
+			series.open[interval] = bars
+			continue
+		}
+
+		var bar *Bar
+		for _, open := range bars {
+			if open.Start.Equal(start) {
+				bar = open
+				break
+			}
+		}
+		if bar == nil {
+			bar = &Bar{Topic: topic, Interval: interval, Start: start, Open: price, High: price, Low: price, Close: price, first: at, last: at}
+			bars = append(bars, bar)
+			sort.Slice(bars, func(i, j int) bool { return bars[i].Start.Before(bars[j].Start) })
+		}
+		if price > bar.High {
+			bar.High = price
+		}
+		if price < bar.Low {
+			bar.Low = price
+		}
+		if at.Before(bar.first) {
+			bar.Open = price
+			bar.first = at
+		}
+		if !at.Before(bar.last) {
+			bar.Close = price
+			bar.last = at
+		}
+		bar.Volume += volume
+		bar.Ticks++
+		series.open[interval] = bars
+	}
+	if late {
+		b.stats.Late++
+	}
+	b.mu.Unlock()
+
+	b.emit(completed)
+}
+
+// Flush completes the bars that can no longer receive ticks at the given time, i.e.
+// those that ended more than Lateness before it. Call it periodically to complete bars
+// of instruments that stopped trading.
+func (b *BarBuilder) Flush(now time.Time) {
+	var completed []Bar
+	b.mu.Lock()
+	for _, series := range b.instruments {
+		for interval, bars := range series.open {
+			completed, series.open[interval] = b.closeBars(completed, bars, now)
+		}
+	}
+	b.mu.Unlock()
+
+	sort.Slice(completed, func(i, j int) bool {
+		if !completed[i].Start.Equal(completed[j].Start) {
+			return completed[i].Start.Before(completed[j].Start)
+		}
+		return completed[i].Topic < completed[j].Topic
+	})
+	b.emit(completed)
+}
+
+// Current returns the open bar of the topic and interval with the latest start.
+func (b *BarBuilder) Current(topic string, interval time.Duration) (Bar, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	series := b.instruments[topic]
+	if series == nil || len(series.open[interval]) == 0 {
+		return Bar{}, false
+	}
+	bars := series.open[interval]
+	return *bars[len(bars)-1], true
+}
+
+// Stats returns the tick counters of the builder.
+func (b *BarBuilder) Stats() BarStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// barStart aligns a time to the bar interval, counting from the session start of its day.
+func (b *BarBuilder) barStart(at time.Time, interval time.Duration) time.Time {
+	local := at.In(b.config.Location)
+	year, month, day := local.Date()
+	origin := time.Date(year, month, day, 0, 0, 0, 0, b.config.Location).Add(b.config.SessionStart)
+	offset := local.Sub(origin)
+	steps := offset / interval
+	if offset < 0 && offset%interval != 0 {
+		steps--
+	}
+	return origin.Add(steps * interval)
+}
+
+// closeBars moves the bars that ended more than Lateness before now to completed.
+func (b *BarBuilder) closeBars(completed []Bar, bars []*Bar, now time.Time) ([]Bar, []*Bar) {
+	kept := bars[:0]
+	for _, bar := range bars {
+		if !now.Before(bar.End().Add(b.config.Lateness)) {
+			completed = append(completed, *bar)
+		} else {
+			kept = append(kept, bar)
+		}
+	}
+	return completed, kept
+}
+
+func (b *BarBuilder) emit(completed []Bar) {
+	for _, bar := range completed {
+		if b.config.OnBar != nil {
+			b.config.OnBar(bar)
+		}
+		if b.config.Bars != nil {
+			b.config.Bars <- bar
+		}
+	}
+}
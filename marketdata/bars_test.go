@@ -0,0 +1,206 @@
+package marketdata
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+var session = time.Date(2024, 10, 18, 9, 15, 0, 0, connector.IST)
+
+// mwTick returns a MarketWatch tick traded at the time, with prices in paise.
+func mwTick(at time.Time, ltp int32, volume uint32, quantity uint32) *connector.MWBOCombined {
+	return &connector.MWBOCombined{
+		Ltp:                ltp,
+		LastTradedQuantity: quantity,
+		TradedVolume:       volume,
+		PriceDivisor:       100,
+		LastTradedTime:     int32(at.Sub(connector.ExchangeEpoch) / time.Second),
+	}
+}
+
+func TestBarStart(t *testing.T) {
+	builder := NewBarBuilder(BarConfig{})
+	tests := []struct {
+		at       time.Time
+		interval time.Duration
+		want     time.Time
+	}{
+		{session, time.Minute, session},
+		{session.Add(59 * time.Second), time.Minute, session},
+		{session.Add(2*time.Minute + 30*time.Second), 5 * time.Minute, session},
+		{session.Add(5 * time.Minute), 5 * time.Minute, session.Add(5 * time.Minute)},
+		{session.Add(59 * time.Minute), time.Hour, session},
+		{session.Add(6*time.Hour + 14*time.Minute), 15 * time.Minute, session.Add(6 * time.Hour)},
+		// Pre-open ticks are aligned backwards from the session start.
+		{session.Add(-time.Second), 5 * time.Minute, session.Add(-5 * time.Minute)},
+		{session.Add(-5 * time.Minute), 5 * time.Minute, session.Add(-5 * time.Minute)},
+		// The alignment is in exchange time whatever the zone of the tick.
+		{session.UTC().Add(90 * time.Second), time.Minute, session.Add(time.Minute)},
+	}
+	for _, test := range tests {
+		if got := builder.barStart(test.at, test.interval); !got.Equal(test.want) {
+			t.Errorf("barStart(%v, %v) = %v, want %v", test.at, test.interval, got, test.want)
+		}
+	}
+}
+
+func TestBarBuilder(t *testing.T) {
+	type tick struct {
+		offset   time.Duration
+		ltp      int32
+		volume   uint32
+		quantity uint32
+	}
+	tests := []struct {
+		name     string
+		lateness time.Duration
+		ticks    []tick
+		flush    time.Duration
+		want     []Bar
+		stats    BarStats
+	}{
+		{
+			name: "closed by the next bar",
+			ticks: []tick{
+				{10 * time.Second, 10000, 1000, 10},
+				{30 * time.Second, 10150, 1050, 50},
+				{30 * time.Second, 10150, 1050, 50},
+				{50 * time.Second, 9900, 1060, 10},
+				{65 * time.Second, 10050, 1100, 40},
+			},
+			want: []Bar{
+				{Start: session, Open: 100, High: 101.5, Low: 99, Close: 99, Volume: 70, Ticks: 3},
+			},
+			stats: BarStats{Ticks: 4},
+		},
+		{
+			name: "late tick dropped",
+			ticks: []tick{
+				{10 * time.Second, 10000, 1000, 10},
+				{65 * time.Second, 10050, 1100, 100},
+				{55 * time.Second, 9800, 1120, 20},
+			},
+			flush: 2 * time.Minute,
+			want: []Bar{
+				{Start: session, Open: 100, High: 100, Low: 100, Close: 100, Volume: 10, Ticks: 1},
+				{Start: session.Add(time.Minute), Open: 100.5, High: 100.5, Low: 100.5, Close: 100.5, Volume: 100, Ticks: 1},
+			},
+			stats: BarStats{Ticks: 3, Late: 1},
+		},
+		{
+			name:     "late tick within lateness",
+			lateness: 10 * time.Second,
+			ticks: []tick{
+				{10 * time.Second, 10000, 1000, 10},
+				{65 * time.Second, 10050, 1100, 100},
+				{55 * time.Second, 9800, 1120, 20},
+				{5 * time.Second, 10200, 1120, 20},
+			},
+			flush: 70 * time.Second,
+			want: []Bar{
+				{Start: session, Open: 102, High: 102, Low: 98, Close: 98, Volume: 30, Ticks: 3},
+			},
+			stats: BarStats{Ticks: 4},
+		},
+		{
+			name: "flush before the end",
+			ticks: []tick{
+				{10 * time.Second, 10000, 1000, 10},
+			},
+			flush: 59 * time.Second,
+			stats: BarStats{Ticks: 1},
+		},
+		{
+			name: "volume restart",
+			ticks: []tick{
+				{6*time.Hour + 14*time.Minute, 10000, 5000, 5},
+				{24*time.Hour + 5*time.Second, 10100, 200, 200},
+				{24*time.Hour + 10*time.Second, 10200, 250, 50},
+			},
+			flush: 24*time.Hour + time.Minute,
+			want: []Bar{
+				{Start: session.Add(6*time.Hour + 14*time.Minute), Open: 100, High: 100, Low: 100, Close: 100, Volume: 5, Ticks: 1},
+				{Start: session.Add(24 * time.Hour), Open: 101, High: 102, Low: 101, Close: 102, Volume: 250, Ticks: 2},
+			},
+			stats: BarStats{Ticks: 3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []Bar
+			builder := NewBarBuilder(BarConfig{
+				Lateness: test.lateness,
+				OnBar: func(bar Bar) {
+					bar.first, bar.last = time.Time{}, time.Time{}
+					got = append(got, bar)
+				},
+			})
+			for _, tick := range test.ticks {
+				builder.Add("nseeq/2885", mwTick(session.Add(tick.offset), tick.ltp, tick.volume, tick.quantity))
+			}
+			if test.flush != 0 {
+				builder.Flush(session.Add(test.flush))
+			}
+
+			for i := range test.want {
+				test.want[i].Topic = "nseeq/2885"
+				test.want[i].Interval = time.Minute
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("bars\n%+v\nwant\n%+v", got, test.want)
+			}
+			if stats := builder.Stats(); stats != test.stats {
+				t.Errorf("stats %+v, want %+v", stats, test.stats)
+			}
+		})
+	}
+}
+
+func TestBarBuilderIntervals(t *testing.T) {
+	bars := make(chan Bar, 10)
+	builder := NewBarBuilder(BarConfig{Intervals: []time.Duration{time.Minute, 5 * time.Minute}, Bars: bars})
+	for i := 0; i < 6; i++ {
+		builder.Add("nseeq/2885", mwTick(session.Add(time.Duration(i)*time.Minute), 10000+int32(i)*10, 1000+uint32(i)*10, 10))
+	}
+
+	if len(bars) != 6 {
+		t.Fatalf("%d completed bars, want 5 one-minute bars and one five-minute bar", len(bars))
+	}
+	var five Bar
+	for len(bars) > 0 {
+		if bar := <-bars; bar.Interval == 5*time.Minute {
+			five = bar
+		}
+	}
+	if !five.Start.Equal(session) || five.Open != 100 || five.Close != 100.4 || five.Volume != 50 || five.Ticks != 5 {
+		t.Errorf("five-minute bar %+v", five)
+	}
+
+	current, ok := builder.Current("nseeq/2885", 5*time.Minute)
+	if !ok || !current.Start.Equal(session.Add(5*time.Minute)) || current.Close != 100.5 {
+		t.Errorf("Current = %+v, %v; want the bar of 9:20", current, ok)
+	}
+	if _, ok := builder.Current("nseeq/1594", time.Minute); ok {
+		t.Error("Current of an unknown topic is ok")
+	}
+}
+
+func TestBarBuilderHandle(t *testing.T) {
+	builder := NewBarBuilder(BarConfig{})
+	payload, err := connector.EncodeFeed(mwTick(session, 10000, 10, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.Handle(payload, "nseeq/2885")
+	builder.Handle(payload[:10], "nseeq/2885")
+
+	if stats := builder.Stats(); stats != (BarStats{Ticks: 1, Malformed: 1}) {
+		t.Errorf("stats %+v, want one tick and one malformed payload", stats)
+	}
+	if bar, ok := builder.Current("nseeq/2885", time.Minute); !ok || bar.Close != 100 {
+		t.Errorf("Current = %+v, %v", bar, ok)
+	}
+}
@@ -0,0 +1,276 @@
+package marketdata
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// AnomalyKind is the kind of an anomaly detected on a MarketWatch stream.
+type AnomalyKind int
+
+const (
+	// TimeRegression is a LastTradedTime older than the one of the previous snapshot.
+	TimeRegression AnomalyKind = iota + 1
+	// VolumeRegression is a cumulative TradedVolume lower than the previous one of the
+	// same exchange day.
+	VolumeRegression
+	// DuplicatePayload is a payload identical to the previous one of the topic.
+	DuplicatePayload
+	// OutsideLpp is a last traded price outside the LPP band of the instrument.
+	OutsideLpp
+	// OutsideCircuit is a last traded price outside the circuit limits of the instrument.
+	OutsideCircuit
+	// PriceJump is a move of the last traded price larger than MonitorConfig.MaxJumpPercent.
+	PriceJump
+)
+
+var anomalyKindNames = map[AnomalyKind]string{
+	TimeRegression:   "time regression",
+	VolumeRegression: "volume regression",
+	DuplicatePayload: "duplicate payload",
+	OutsideLpp:       "outside lpp",
+	OutsideCircuit:   "outside circuit",
+	PriceJump:        "price jump",
+}
+
+// String returns the name of the kind, e.g. "time regression".
+func (k AnomalyKind) String() string {
+	if name, ok := anomalyKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("AnomalyKind(%d)", int(k))
+}
+
+// Anomaly is one anomaly detected on the stream of a topic.
+type Anomaly struct {
+	Kind  AnomalyKind
+	Topic string
+	// Time is the LastTradedTime of the snapshot.
+	Time    time.Time
+	Message string
+}
+
+// MonitorConfig configures a StreamMonitor.
+type MonitorConfig struct {
+	// MaxJumpPercent reports a PriceJump when the last traded price moves by more than
+	// this percentage between two snapshots. Zero disables the check.
+	MaxJumpPercent float64
+	// OnAnomaly is called with each anomaly.
+	OnAnomaly func(Anomaly)
+}
+
+// StreamMonitor detects lost, repeated and implausible ticks on MarketWatch streams.
+// Price bands are checked when the LPP and circuit feeds of the instruments are also
+// passed to the monitor.
+//
+//	monitor := marketdata.NewStreamMonitor(marketdata.MonitorConfig{
+//		MaxJumpPercent: 5,
+//		OnAnomaly: func(anomaly marketdata.Anomaly) {
+//			fmt.Println(anomaly.Topic, anomaly.Kind, anomaly.Message)
+//		},
+//	})
+//	conn.MWHandler = monitor.HandleMW
+//	conn.LppHandler = monitor.HandleLpp
+//	conn.UpperCircuitHandler = monitor.HandleUpperCircuit
+//	conn.LowerCircuitHandler = monitor.HandleLowerCircuit
+type StreamMonitor struct {
+	config MonitorConfig
+
+	mu        sync.Mutex
+	streams   map[string]*streamState
+	lpp       map[string]connector.LppData
+	upper     map[string]float64
+	lower     map[string]float64
+	counts    map[AnomalyKind]uint64
+	byTopic   map[string]map[AnomalyKind]uint64
+	snapshots uint64
+}
+
+type streamState struct {
+	lastTradedTime int32
+	volume         uint32
+	ltp            float64
+	hash           uint64
+}
+
+// NewStreamMonitor returns a stream monitor.
+func NewStreamMonitor(config MonitorConfig) *StreamMonitor {
+	return &StreamMonitor{
+		config:  config,
+		streams: map[string]*streamState{},
+		lpp:     map[string]connector.LppData{},
+		upper:   map[string]float64{},
+		lower:   map[string]float64{},
+		counts:  map[AnomalyKind]uint64{},
+		byTopic: map[string]map[AnomalyKind]uint64{},
+	}
+}
+
+// HandleMW checks a MarketWatch payload. It has the signature of the Connect handler
+// fields, so that it can be set as MWHandler.
+func (m *StreamMonitor) HandleMW(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	hash := fnv.New64a()
+	hash.Write(payload)
+	m.check(topic, &tick, hash.Sum64())
+}
+
+// HandleLpp records the LPP band of the topic, e.g. "nseeq/2885".
+func (m *StreamMonitor) HandleLpp(payload []byte, topic string) {
+	data, err := connector.DecodeLpp(payload)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	m.lpp[topic] = data
+	m.mu.Unlock()
+}
+
+// HandleUpperCircuit records the upper circuit limit carried by the payload.
+func (m *StreamMonitor) HandleUpperCircuit(payload []byte, topic string) {
+	data, err := connector.DecodeUpperCircuit(payload)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	m.upper[connector.InstrumentTopic(topic, data.InstrumentId)] = data.Price()
+	m.mu.Unlock()
+}
+
+// HandleLowerCircuit records the lower circuit limit carried by the payload.
+func (m *StreamMonitor) HandleLowerCircuit(payload []byte, topic string) {
+	data, err := connector.DecodeLowerCircuit(payload)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	m.lower[connector.InstrumentTopic(topic, data.InstrumentId)] = data.Price()
+	m.mu.Unlock()
+}
+
+// Check checks a decoded MarketWatch snapshot of the topic and returns its anomalies.
+// Duplicate payloads are only detected by HandleMW.
+func (m *StreamMonitor) Check(topic string, tick *connector.MWBOCombined) []Anomaly {
+	return m.check(topic, tick, 0)
+}
+
+// Counts returns the number of anomalies of each kind over all topics.
+func (m *StreamMonitor) Counts() map[AnomalyKind]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[AnomalyKind]uint64, len(m.counts))
+	for kind, count := range m.counts {
+		counts[kind] = count
+	}
+	return counts
+}
+
+// TopicCounts returns the number of anomalies of each kind on the topic.
+func (m *StreamMonitor) TopicCounts(topic string) map[AnomalyKind]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[AnomalyKind]uint64, len(m.byTopic[topic]))
+	for kind, count := range m.byTopic[topic] {
+		counts[kind] = count
+	}
+	return counts
+}
+
+// Snapshots returns the number of MarketWatch snapshots checked.
+func (m *StreamMonitor) Snapshots() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshots
+}
+
+func (m *StreamMonitor) check(topic string, tick *connector.MWBOCombined, hash uint64) []Anomaly {
+	var anomalies []Anomaly
+	report := func(kind AnomalyKind, format string, args ...interface{}) {
+		anomalies = append(anomalies, Anomaly{Kind: kind, Topic: topic, Time: tick.TradedAt(), Message: fmt.Sprintf(format, args...)})
+	}
+	ltp := tick.Price(tick.Ltp)
+
+	m.mu.Lock()
+	m.snapshots++
+	state, known := m.streams[topic]
+	if !known {
+		state = &streamState{}
+		m.streams[topic] = state
+	}
+
+	newDay := known && laterDay(tick.LastTradedTime, state.lastTradedTime)
+	if known {
+		if hash != 0 && hash == state.hash {
+			report(DuplicatePayload, "payload repeated")
+		}
+		if tick.LastTradedTime < state.lastTradedTime {
+			report(TimeRegression, "last traded time went back from %s to %s",
+				connector.ExchangeEpoch.Add(time.Duration(state.lastTradedTime)*time.Second).In(connector.IST).Format(time.TimeOnly),
+				tick.TradedAt().In(connector.IST).Format(time.TimeOnly))
+		}
+		if tick.TradedVolume < state.volume && !newDay {
+			report(VolumeRegression, "traded volume went down from %d to %d", state.volume, tick.TradedVolume)
+		}
+		if m.config.MaxJumpPercent > 0 && state.ltp > 0 && tick.Ltp > 0 {
+			if move := math.Abs(ltp-state.ltp) / state.ltp * 100; move > m.config.MaxJumpPercent {
+				report(PriceJump, "last traded price moved %.2f%% from %v to %v", move, state.ltp, ltp)
+			}
+		}
+	}
+	if tick.Ltp > 0 {
+		if lpp, ok := m.lpp[topic]; ok {
+			if low, high := lpp.Range(); ltp < low || ltp > high {
+				report(OutsideLpp, "last traded price %v outside lpp band %v - %v", ltp, low, high)
+			}
+		}
+		if upper, ok := m.upper[topic]; ok && upper > 0 && ltp > upper {
+			report(OutsideCircuit, "last traded price %v above upper circuit %v", ltp, upper)
+		}
+		if lower, ok := m.lower[topic]; ok && ltp < lower {
+			report(OutsideCircuit, "last traded price %v below lower circuit %v", ltp, lower)
+		}
+	}
+
+	// A regressed snapshot is reported once and does not become the reference, so that
+	// the snapshots after it are compared with the latest good one.
+	if !known || (tick.LastTradedTime >= state.lastTradedTime && (tick.TradedVolume >= state.volume || newDay)) {
+		state.lastTradedTime = tick.LastTradedTime
+		state.volume = tick.TradedVolume
+		if tick.Ltp > 0 {
+			state.ltp = ltp
+		}
+	}
+	state.hash = hash
+	for _, anomaly := range anomalies {
+		m.counts[anomaly.Kind]++
+		if m.byTopic[topic] == nil {
+			m.byTopic[topic] = map[AnomalyKind]uint64{}
+		}
+		m.byTopic[topic][anomaly.Kind]++
+	}
+	m.mu.Unlock()
+
+	if m.config.OnAnomaly != nil {
+		for _, anomaly := range anomalies {
+			m.config.OnAnomaly(anomaly)
+		}
+	}
+	return anomalies
+}
+
+// laterDay reports whether the LastTradedTime a falls on a later exchange day than b.
+func laterDay(a int32, b int32) bool {
+	day := func(seconds int32) time.Time {
+		year, month, date := connector.ExchangeEpoch.Add(time.Duration(seconds) * time.Second).In(connector.IST).Date()
+		return time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+	}
+	return day(a).After(day(b))
+}
@@ -0,0 +1,137 @@
+package marketdata
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func encode(t *testing.T, data interface{}) []byte {
+	t.Helper()
+	payload, err := connector.EncodeFeed(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func kinds(anomalies []Anomaly) []AnomalyKind {
+	var result []AnomalyKind
+	for _, anomaly := range anomalies {
+		result = append(result, anomaly.Kind)
+	}
+	return result
+}
+
+func TestStreamMonitor(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+		ltp    int32
+		volume uint32
+		want   []AnomalyKind
+	}{
+		{name: "first", offset: 0, ltp: 10000, volume: 1000},
+		{name: "next", offset: time.Second, ltp: 10100, volume: 1010},
+		{name: "stale", offset: -5 * time.Second, ltp: 9500, volume: 900, want: []AnomalyKind{TimeRegression, VolumeRegression, PriceJump}},
+		// Compared with the snapshot before the stale one.
+		{name: "after stale", offset: 2 * time.Second, ltp: 10150, volume: 1020},
+		{name: "volume regression", offset: 3 * time.Second, ltp: 10150, volume: 1015, want: []AnomalyKind{VolumeRegression}},
+		{name: "no trade price", offset: 4 * time.Second, ltp: 0, volume: 1020},
+		{name: "jump after no trade price", offset: 5 * time.Second, ltp: 11000, volume: 1030, want: []AnomalyKind{PriceJump}},
+		{name: "new day", offset: 24 * time.Hour, ltp: 11000, volume: 50},
+		{name: "next on new day", offset: 24*time.Hour + time.Second, ltp: 11010, volume: 60},
+		{name: "regression on new day", offset: 24*time.Hour + 2*time.Second, ltp: 11010, volume: 55, want: []AnomalyKind{VolumeRegression}},
+	}
+
+	var reported []AnomalyKind
+	monitor := NewStreamMonitor(MonitorConfig{
+		MaxJumpPercent: 5,
+		OnAnomaly:      func(anomaly Anomaly) { reported = append(reported, anomaly.Kind) },
+	})
+	var all []AnomalyKind
+	for _, test := range tests {
+		at := session.Add(test.offset)
+		anomalies := monitor.Check("nseeq/2885", mwTick(at, test.ltp, test.volume, 10))
+		if got := kinds(anomalies); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: anomalies %v, want %v", test.name, got, test.want)
+		}
+		for _, anomaly := range anomalies {
+			if anomaly.Topic != "nseeq/2885" || !anomaly.Time.Equal(at) || anomaly.Message == "" {
+				t.Errorf("%s: anomaly %+v", test.name, anomaly)
+			}
+		}
+		all = append(all, test.want...)
+	}
+
+	if !reflect.DeepEqual(reported, all) {
+		t.Errorf("OnAnomaly called with %v, want %v", reported, all)
+	}
+	want := map[AnomalyKind]uint64{TimeRegression: 1, VolumeRegression: 3, PriceJump: 2}
+	if counts := monitor.Counts(); !reflect.DeepEqual(counts, want) {
+		t.Errorf("Counts = %v, want %v", counts, want)
+	}
+	if counts := monitor.TopicCounts("nseeq/2885"); !reflect.DeepEqual(counts, want) {
+		t.Errorf("TopicCounts = %v, want %v", counts, want)
+	}
+	if snapshots := monitor.Snapshots(); snapshots != uint64(len(tests)) {
+		t.Errorf("Snapshots = %d, want %d", snapshots, len(tests))
+	}
+}
+
+func TestStreamMonitorBands(t *testing.T) {
+	monitor := NewStreamMonitor(MonitorConfig{})
+	monitor.HandleLpp(encode(t, connector.LppData{LppLow: 9500, LppHigh: 10500, PriceDivisor: 100}), "nseeq/2885")
+	monitor.HandleUpperCircuit(encode(t, connector.UpperCircuitData{InstrumentId: 2885, UpperCircuit: 10400, PriceDivisor: 100}), "nseeq")
+	monitor.HandleLowerCircuit(encode(t, connector.LowerCircuitData{InstrumentId: 2885, LowerCircuit: 9600, PriceDivisor: 100}), "nseeq")
+	monitor.HandleUpperCircuit(encode(t, connector.UpperCircuitData{InstrumentId: 1594, UpperCircuit: 100, PriceDivisor: 100}), "nseeq")
+
+	tests := []struct {
+		ltp  int32
+		want []AnomalyKind
+	}{
+		{10000, nil},
+		{10450, []AnomalyKind{OutsideCircuit}},
+		{10600, []AnomalyKind{OutsideLpp, OutsideCircuit}},
+		{9550, []AnomalyKind{OutsideCircuit}},
+		{9400, []AnomalyKind{OutsideLpp, OutsideCircuit}},
+		{0, nil},
+	}
+	for i, test := range tests {
+		anomalies := monitor.Check("nseeq/2885", mwTick(session.Add(time.Duration(i)*time.Second), test.ltp, uint32(1000+i), 1))
+		if got := kinds(anomalies); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ltp %d: anomalies %v, want %v", test.ltp, got, test.want)
+		}
+	}
+}
+
+func TestStreamMonitorDuplicates(t *testing.T) {
+	monitor := NewStreamMonitor(MonitorConfig{})
+	payload := encode(t, mwTick(session, 10000, 1000, 10))
+	monitor.HandleMW(payload, "nseeq/2885")
+	monitor.HandleMW(payload, "nseeq/2885")
+	monitor.HandleMW(payload, "nseeq/1594")
+	monitor.HandleMW(payload[:5], "nseeq/2885")
+	monitor.Check("nseeq/2885", mwTick(session, 10000, 1000, 10))
+
+	if counts := monitor.TopicCounts("nseeq/2885"); !reflect.DeepEqual(counts, map[AnomalyKind]uint64{DuplicatePayload: 1}) {
+		t.Errorf("TopicCounts = %v, want one duplicate payload", counts)
+	}
+	if counts := monitor.TopicCounts("nseeq/1594"); len(counts) != 0 {
+		t.Errorf("TopicCounts of another topic = %v", counts)
+	}
+	if snapshots := monitor.Snapshots(); snapshots != 4 {
+		t.Errorf("Snapshots = %d, want 4 without the malformed payload", snapshots)
+	}
+}
+
+func TestAnomalyKindString(t *testing.T) {
+	if got := TimeRegression.String(); got != "time regression" {
+		t.Errorf("TimeRegression.String() = %q", got)
+	}
+	if got := AnomalyKind(99).String(); got != "AnomalyKind(99)" {
+		t.Errorf("AnomalyKind(99).String() = %q", got)
+	}
+}
@@ -0,0 +1,280 @@
+package marketdata
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Buildup classifies the joint move of price and open interest of a contract.
+type Buildup int
+
+const (
+	// NoBuildup is reported while the price or the open interest is unchanged.
+	NoBuildup Buildup = iota
+	// LongBuildup is a rising price with rising open interest.
+	LongBuildup
+	// ShortBuildup is a falling price with rising open interest.
+	ShortBuildup
+	// LongUnwinding is a falling price with falling open interest.
+	LongUnwinding
+	// ShortCovering is a rising price with falling open interest.
+	ShortCovering
+)
+
+var buildupNames = map[Buildup]string{
+	NoBuildup:     "none",
+	LongBuildup:   "long buildup",
+	ShortBuildup:  "short buildup",
+	LongUnwinding: "long unwinding",
+	ShortCovering: "short covering",
+}
+
+// String returns the name of the buildup, e.g. "long buildup".
+func (b Buildup) String() string {
+	if name, ok := buildupNames[b]; ok {
+		return name
+	}
+	return fmt.Sprintf("Buildup(%d)", int(b))
+}
+
+// ClassifyBuildup returns the buildup of a price change and an open interest change.
+func ClassifyBuildup(priceChange float64, oiChange int64) Buildup {
+	switch {
+	case priceChange > 0 && oiChange > 0:
+		return LongBuildup
+	case priceChange < 0 && oiChange > 0:
+		return ShortBuildup
+	case priceChange < 0 && oiChange < 0:
+		return LongUnwinding
+	case priceChange > 0 && oiChange < 0:
+		return ShortCovering
+	default:
+		return NoBuildup
+	}
+}
+
+// ContractOI is the open interest view of one contract.
+type ContractOI struct {
+	Topic        string
+	OpenInterest int32
+	PreviousOi   int32
+	DayHighOi    int32
+	DayLowOi     int32
+	// Change is the change of open interest since the previous day.
+	Change        int32
+	ChangePercent float64
+	// RatePerMinute is the intraday change of open interest per minute over the rate
+	// window, measured at the receive times of the open interest updates.
+	RatePerMinute float64
+	// Price is the last traded price and PriceChange its change since the previous
+	// close, from the MarketWatch feed.
+	Price       float64
+	PriceChange float64
+	Volume      uint32
+	// Buildup classifies the day's move of price and open interest.
+	Buildup Buildup
+	// Updated is the exchange time of the last MarketWatch tick, or the receive time of
+	// the last open interest update when no tick was seen.
+	Updated time.Time
+}
+
+// PutCallRatio aggregates the open interest and volume of the puts and calls of a chain.
+type PutCallRatio struct {
+	PutOI      int64
+	CallOI     int64
+	PutVolume  uint64
+	CallVolume uint64
+	// ByOI is PutOI / CallOI and ByVolume PutVolume / CallVolume; they are zero when the
+	// call side is zero.
+	ByOI     float64
+	ByVolume float64
+}
+
+// OIConfig configures an OITracker.
+type OIConfig struct {
+	// RateWindow is the period over which RatePerMinute is measured. Defaults to five
+	// minutes.
+	RateWindow time.Duration
+	// Now returns the receive time of the open interest updates. Defaults to time.Now.
+	Now func() time.Time
+	// OnUpdate is called with the view of a contract on each open interest update.
+	OnUpdate func(ContractOI)
+}
+
+// OITracker interprets the Open Interest feed of each contract together with its
+// MarketWatch feed.
+//
+//	tracker := marketdata.NewOITracker(marketdata.OIConfig{
+//		OnUpdate: func(contract marketdata.ContractOI) {
+//			fmt.Println(contract.Topic, contract.Change, contract.Buildup)
+//		},
+//	})
+//	conn.OpenInterstHandler = tracker.HandleOI
+//	conn.MWHandler = tracker.HandleMW
+//
+//	chain := conn.Instruments.Derivatives("NIFTY", expiry, 0, "")
+//	pcr := tracker.PutCallRatio(chain)
+type OITracker struct {
+	config OIConfig
+
+	mu        sync.Mutex
+	contracts map[string]*contractState
+}
+
+type contractState struct {
+	ContractOI
+	samples []oiSample
+	// traded is the exchange time of the last MarketWatch tick.
+	traded time.Time
+}
+
+// maxOISamples bounds the samples kept per contract when updates arrive faster than
+// the rate window can age them out.
+const maxOISamples = 1024
+
+type oiSample struct {
+	at           time.Time
+	openInterest int32
+}
+
+// NewOITracker returns an open interest tracker.
+func NewOITracker(config OIConfig) *OITracker {
+	if config.RateWindow <= 0 {
+		config.RateWindow = 5 * time.Minute
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &OITracker{config: config, contracts: map[string]*contractState{}}
+}
+
+// HandleOI decodes an Open Interest payload and updates its contract. It has the
+// signature of the Connect handler fields, so that it can be set as OpenInterstHandler.
+func (t *OITracker) HandleOI(payload []byte, topic string) {
+	data, err := connector.DecodeOpenInterest(payload)
+	if err != nil {
+		return
+	}
+	t.UpdateOI(topic, &data)
+}
+
+// HandleMW decodes a MarketWatch payload and updates the price of its contract.
+func (t *OITracker) HandleMW(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	t.UpdateMW(topic, &tick)
+}
+
+// UpdateMW updates the price and volume of the contract.
+func (t *OITracker) UpdateMW(topic string, tick *connector.MWBOCombined) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.contract(topic)
+	state.Price = tick.Price(tick.Ltp)
+	if tick.Close > 0 {
+		state.PriceChange = tick.Price(tick.Ltp - tick.Close)
+	}
+	state.Volume = tick.TradedVolume
+	if tick.LastTradedTime != 0 {
+		state.traded = tick.TradedAt()
+		state.Updated = state.traded
+	}
+	state.Buildup = ClassifyBuildup(state.PriceChange, int64(state.Change))
+}
+
+// UpdateOI updates the open interest of the contract and returns its view.
+func (t *OITracker) UpdateOI(topic string, data *connector.OpenInterestData) ContractOI {
+	t.mu.Lock()
+	state := t.contract(topic)
+	state.OpenInterest = data.OpenInterest
+	state.PreviousOi = data.PreviousOi
+	state.DayHighOi = data.DayHighOi
+	state.DayLowOi = data.DayLowOi
+	state.Change = data.OpenInterest - data.PreviousOi
+	state.ChangePercent = 0
+	if data.PreviousOi != 0 {
+		state.ChangePercent = float64(state.Change) / float64(data.PreviousOi) * 100
+	}
+
+	// Samples use the receive time: contracts that rarely trade keep publishing open
+	// interest with the time of their last trade.
+	at := t.config.Now()
+	if state.traded.IsZero() {
+		state.Updated = at
+	}
+	state.samples = append(state.samples, oiSample{at: at, openInterest: data.OpenInterest})
+	cutoff := at.Add(-t.config.RateWindow)
+	first := max(len(state.samples)-maxOISamples, 0)
+	for first < len(state.samples)-1 && state.samples[first+1].at.Before(cutoff) {
+		first++
+	}
+	state.samples = append(state.samples[:0], state.samples[first:]...)
+	state.RatePerMinute = 0
+	if oldest := state.samples[0]; at.After(oldest.at) {
+		state.RatePerMinute = float64(data.OpenInterest-oldest.openInterest) / at.Sub(oldest.at).Minutes()
+	}
+	state.Buildup = ClassifyBuildup(state.PriceChange, int64(state.Change))
+	view := state.ContractOI
+	t.mu.Unlock()
+
+	if t.config.OnUpdate != nil {
+		t.config.OnUpdate(view)
+	}
+	return view
+}
+
+// Contract returns the view of the contract with the topic, e.g. "nsefo/54452".
+func (t *OITracker) Contract(topic string) (ContractOI, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.contracts[topic]
+	if !ok {
+		return ContractOI{}, false
+	}
+	return state.ContractOI, true
+}
+
+// PutCallRatio aggregates the tracked puts and calls among the contracts, e.g. the
+// options of one expiry returned by InstrumentMaster.Derivatives. Futures and contracts
+// without data are ignored.
+func (t *OITracker) PutCallRatio(contracts []*connector.Instrument) PutCallRatio {
+	var ratio PutCallRatio
+	t.mu.Lock()
+	for _, instrument := range contracts {
+		state, ok := t.contracts[instrument.Topic()]
+		if !ok {
+			continue
+		}
+		switch instrument.OptionType {
+		case "PE":
+			ratio.PutOI += int64(state.OpenInterest)
+			ratio.PutVolume += uint64(state.Volume)
+		case "CE":
+			ratio.CallOI += int64(state.OpenInterest)
+			ratio.CallVolume += uint64(state.Volume)
+		}
+	}
+	t.mu.Unlock()
+
+	if ratio.CallOI != 0 {
+		ratio.ByOI = float64(ratio.PutOI) / float64(ratio.CallOI)
+	}
+	if ratio.CallVolume != 0 {
+		ratio.ByVolume = float64(ratio.PutVolume) / float64(ratio.CallVolume)
+	}
+	return ratio
+}
+
+func (t *OITracker) contract(topic string) *contractState {
+	state := t.contracts[topic]
+	if state == nil {
+		state = &contractState{ContractOI: ContractOI{Topic: topic}}
+		t.contracts[topic] = state
+	}
+	return state
+}
@@ -0,0 +1,146 @@
+package marketdata
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestClassifyBuildup(t *testing.T) {
+	tests := []struct {
+		priceChange float64
+		oiChange    int64
+		want        Buildup
+	}{
+		{1.5, 100, LongBuildup},
+		{-1.5, 100, ShortBuildup},
+		{-1.5, -100, LongUnwinding},
+		{1.5, -100, ShortCovering},
+		{0, 100, NoBuildup},
+		{1.5, 0, NoBuildup},
+	}
+	for _, test := range tests {
+		if got := ClassifyBuildup(test.priceChange, test.oiChange); got != test.want {
+			t.Errorf("ClassifyBuildup(%v, %v) = %v, want %v", test.priceChange, test.oiChange, got, test.want)
+		}
+	}
+	if got := Buildup(9).String(); got != "Buildup(9)" {
+		t.Errorf("Buildup(9).String() = %q", got)
+	}
+}
+
+// clock is a settable OIConfig.Now.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestOITracker(t *testing.T) {
+	now := &clock{now: session}
+	var updates []ContractOI
+	tracker := NewOITracker(OIConfig{Now: now.Now, OnUpdate: func(contract ContractOI) { updates = append(updates, contract) }})
+
+	view := tracker.UpdateOI("nsefo/35001", &connector.OpenInterestData{OpenInterest: 1100, PreviousOi: 1000, DayHighOi: 1200, DayLowOi: 900})
+	if view.Change != 100 || view.ChangePercent != 10 || view.Buildup != NoBuildup || !view.Updated.Equal(session) || view.RatePerMinute != 0 {
+		t.Errorf("first update %+v", view)
+	}
+
+	tick := mwTick(session.Add(-time.Minute), 10500, 5000, 25)
+	tick.Close = 10000
+	tracker.UpdateMW("nsefo/35001", tick)
+	contract, ok := tracker.Contract("nsefo/35001")
+	if !ok || contract.Price != 105 || contract.PriceChange != 5 || contract.Volume != 5000 || contract.Buildup != LongBuildup || !contract.Updated.Equal(session.Add(-time.Minute)) {
+		t.Errorf("after the tick %+v, %v", contract, ok)
+	}
+
+	tests := []struct {
+		after time.Duration
+		oi    int32
+		rate  float64
+		want  Buildup
+	}{
+		{time.Minute, 1200, 100, LongBuildup},
+		{2 * time.Minute, 1000, -50, NoBuildup},
+		{3 * time.Minute, 900, -200.0 / 3, ShortCovering},
+		// The rate is measured from the last sample at or before the start of the window.
+		{6 * time.Minute, 960, -140.0 / 6, ShortCovering},
+		{7 * time.Minute, 1150, -50.0 / 6, LongBuildup},
+	}
+	for _, test := range tests {
+		now.now = session.Add(test.after)
+		view := tracker.UpdateOI("nsefo/35001", &connector.OpenInterestData{OpenInterest: test.oi, PreviousOi: 1000})
+		if math.Abs(view.RatePerMinute-test.rate) > 1e-9 || view.Buildup != test.want {
+			t.Errorf("at %v: rate %v and %v, want %v and %v", test.after, view.RatePerMinute, view.Buildup, test.rate, test.want)
+		}
+		if !view.Updated.Equal(session.Add(-time.Minute)) {
+			t.Errorf("at %v: updated %v, want the time of the last tick", test.after, view.Updated)
+		}
+	}
+	if len(updates) != len(tests)+1 {
+		t.Errorf("OnUpdate called %d times, want %d", len(updates), len(tests)+1)
+	}
+	if _, ok := tracker.Contract("nsefo/35002"); ok {
+		t.Error("Contract of an unknown topic is ok")
+	}
+}
+
+func TestOITrackerSampleCap(t *testing.T) {
+	now := &clock{now: session}
+	tracker := NewOITracker(OIConfig{Now: now.Now, RateWindow: time.Hour})
+	for i := 0; i < 3*maxOISamples; i++ {
+		now.now = session.Add(time.Duration(i) * time.Millisecond)
+		tracker.UpdateOI("nsefo/35001", &connector.OpenInterestData{OpenInterest: int32(i)})
+	}
+	state := tracker.contracts["nsefo/35001"]
+	if len(state.samples) != maxOISamples {
+		t.Errorf("%d samples, want %d", len(state.samples), maxOISamples)
+	}
+	// The oldest kept sample is maxOISamples-1 milliseconds and open interest before the last.
+	if want := float64(maxOISamples-1) / (time.Duration(maxOISamples-1) * time.Millisecond).Minutes(); math.Abs(state.RatePerMinute-want) > 1e-6 {
+		t.Errorf("rate %v, want %v", state.RatePerMinute, want)
+	}
+}
+
+func TestPutCallRatio(t *testing.T) {
+	tracker := NewOITracker(OIConfig{})
+	chain := []*connector.Instrument{
+		{Segment: "nsefo", InstrumentId: 1, OptionType: "CE"},
+		{Segment: "nsefo", InstrumentId: 2, OptionType: "PE"},
+		{Segment: "nsefo", InstrumentId: 3, OptionType: "CE"},
+		{Segment: "nsefo", InstrumentId: 4, OptionType: "PE"},
+		{Segment: "nsefo", InstrumentId: 5},
+		{Segment: "nsefo", InstrumentId: 6, OptionType: "PE"},
+	}
+	for _, contract := range []struct {
+		topic  string
+		oi     int32
+		volume uint32
+	}{
+		{"nsefo/1", 1000, 400}, {"nsefo/2", 1500, 300}, {"nsefo/3", 1000, 100}, {"nsefo/4", 500, 200}, {"nsefo/5", 9000, 9000},
+	} {
+		tracker.UpdateOI(contract.topic, &connector.OpenInterestData{OpenInterest: contract.oi})
+		tracker.HandleMW(encode(t, mwTick(session, 10000, contract.volume, 1)), contract.topic)
+	}
+
+	ratio := tracker.PutCallRatio(chain)
+	want := PutCallRatio{PutOI: 2000, CallOI: 2000, PutVolume: 500, CallVolume: 500, ByOI: 1, ByVolume: 1}
+	if ratio != want {
+		t.Errorf("PutCallRatio = %+v, want %+v", ratio, want)
+	}
+	if ratio := tracker.PutCallRatio(chain[1:2]); ratio.ByOI != 0 || ratio.PutOI != 1500 {
+		t.Errorf("PutCallRatio of puts only = %+v, want a zero ratio", ratio)
+	}
+}
+
+func TestOITrackerHandleOI(t *testing.T) {
+	tracker := NewOITracker(OIConfig{})
+	tracker.HandleOI(encode(t, connector.OpenInterestData{OpenInterest: 10, PreviousOi: 20}), "nsefo/35001")
+	tracker.HandleOI([]byte{1}, "nsefo/35002")
+	if contract, ok := tracker.Contract("nsefo/35001"); !ok || contract.Change != -10 || contract.ChangePercent != -50 {
+		t.Errorf("Contract = %+v, %v", contract, ok)
+	}
+	if _, ok := tracker.Contract("nsefo/35002"); ok {
+		t.Error("malformed payload created a contract")
+	}
+}
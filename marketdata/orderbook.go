@@ -0,0 +1,332 @@
+package marketdata
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Side is the side of a book level or of a trade.
+type Side int8
+
+const (
+	// Unknown is the side of a trade that could not be classified.
+	Unknown Side = 0
+	Buy     Side = 1
+	Sell    Side = -1
+)
+
+// String returns "buy", "sell" or "unknown".
+func (s Side) String() string {
+	switch s {
+	case Buy:
+		return "buy"
+	case Sell:
+		return "sell"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	// ErrCrossedBook is returned by Validate when the best bid is not below the best ask.
+	ErrCrossedBook = errors.New("crossed book")
+	// ErrInvalidLevel is returned by Validate for levels with a non-positive price or
+	// quantity, or a price repeated on the same side.
+	ErrInvalidLevel = errors.New("invalid book level")
+)
+
+// Level is one price level of an order book.
+type Level struct {
+	Price    float64
+	Quantity uint32
+	Orders   int16
+}
+
+// OrderBook is the market depth of one MarketWatch snapshot, split by side.
+type OrderBook struct {
+	Topic string
+	// Bids are sorted best, i.e. highest, first.
+	Bids []Level
+	// Asks are sorted best, i.e. lowest, first.
+	Asks             []Level
+	TotalBidQuantity uint32
+	TotalAskQuantity uint32
+	PriceDivisor     int32
+}
+
+// NewOrderBook builds the order book of a MarketWatch snapshot. Levels are split by
+// their TransactionType; payloads without transaction types are read as five bids
+// followed by five asks. Empty levels are left out.
+func NewOrderBook(topic string, tick *connector.MWBOCombined) *OrderBook {
+	book := &OrderBook{
+		Topic:            topic,
+		TotalBidQuantity: tick.TotalBidQuantity,
+		TotalAskQuantity: tick.TotalAskQuantity,
+		PriceDivisor:     tick.PriceDivisor,
+	}
+	for i, depth := range tick.MarketDepth {
+		if depth.Quantity == 0 && depth.Price == 0 {
+			continue
+		}
+		level := Level{Price: tick.Price(depth.Price), Quantity: depth.Quantity, Orders: depth.Orders}
+		switch {
+		case depth.TransactionType == connector.TransactionTypeBuy:
+			book.Bids = append(book.Bids, level)
+		case depth.TransactionType == connector.TransactionTypeSell:
+			book.Asks = append(book.Asks, level)
+		case i < len(tick.MarketDepth)/2:
+			book.Bids = append(book.Bids, level)
+		default:
+			book.Asks = append(book.Asks, level)
+		}
+	}
+	sort.SliceStable(book.Bids, func(i, j int) bool { return book.Bids[i].Price > book.Bids[j].Price })
+	sort.SliceStable(book.Asks, func(i, j int) bool { return book.Asks[i].Price < book.Asks[j].Price })
+	return book
+}
+
+// Validate returns ErrInvalidLevel or ErrCrossedBook, wrapped with the offending
+// level, when the book is inconsistent.
+func (b *OrderBook) Validate() error {
+	for _, side := range []struct {
+		name   string
+		levels []Level
+	}{{"bid", b.Bids}, {"ask", b.Asks}} {
+		for i, level := range side.levels {
+			if level.Price <= 0 || level.Quantity == 0 {
+				return fmt.Errorf("%s %d at %v x %d: %w", side.name, i+1, level.Price, level.Quantity, ErrInvalidLevel)
+			}
+			if i > 0 && level.Price == side.levels[i-1].Price {
+				return fmt.Errorf("%s %d at %v repeats a price: %w", side.name, i+1, level.Price, ErrInvalidLevel)
+			}
+		}
+	}
+	if len(b.Bids) != 0 && len(b.Asks) != 0 && b.Bids[0].Price >= b.Asks[0].Price {
+		return fmt.Errorf("bid %v, ask %v: %w", b.Bids[0].Price, b.Asks[0].Price, ErrCrossedBook)
+	}
+	return nil
+}
+
+// BestBid returns the highest bid.
+func (b *OrderBook) BestBid() (Level, bool) {
+	if len(b.Bids) == 0 {
+		return Level{}, false
+	}
+	return b.Bids[0], true
+}
+
+// BestAsk returns the lowest ask.
+func (b *OrderBook) BestAsk() (Level, bool) {
+	if len(b.Asks) == 0 {
+		return Level{}, false
+	}
+	return b.Asks[0], true
+}
+
+// Spread returns the best ask minus the best bid. It is false when a side is empty.
+func (b *OrderBook) Spread() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	if b.PriceDivisor > 0 {
+		// Round away the float error of the subtraction, e.g. 0.09999999999999432.
+		divisor := float64(b.PriceDivisor)
+		return math.Round((ask.Price-bid.Price)*divisor) / divisor, true
+	}
+	return ask.Price - bid.Price, true
+}
+
+// Mid returns the average of the best bid and ask. It is false when a side is empty.
+func (b *OrderBook) Mid() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return (bid.Price + ask.Price) / 2, true
+}
+
+// Microprice returns the mid weighted by the opposite quantities at the touch, which
+// leans towards the side more likely to be traded through. It is false when a side is
+// empty.
+func (b *OrderBook) Microprice() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk || bid.Quantity+ask.Quantity == 0 {
+		return 0, false
+	}
+	bidQuantity := float64(bid.Quantity)
+	askQuantity := float64(ask.Quantity)
+	return (bid.Price*askQuantity + ask.Price*bidQuantity) / (bidQuantity + askQuantity), true
+}
+
+// Imbalance returns (bid quantity - ask quantity) / (bid quantity + ask quantity) over
+// the best levels of each side, between -1 (all asks) and 1 (all bids). Zero levels
+// uses the whole book.
+func (b *OrderBook) Imbalance(levels int) float64 {
+	bids := sumQuantity(b.Bids, levels)
+	asks := sumQuantity(b.Asks, levels)
+	if bids+asks == 0 {
+		return 0
+	}
+	return (float64(bids) - float64(asks)) / float64(bids+asks)
+}
+
+// CumulativeDepth returns the quantity available up to each level of each side,
+// best level first.
+func (b *OrderBook) CumulativeDepth() (bids []uint64, asks []uint64) {
+	return cumulate(b.Bids), cumulate(b.Asks)
+}
+
+// LevelChange is a difference between two books at one price.
+type LevelChange struct {
+	Side  Side
+	Price float64
+	// Previous is the level in the older book; its Quantity is zero for a new level.
+	Previous Level
+	// Current is the level in the newer book; its Quantity is zero for a removed level.
+	Current Level
+}
+
+// Diff returns the levels added, removed or changed since the previous book of the
+// same topic, bids first, each side in book order: bids by descending and asks by
+// ascending price, removed levels included. A nil previous book reports every level as
+// added.
+func (b *OrderBook) Diff(previous *OrderBook) []LevelChange {
+	var changes []LevelChange
+	var previousBids, previousAsks []Level
+	if previous != nil {
+		previousBids, previousAsks = previous.Bids, previous.Asks
+	}
+	changes = diffLevels(changes, Buy, previousBids, b.Bids)
+	changes = diffLevels(changes, Sell, previousAsks, b.Asks)
+	return changes
+}
+
+// BookTracker keeps the latest order book of each topic and reports the changes
+// between consecutive snapshots.
+//
+//	tracker := marketdata.NewBookTracker(func(book *marketdata.OrderBook, changes []marketdata.LevelChange) {
+//		spread, _ := book.Spread()
+//		fmt.Println(book.Topic, spread, book.Imbalance(0), len(changes))
+//	})
+//	conn.MWHandler = tracker.Handle
+type BookTracker struct {
+	onUpdate func(*OrderBook, []LevelChange)
+
+	mu    sync.Mutex
+	books map[string]*OrderBook
+	// updates serialises the updates of each topic, so that onUpdate sees the books of
+	// a topic in the order they replaced each other.
+	updates map[string]*sync.Mutex
+}
+
+// NewBookTracker returns a tracker that calls onUpdate, if not nil, with each new book
+// and its changes. The calls for a topic are made one at a time, in order; onUpdate
+// must not call Update for the same topic.
+func NewBookTracker(onUpdate func(*OrderBook, []LevelChange)) *BookTracker {
+	return &BookTracker{onUpdate: onUpdate, books: map[string]*OrderBook{}, updates: map[string]*sync.Mutex{}}
+}
+
+// Handle decodes a MarketWatch payload and updates the book of its topic. It has the
+// signature of the Connect handler fields, so that it can be set as MWHandler.
+func (t *BookTracker) Handle(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	t.Update(topic, &tick)
+}
+
+// Update replaces the book of the topic with the one of the snapshot and returns it
+// with its changes since the previous snapshot.
+func (t *BookTracker) Update(topic string, tick *connector.MWBOCombined) (*OrderBook, []LevelChange) {
+	book := NewOrderBook(topic, tick)
+	t.mu.Lock()
+	update := t.updates[topic]
+	if update == nil {
+		update = &sync.Mutex{}
+		t.updates[topic] = update
+	}
+	t.mu.Unlock()
+
+	update.Lock()
+	defer update.Unlock()
+	t.mu.Lock()
+	previous := t.books[topic]
+	t.books[topic] = book
+	t.mu.Unlock()
+
+	changes := book.Diff(previous)
+	if t.onUpdate != nil {
+		t.onUpdate(book, changes)
+	}
+	return book, changes
+}
+
+// Book returns the latest book of the topic. The book must not be modified.
+func (t *BookTracker) Book(topic string) (*OrderBook, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	book, ok := t.books[topic]
+	return book, ok
+}
+
+func sumQuantity(levels []Level, count int) uint64 {
+	if count <= 0 || count > len(levels) {
+		count = len(levels)
+	}
+	var sum uint64
+	for _, level := range levels[:count] {
+		sum += uint64(level.Quantity)
+	}
+	return sum
+}
+
+func cumulate(levels []Level) []uint64 {
+	cumulative := make([]uint64, len(levels))
+	var sum uint64
+	for i, level := range levels {
+		sum += uint64(level.Quantity)
+		cumulative[i] = sum
+	}
+	return cumulative
+}
+
+func diffLevels(changes []LevelChange, side Side, previous []Level, current []Level) []LevelChange {
+	start := len(changes)
+	before := make(map[float64]Level, len(previous))
+	for _, level := range previous {
+		before[level.Price] = level
+	}
+	seen := make(map[float64]bool, len(current))
+	for _, level := range current {
+		seen[level.Price] = true
+		old, ok := before[level.Price]
+		if ok && old == level {
+			continue
+		}
+		changes = append(changes, LevelChange{Side: side, Price: level.Price, Previous: old, Current: level})
+	}
+	for _, level := range previous {
+		if !seen[level.Price] {
+			changes = append(changes, LevelChange{Side: side, Price: level.Price, Previous: level, Current: Level{Price: level.Price}})
+		}
+	}
+	// Removed levels were appended last; merge them into book order.
+	sideChanges := changes[start:]
+	sort.SliceStable(sideChanges, func(i, j int) bool {
+		if side == Buy {
+			return sideChanges[i].Price > sideChanges[j].Price
+		}
+		return sideChanges[i].Price < sideChanges[j].Price
+	})
+	return changes
+}
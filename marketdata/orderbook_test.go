@@ -0,0 +1,228 @@
+package marketdata
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// depthTick returns a snapshot with the levels, given as quantity and price in paise,
+// in payload order.
+func depthTick(transactionType bool, levels ...[2]int32) *connector.MWBOCombined {
+	tick := &connector.MWBOCombined{PriceDivisor: 100}
+	for i, level := range levels {
+		tick.MarketDepth[i] = connector.Depth{Quantity: uint32(level[0]), Price: level[1], Orders: 1}
+		if transactionType {
+			tick.MarketDepth[i].TransactionType = connector.TransactionTypeBuy
+			if i >= 5 {
+				tick.MarketDepth[i].TransactionType = connector.TransactionTypeSell
+			}
+		}
+	}
+	return tick
+}
+
+func prices(levels []Level) []float64 {
+	var result []float64
+	for _, level := range levels {
+		result = append(result, level.Price)
+	}
+	return result
+}
+
+func TestNewOrderBook(t *testing.T) {
+	tests := []struct {
+		name       string
+		tick       *connector.MWBOCombined
+		bids, asks []float64
+	}{
+		{
+			name: "transaction types",
+			tick: depthTick(true,
+				[2]int32{10, 10000}, [2]int32{20, 9995}, [2]int32{30, 9990}, [2]int32{40, 9985}, [2]int32{50, 9980},
+				[2]int32{15, 10005}, [2]int32{25, 10010}, [2]int32{35, 10015}, [2]int32{45, 10020}, [2]int32{55, 10025}),
+			bids: []float64{100, 99.95, 99.9, 99.85, 99.8},
+			asks: []float64{100.05, 100.1, 100.15, 100.2, 100.25},
+		},
+		{
+			name: "unsorted levels",
+			tick: depthTick(true,
+				[2]int32{30, 9990}, [2]int32{10, 10000}, [2]int32{20, 9995}, [2]int32{}, [2]int32{},
+				[2]int32{25, 10010}, [2]int32{15, 10005}, [2]int32{}, [2]int32{}, [2]int32{}),
+			bids: []float64{100, 99.95, 99.9},
+			asks: []float64{100.05, 100.1},
+		},
+		{
+			name: "positional",
+			tick: depthTick(false,
+				[2]int32{10, 10000}, [2]int32{20, 9995}, [2]int32{}, [2]int32{}, [2]int32{},
+				[2]int32{15, 10005}, [2]int32{}, [2]int32{}, [2]int32{}, [2]int32{}),
+			bids: []float64{100, 99.95},
+			asks: []float64{100.05},
+		},
+		{
+			name: "typed levels out of position",
+			tick: func() *connector.MWBOCombined {
+				tick := depthTick(false, [2]int32{10, 10005}, [2]int32{20, 10000})
+				tick.MarketDepth[0].TransactionType = connector.TransactionTypeSell
+				tick.MarketDepth[1].TransactionType = connector.TransactionTypeBuy
+				return tick
+			}(),
+			bids: []float64{100},
+			asks: []float64{100.05},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := NewOrderBook("nseeq/2885", test.tick)
+			if got := prices(book.Bids); !reflect.DeepEqual(got, test.bids) {
+				t.Errorf("bids %v, want %v", got, test.bids)
+			}
+			if got := prices(book.Asks); !reflect.DeepEqual(got, test.asks) {
+				t.Errorf("asks %v, want %v", got, test.asks)
+			}
+			if err := book.Validate(); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestOrderBookMeasures(t *testing.T) {
+	book := NewOrderBook("nseeq/2885", depthTick(true,
+		[2]int32{10, 10000}, [2]int32{30, 9990}, [2]int32{}, [2]int32{}, [2]int32{},
+		[2]int32{30, 10010}, [2]int32{10, 10020}, [2]int32{}, [2]int32{}, [2]int32{}))
+
+	if spread, ok := book.Spread(); !ok || spread != 0.1 {
+		t.Errorf("Spread = %v, %v; want 0.1", spread, ok)
+	}
+	if mid, ok := book.Mid(); !ok || mid != 100.05 {
+		t.Errorf("Mid = %v, %v; want 100.05", mid, ok)
+	}
+	if micro, ok := book.Microprice(); !ok || micro != 100.025 {
+		t.Errorf("Microprice = %v, %v; want 100.025", micro, ok)
+	}
+	if imbalance := book.Imbalance(1); imbalance != -0.5 {
+		t.Errorf("Imbalance(1) = %v, want -0.5", imbalance)
+	}
+	if imbalance := book.Imbalance(0); imbalance != 0 {
+		t.Errorf("Imbalance(0) = %v, want 0", imbalance)
+	}
+	bids, asks := book.CumulativeDepth()
+	if !reflect.DeepEqual(bids, []uint64{10, 40}) || !reflect.DeepEqual(asks, []uint64{30, 40}) {
+		t.Errorf("CumulativeDepth = %v, %v", bids, asks)
+	}
+
+	empty := NewOrderBook("nseeq/2885", depthTick(true, [2]int32{10, 10000}))
+	if _, ok := empty.Spread(); ok {
+		t.Error("Spread of a one-sided book is ok")
+	}
+	if _, ok := empty.Microprice(); ok {
+		t.Error("Microprice of a one-sided book is ok")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		bids, asks []Level
+		err        error
+	}{
+		{name: "valid", bids: []Level{{Price: 100, Quantity: 1}}, asks: []Level{{Price: 101, Quantity: 1}}},
+		{name: "crossed", bids: []Level{{Price: 101, Quantity: 1}}, asks: []Level{{Price: 101, Quantity: 1}}, err: ErrCrossedBook},
+		{name: "zero quantity", bids: []Level{{Price: 100}}, err: ErrInvalidLevel},
+		{name: "zero price", asks: []Level{{Quantity: 1}}, err: ErrInvalidLevel},
+		{name: "repeated price", asks: []Level{{Price: 101, Quantity: 1}, {Price: 101, Quantity: 2}}, err: ErrInvalidLevel},
+	}
+	for _, test := range tests {
+		book := &OrderBook{Bids: test.bids, Asks: test.asks}
+		if err := book.Validate(); !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%s: Validate = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := NewOrderBook("nseeq/2885", depthTick(true,
+		[2]int32{10, 10000}, [2]int32{20, 9995}, [2]int32{30, 9990}, [2]int32{}, [2]int32{},
+		[2]int32{15, 10005}, [2]int32{25, 10010}, [2]int32{}, [2]int32{}, [2]int32{}))
+	current := NewOrderBook("nseeq/2885", depthTick(true,
+		[2]int32{10, 10000}, [2]int32{25, 9995}, [2]int32{5, 9985}, [2]int32{}, [2]int32{},
+		[2]int32{5, 10002}, [2]int32{25, 10010}, [2]int32{}, [2]int32{}, [2]int32{}))
+
+	want := []LevelChange{
+		{Side: Buy, Price: 99.95, Previous: Level{99.95, 20, 1}, Current: Level{99.95, 25, 1}},
+		{Side: Buy, Price: 99.9, Previous: Level{99.9, 30, 1}, Current: Level{Price: 99.9}},
+		{Side: Buy, Price: 99.85, Current: Level{99.85, 5, 1}},
+		{Side: Sell, Price: 100.02, Current: Level{100.02, 5, 1}},
+		{Side: Sell, Price: 100.05, Previous: Level{100.05, 15, 1}, Current: Level{Price: 100.05}},
+	}
+	if got := current.Diff(previous); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff\n%+v\nwant\n%+v", got, want)
+	}
+	if got := current.Diff(nil); len(got) != 5 {
+		t.Errorf("Diff(nil) has %d changes, want every level", len(got))
+	}
+	if got := current.Diff(current); len(got) != 0 {
+		t.Errorf("Diff of the same book = %+v", got)
+	}
+}
+
+func TestBookTracker(t *testing.T) {
+	var mu sync.Mutex
+	sizes := map[uint32]int{}
+	tracker := NewBookTracker(func(book *OrderBook, changes []LevelChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes[book.Bids[0].Quantity] = len(changes)
+	})
+
+	book, changes := tracker.Update("nseeq/2885", depthTick(true, [2]int32{10, 10000}))
+	if len(changes) != 1 || book.Bids[0].Quantity != 10 {
+		t.Fatalf("first update %+v, %+v", book, changes)
+	}
+	payload, err := connector.EncodeFeed(depthTick(true, [2]int32{20, 10000}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Handle(payload, "nseeq/2885")
+	tracker.Handle(payload[:3], "nseeq/2885")
+
+	if book, ok := tracker.Book("nseeq/2885"); !ok || book.Bids[0].Quantity != 20 {
+		t.Errorf("Book = %+v, %v; want the handled snapshot", book, ok)
+	}
+	if _, ok := tracker.Book("nseeq/1594"); ok {
+		t.Error("Book of an unknown topic is ok")
+	}
+	if want := map[uint32]int{10: 1, 20: 1}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("updates %v, want %v", sizes, want)
+	}
+}
+
+func TestBookTrackerOrder(t *testing.T) {
+	const updates = 200
+	var last uint32
+	tracker := NewBookTracker(func(book *OrderBook, changes []LevelChange) {
+		// Each book replaces the previous one, so a change reports the quantity it replaced.
+		if len(changes) == 1 && changes[0].Previous.Quantity != last {
+			t.Errorf("change from %d, want from %d", changes[0].Previous.Quantity, last)
+		}
+		last = book.Bids[0].Quantity
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= updates; i++ {
+		wg.Add(1)
+		go func(quantity int32) {
+			defer wg.Done()
+			tracker.Update("nseeq/2885", depthTick(true, [2]int32{quantity, 10000}))
+		}(int32(i))
+	}
+	wg.Wait()
+	if book, _ := tracker.Book("nseeq/2885"); book.Bids[0].Quantity != last {
+		t.Errorf("book has %d, the last update reported %d", book.Bids[0].Quantity, last)
+	}
+}
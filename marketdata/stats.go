@@ -0,0 +1,276 @@
+package marketdata
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// tradingYear is the time the market is open in a year, used to annualise volatility:
+// 252 sessions of 375 minutes.
+const tradingYear = 252 * 375 * time.Minute
+
+// Stats are the rolling statistics of one instrument after a trade.
+type Stats struct {
+	Topic string
+	// Time is the LastTradedTime of the trade.
+	Time time.Time
+	Ltp  float64
+	// VWAP is the volume weighted average of the last traded prices of the session. It
+	// starts from the AverageTradedPrice and TradedVolume of the first tick, so that it
+	// covers the whole session when the client starts late.
+	VWAP float64
+	// ATP is the AverageTradedPrice published by the exchange, and VWAPDeviation the
+	// distance from ATP to VWAP in percent of ATP. A large deviation suggests missed
+	// ticks or a stale VWAP.
+	ATP           float64
+	VWAPDeviation float64
+	// TWAP is the time weighted average price over the window, each price holding until
+	// the next trade.
+	TWAP float64
+	// Volatility is the realised volatility of the log returns over the window,
+	// annualised over 252 sessions of 375 minutes. It is zero until the window holds two
+	// trades at different times.
+	Volatility float64
+	// SMA and EMA are the simple and exponential moving averages of the last traded
+	// price over the configured number of trades.
+	SMA float64
+	EMA float64
+	// VolumePerMinute is the traded volume over the window, per minute.
+	VolumePerMinute float64
+	// Volume is the session volume and Trades the number of trades seen.
+	Volume uint32
+	Trades uint64
+}
+
+// StatsConfig configures an Indicators.
+type StatsConfig struct {
+	// Window is the period of TWAP, Volatility and VolumePerMinute. Defaults to five
+	// minutes.
+	Window time.Duration
+	// Period is the number of trades of SMA and EMA. Defaults to 20.
+	Period int
+	// OnStats is called with the statistics of an instrument after each trade.
+	OnStats func(Stats)
+	// Updates receives the statistics of an instrument after each trade. The receiver
+	// must keep up, as the send blocks.
+	Updates chan<- Stats
+}
+
+// Indicators computes rolling statistics of each instrument incrementally from the
+// MarketWatch ticks. Snapshots without a new trade and ticks older than the last one
+// are ignored. A drop of the cumulative TradedVolume on a later day starts a new
+// session.
+//
+//	indicators := marketdata.NewIndicators(marketdata.StatsConfig{
+//		Window: 15 * time.Minute,
+//		Period: 50,
+//		OnStats: func(stats marketdata.Stats) {
+//			fmt.Println(stats.Topic, stats.VWAP, stats.TWAP, stats.EMA, stats.Volatility)
+//		},
+//	})
+//	conn.MWHandler = indicators.Handle
+//
+//	stats, ok := indicators.Stats("nseeq/2885")
+type Indicators struct {
+	config StatsConfig
+
+	mu     sync.Mutex
+	series map[string]*statsSeries
+}
+
+type statsSeries struct {
+	stats Stats
+	// turnover and volume accumulate the VWAP.
+	turnover float64
+	volume   float64
+	// samples are the trades of the window, oldest first.
+	samples []statsSample
+	// prices holds the last Period prices, with sum their total.
+	prices []float64
+	next   int
+	sum    float64
+}
+
+type statsSample struct {
+	at     time.Time
+	price  float64
+	volume uint32
+}
+
+// NewIndicators returns an Indicators.
+func NewIndicators(config StatsConfig) *Indicators {
+	if config.Window <= 0 {
+		config.Window = 5 * time.Minute
+	}
+	if config.Period <= 0 {
+		config.Period = 20
+	}
+	return &Indicators{config: config, series: map[string]*statsSeries{}}
+}
+
+// Handle decodes a MarketWatch payload and updates the statistics of its topic. It has
+// the signature of the Connect handler fields, so that it can be set as MWHandler.
+func (i *Indicators) Handle(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	i.Update(topic, &tick)
+}
+
+// Update adds a decoded MarketWatch tick of the topic, e.g. "nseeq/2885", and returns
+// the statistics. It is false when the tick carries no new trade.
+func (i *Indicators) Update(topic string, tick *connector.MWBOCombined) (Stats, bool) {
+	if tick.LastTradedTime == 0 || tick.Ltp <= 0 {
+		return Stats{}, false
+	}
+	at := tick.TradedAt()
+	price := tick.Price(tick.Ltp)
+
+	i.mu.Lock()
+	series := i.series[topic]
+	if series != nil && tick.TradedVolume < series.stats.Volume {
+		if !newSession(series.stats.Time, at) {
+			// A tick older than the last one.
+			i.mu.Unlock()
+			return Stats{}, false
+		}
+		series = nil
+	}
+	if series == nil {
+		series = &statsSeries{stats: Stats{Topic: topic, EMA: price}, prices: make([]float64, 0, i.config.Period)}
+		if tick.AverageTradedPrice > 0 {
+			series.volume = float64(tick.TradedVolume)
+			series.turnover = tick.Price(tick.AverageTradedPrice) * series.volume
+		}
+		i.series[topic] = series
+	} else if at.Equal(series.stats.Time) && tick.TradedVolume == series.stats.Volume {
+		i.mu.Unlock()
+		return Stats{}, false
+	} else if traded := tick.TradedVolume - series.stats.Volume; traded > 0 {
+		series.volume += float64(traded)
+		series.turnover += price * float64(traded)
+	}
+	stats := series.add(at, price, tick, i.config)
+	i.mu.Unlock()
+
+	if i.config.OnStats != nil {
+		i.config.OnStats(stats)
+	}
+	if i.config.Updates != nil {
+		i.config.Updates <- stats
+	}
+	return stats, true
+}
+
+func (s *statsSeries) add(at time.Time, price float64, tick *connector.MWBOCombined, config StatsConfig) Stats {
+	stats := &s.stats
+	stats.Time = at
+	stats.Ltp = price
+	stats.Volume = tick.TradedVolume
+	stats.Trades++
+
+	stats.VWAP = price
+	if s.volume > 0 {
+		stats.VWAP = s.turnover / s.volume
+	}
+	stats.ATP = tick.Price(tick.AverageTradedPrice)
+	stats.VWAPDeviation = 0
+	if stats.ATP > 0 {
+		stats.VWAPDeviation = (stats.VWAP - stats.ATP) / stats.ATP * 100
+	}
+
+	if len(s.prices) < config.Period {
+		s.prices = append(s.prices, price)
+	} else {
+		s.sum -= s.prices[s.next]
+		s.prices[s.next] = price
+		s.next = (s.next + 1) % config.Period
+	}
+	s.sum += price
+	stats.SMA = s.sum / float64(len(s.prices))
+	alpha := 2 / float64(config.Period+1)
+	stats.EMA += alpha * (price - stats.EMA)
+
+	// Ticks may arrive out of order; the window only moves forward.
+	if n := len(s.samples); n == 0 || !at.Before(s.samples[n-1].at) {
+		s.samples = append(s.samples, statsSample{at: at, price: price, volume: tick.TradedVolume})
+	}
+	latest := s.samples[len(s.samples)-1].at
+	cutoff := latest.Add(-config.Window)
+	first := 0
+	for first < len(s.samples)-1 && !s.samples[first+1].at.After(cutoff) {
+		first++
+	}
+	s.samples = s.samples[first:]
+	s.window(stats, cutoff)
+	return *stats
+}
+
+// window computes the statistics over the samples of the window starting at cutoff. The
+// first sample may be older than cutoff; its price holds from cutoff.
+func (s *statsSeries) window(stats *Stats, cutoff time.Time) {
+	oldest, latest := s.samples[0], s.samples[len(s.samples)-1]
+	stats.TWAP = latest.price
+	stats.Volatility = 0
+	stats.VolumePerMinute = 0
+
+	var weighted float64
+	var span time.Duration
+	var squares float64
+	for n := 0; n < len(s.samples)-1; n++ {
+		from := s.samples[n].at
+		if from.Before(cutoff) {
+			from = cutoff
+		}
+		held := s.samples[n+1].at.Sub(from)
+		weighted += s.samples[n].price * held.Seconds()
+		span += held
+		r := math.Log(s.samples[n+1].price / s.samples[n].price)
+		squares += r * r
+	}
+	if span > 0 {
+		stats.TWAP = weighted / span.Seconds()
+	}
+
+	if elapsed := latest.at.Sub(oldest.at); elapsed > 0 {
+		stats.Volatility = math.Sqrt(squares / (float64(elapsed) / float64(tradingYear)))
+		if latest.volume >= oldest.volume {
+			stats.VolumePerMinute = float64(latest.volume-oldest.volume) / elapsed.Minutes()
+		}
+	}
+}
+
+// newSession reports whether a trade at next falls on a later day than one at last.
+func newSession(last time.Time, next time.Time) bool {
+	y1, m1, d1 := last.In(connector.IST).Date()
+	y2, m2, d2 := next.In(connector.IST).Date()
+	return time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).After(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC))
+}
+
+// Stats returns the last statistics of the topic.
+func (i *Indicators) Stats(topic string) (Stats, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	series, ok := i.series[topic]
+	if !ok {
+		return Stats{}, false
+	}
+	return series.stats, true
+}
+
+// All returns the last statistics of every instrument seen, by topic.
+func (i *Indicators) All() []Stats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	all := make([]Stats, 0, len(i.series))
+	for _, series := range i.series {
+		all = append(all, series.stats)
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].Topic < all[b].Topic })
+	return all
+}
@@ -0,0 +1,211 @@
+package marketdata
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestIndicatorsWindow(t *testing.T) {
+	type tick struct {
+		offset time.Duration
+		ltp    int32
+		volume uint32
+	}
+	tests := []struct {
+		name            string
+		window          time.Duration
+		ticks           []tick
+		vwap, twap      float64
+		volumePerMinute float64
+		volatility      float64
+	}{
+		{
+			name:   "single trade",
+			window: time.Minute,
+			ticks:  []tick{{0, 10000, 1000}},
+			vwap:   100,
+			twap:   100,
+		},
+		{
+			name:   "time weighted",
+			window: time.Minute,
+			ticks: []tick{
+				{0, 10000, 1000},
+				{20 * time.Second, 10200, 1010},
+				{60 * time.Second, 10100, 1040},
+			},
+			// 102 x 10 and 101 x 30 traded after the first tick.
+			vwap:            101.25,
+			twap:            (100*20 + 102*40) / 60.0,
+			volumePerMinute: 40,
+			volatility:      math.Sqrt((math.Pow(math.Log(1.02), 2) + math.Pow(math.Log(101/102.0), 2)) * 252 * 375),
+		},
+		{
+			name:   "window slides",
+			window: time.Minute,
+			ticks: []tick{
+				{0, 10000, 1000},
+				{30 * time.Second, 10200, 1010},
+				{90 * time.Second, 10400, 1030},
+			},
+			vwap:            (102*10 + 104*20) / 30.0,
+			twap:            102,
+			volumePerMinute: 20,
+			volatility:      math.Log(104/102.0) * math.Sqrt(252*375),
+		},
+		{
+			// The trade at 30s is older than the cutoff at 40s; its price holds from the
+			// cutoff.
+			name:   "price held across the cutoff",
+			window: time.Minute,
+			ticks: []tick{
+				{0, 10000, 1000},
+				{30 * time.Second, 10200, 1010},
+				{80 * time.Second, 10400, 1030},
+				{100 * time.Second, 10600, 1060},
+			},
+			vwap:            (102*10 + 104*20 + 106*30) / 60.0,
+			twap:            (102*40 + 104*20) / 60.0,
+			volumePerMinute: 50 / (70.0 / 60),
+			volatility:      math.Sqrt((math.Pow(math.Log(104/102.0), 2) + math.Pow(math.Log(106/104.0), 2)) / (70.0 / 60) * 252 * 375),
+		},
+		{
+			name:   "older tick outside the window",
+			window: time.Minute,
+			ticks: []tick{
+				{0, 10000, 1000},
+				{30 * time.Second, 10200, 1010},
+				{60 * time.Second, 10400, 1030},
+				// A later volume but an older time: counted in the VWAP, not in the window.
+				{45 * time.Second, 10000, 1040},
+			},
+			vwap:            (102*10 + 104*20 + 100*10) / 40.0,
+			twap:            (100*30 + 102*30) / 60.0,
+			volumePerMinute: 30,
+			volatility:      math.Sqrt((math.Pow(math.Log(1.02), 2) + math.Pow(math.Log(104/102.0), 2)) * 252 * 375),
+		},
+		{
+			name: "default window",
+			ticks: []tick{
+				{0, 10000, 1000},
+				{4 * time.Minute, 11000, 1100},
+			},
+			vwap:            110,
+			twap:            100,
+			volumePerMinute: 25,
+			volatility:      math.Log(1.1) * math.Sqrt(252*375/4.0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indicators := NewIndicators(StatsConfig{Window: test.window})
+			for _, tick := range test.ticks {
+				indicators.Update("nseeq/2885", mwTick(session.Add(tick.offset), tick.ltp, tick.volume, 10))
+			}
+			stats, ok := indicators.Stats("nseeq/2885")
+			if !ok {
+				t.Fatal("no statistics")
+			}
+			if !near(stats.VWAP, test.vwap) {
+				t.Errorf("VWAP = %v, want %v", stats.VWAP, test.vwap)
+			}
+			if !near(stats.TWAP, test.twap) {
+				t.Errorf("TWAP = %v, want %v", stats.TWAP, test.twap)
+			}
+			if !near(stats.VolumePerMinute, test.volumePerMinute) {
+				t.Errorf("VolumePerMinute = %v, want %v", stats.VolumePerMinute, test.volumePerMinute)
+			}
+			if !near(stats.Volatility, test.volatility) {
+				t.Errorf("Volatility = %v, want %v", stats.Volatility, test.volatility)
+			}
+			if stats.Trades != uint64(len(test.ticks)) {
+				t.Errorf("Trades = %d, want %d", stats.Trades, len(test.ticks))
+			}
+		})
+	}
+}
+
+func TestIndicatorsMovingAverages(t *testing.T) {
+	indicators := NewIndicators(StatsConfig{Period: 3})
+	// EMA with alpha 0.5, starting from the first price.
+	want := []struct{ sma, ema float64 }{{100, 100}, {101, 101}, {102, 102.5}, {104, 104.25}}
+	for i, ltp := range []int32{10000, 10200, 10400, 10600} {
+		stats, ok := indicators.Update("nseeq/2885", mwTick(session.Add(time.Duration(i)*time.Second), ltp, uint32(1000+i), 1))
+		if !ok {
+			t.Fatalf("trade %d not counted", i)
+		}
+		if !near(stats.SMA, want[i].sma) || !near(stats.EMA, want[i].ema) {
+			t.Errorf("trade %d: SMA %v EMA %v, want %v %v", i, stats.SMA, stats.EMA, want[i].sma, want[i].ema)
+		}
+	}
+}
+
+func TestIndicatorsSession(t *testing.T) {
+	var updates []Stats
+	indicators := NewIndicators(StatsConfig{OnStats: func(stats Stats) { updates = append(updates, stats) }})
+
+	// A late start: the VWAP starts from the exchange average of the first tick.
+	first := mwTick(session.Add(time.Hour), 10000, 1000, 10)
+	first.AverageTradedPrice = 9900
+	if stats, _ := indicators.Update("nseeq/2885", first); stats.VWAP != 99 || stats.ATP != 99 || stats.VWAPDeviation != 0 {
+		t.Errorf("first stats %+v", stats)
+	}
+	next := mwTick(session.Add(time.Hour+time.Second), 10100, 1100, 100)
+	next.AverageTradedPrice = 9920
+	stats, _ := indicators.Update("nseeq/2885", next)
+	vwap := (99*1000 + 101*100) / 1100.0
+	if !near(stats.VWAP, vwap) || !near(stats.VWAPDeviation, (vwap-99.2)/99.2*100) {
+		t.Errorf("VWAP %v deviation %v, want %v", stats.VWAP, stats.VWAPDeviation, vwap)
+	}
+
+	if _, ok := indicators.Update("nseeq/2885", next); ok {
+		t.Error("repeated snapshot counted as a trade")
+	}
+	if _, ok := indicators.Update("nseeq/2885", mwTick(session, 10000, 500, 10)); ok {
+		t.Error("older snapshot with a lower volume counted as a trade")
+	}
+	if _, ok := indicators.Update("nseeq/2885", mwTick(session, 0, 1200, 10)); ok {
+		t.Error("snapshot without a price counted as a trade")
+	}
+
+	stats, ok := indicators.Update("nseeq/2885", mwTick(session.Add(24*time.Hour), 10500, 50, 50))
+	if !ok || stats.VWAP != 105 || stats.Trades != 1 || stats.Volume != 50 {
+		t.Errorf("stats of the new session %+v, %v", stats, ok)
+	}
+	if len(updates) != 3 {
+		t.Errorf("OnStats called %d times, want 3", len(updates))
+	}
+}
+
+func TestIndicatorsHandle(t *testing.T) {
+	updates := make(chan Stats, 2)
+	indicators := NewIndicators(StatsConfig{Updates: updates})
+	payload, err := connector.EncodeFeed(mwTick(session, 10000, 1000, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indicators.Handle(payload, "nseeq/2885")
+	indicators.Handle(payload[:10], "nseeq/2885")
+	indicators.Update("nseeq/1594", mwTick(session, 20000, 100, 10))
+
+	if len(updates) != 2 {
+		t.Fatalf("%d updates, want 2", len(updates))
+	}
+	if stats := (<-updates); stats.Topic != "nseeq/2885" || stats.Ltp != 100 {
+		t.Errorf("update %+v", stats)
+	}
+	all := indicators.All()
+	if len(all) != 2 || all[0].Topic != "nseeq/1594" || all[1].Topic != "nseeq/2885" {
+		t.Errorf("All = %+v", all)
+	}
+	if _, ok := indicators.Stats("nseeq/11536"); ok {
+		t.Error("Stats of an unknown topic is ok")
+	}
+}
@@ -0,0 +1,151 @@
+package marketdata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Trade is a trade print inferred from two consecutive MarketWatch snapshots.
+type Trade struct {
+	Topic string
+	// Time is the LastTradedTime of the newer snapshot.
+	Time  time.Time
+	Price float64
+	// Quantity is the increase of the cumulative TradedVolume between the snapshots.
+	Quantity uint32
+	// LastTradedQuantity is the quantity of the last trade, as reported by the snapshot.
+	LastTradedQuantity uint32
+	// Side is the aggressor side: Buy when the trade lifted the offer.
+	Side Side
+	// Gap is set when the volume grew by more than LastTradedQuantity, i.e. trades
+	// happened between the snapshots that were not seen. Missed is the unexplained
+	// quantity.
+	Gap    bool
+	Missed uint32
+}
+
+// TradeInferrer infers trade prints from the changes of LastTradedTime,
+// LastTradedQuantity and TradedVolume between the snapshots of each topic. The
+// aggressor side is classified with the Lee-Ready algorithm: trades above the mid of the
+// previous snapshot are buys, trades below it are sells, and trades at the mid fall back
+// to the tick test against the previous trade price.
+//
+//	inferrer := marketdata.NewTradeInferrer(func(trade marketdata.Trade) {
+//		fmt.Println(trade.Topic, trade.Time, trade.Side, trade.Quantity, trade.Price, trade.Gap)
+//	})
+//	conn.MWHandler = inferrer.Handle
+type TradeInferrer struct {
+	onTrade func(Trade)
+
+	mu     sync.Mutex
+	topics map[string]*tradeState
+}
+
+type tradeState struct {
+	lastTradedTime int32
+	volume         uint32
+	bid            int32
+	ask            int32
+	price          int32
+	// previousPrice is the last trade price that differs from price, for the tick test.
+	previousPrice int32
+	side          Side
+}
+
+// NewTradeInferrer returns an inferrer that calls onTrade, if not nil, with each
+// inferred trade.
+func NewTradeInferrer(onTrade func(Trade)) *TradeInferrer {
+	return &TradeInferrer{onTrade: onTrade, topics: map[string]*tradeState{}}
+}
+
+// Handle decodes a MarketWatch payload and infers its trade. It has the signature of the
+// Connect handler fields, so that it can be set as MWHandler.
+func (t *TradeInferrer) Handle(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	t.Update(topic, &tick)
+}
+
+// Update compares the snapshot with the previous one of the topic and returns the trade
+// between them, if any. The first snapshot of a topic and snapshots whose volume went
+// down, e.g. on a new session, only set the baseline.
+func (t *TradeInferrer) Update(topic string, tick *connector.MWBOCombined) (Trade, bool) {
+	t.mu.Lock()
+	state, known := t.topics[topic]
+	if !known {
+		state = &tradeState{}
+		t.topics[topic] = state
+	}
+
+	var trade Trade
+	traded := false
+	if known && tick.TradedVolume > state.volume && tick.LastTradedTime >= state.lastTradedTime {
+		traded = true
+		trade = Trade{
+			Topic:              topic,
+			Time:               tick.TradedAt(),
+			Price:              tick.Price(tick.Ltp),
+			Quantity:           tick.TradedVolume - state.volume,
+			LastTradedQuantity: tick.LastTradedQuantity,
+			Side:               state.classify(tick.Ltp),
+		}
+		if trade.Quantity > tick.LastTradedQuantity {
+			trade.Gap = true
+			trade.Missed = trade.Quantity - tick.LastTradedQuantity
+		}
+		if tick.Ltp != state.price {
+			state.previousPrice = state.price
+		}
+		state.price = tick.Ltp
+		state.side = trade.Side
+	} else if !known || tick.TradedVolume < state.volume {
+		state.price = tick.Ltp
+		state.previousPrice = tick.Ltp
+		state.side = Unknown
+	}
+
+	if traded || !known || tick.TradedVolume < state.volume {
+		state.volume = tick.TradedVolume
+		state.lastTradedTime = tick.LastTradedTime
+	}
+	state.bid = tick.BestBidPrice
+	state.ask = tick.BestAskPrice
+	t.mu.Unlock()
+
+	if traded && t.onTrade != nil {
+		t.onTrade(trade)
+	}
+	return trade, traded
+}
+
+// classify returns the aggressor side of a trade at price against the previous quotes
+// and trades.
+func (s *tradeState) classify(price int32) Side {
+	if s.bid > 0 && s.ask > 0 && s.ask >= s.bid {
+		// Compare twice the price with bid + ask to stay in integers.
+		doubled := 2 * int64(price)
+		mid := int64(s.bid) + int64(s.ask)
+		if doubled > mid {
+			return Buy
+		}
+		if doubled < mid {
+			return Sell
+		}
+	}
+	switch {
+	case price > s.price:
+		return Buy
+	case price < s.price:
+		return Sell
+	case s.previousPrice != 0 && price > s.previousPrice:
+		return Buy
+	case s.previousPrice != 0 && price < s.previousPrice:
+		return Sell
+	default:
+		return s.side
+	}
+}
@@ -0,0 +1,123 @@
+package marketdata
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestTradeInferrer(t *testing.T) {
+	type snapshot struct {
+		offset           time.Duration
+		ltp              int32
+		volume, quantity uint32
+		bid, ask         int32
+	}
+	tests := []struct {
+		name     string
+		snapshot snapshot
+		// trade is nil when the snapshot infers no trade.
+		trade *Trade
+	}{
+		{
+			name:     "baseline",
+			snapshot: snapshot{0, 10000, 1000, 10, 9995, 10005},
+		},
+		{
+			name:     "above the mid",
+			snapshot: snapshot{time.Second, 10005, 1010, 10, 10000, 10010},
+			trade:    &Trade{Price: 100.05, Quantity: 10, LastTradedQuantity: 10, Side: Buy},
+		},
+		{
+			name:     "quote update",
+			snapshot: snapshot{time.Second, 10005, 1010, 10, 9995, 10005},
+		},
+		{
+			name:     "below the mid with a gap",
+			snapshot: snapshot{2 * time.Second, 9995, 1040, 10, 9995, 10005},
+			trade:    &Trade{Price: 99.95, Quantity: 30, LastTradedQuantity: 10, Side: Sell, Gap: true, Missed: 20},
+		},
+		{
+			name:     "at the mid, uptick",
+			snapshot: snapshot{3 * time.Second, 10000, 1050, 10, 9995, 10005},
+			trade:    &Trade{Price: 100, Quantity: 10, LastTradedQuantity: 10, Side: Buy},
+		},
+		{
+			name:     "at the mid, zero uptick",
+			snapshot: snapshot{4 * time.Second, 10000, 1060, 10, 9995, 10005},
+			trade:    &Trade{Price: 100, Quantity: 10, LastTradedQuantity: 10, Side: Buy},
+		},
+		{
+			name:     "older snapshot",
+			snapshot: snapshot{3 * time.Second, 9990, 1070, 10, 9995, 10005},
+		},
+		{
+			name:     "below the mid",
+			snapshot: snapshot{5 * time.Second, 9995, 1070, 10, 9990, 10000},
+			trade:    &Trade{Price: 99.95, Quantity: 10, LastTradedQuantity: 10, Side: Sell},
+		},
+		{
+			name:     "volume restart",
+			snapshot: snapshot{time.Hour, 10050, 100, 100, 0, 0},
+		},
+		{
+			name:     "no quotes",
+			snapshot: snapshot{time.Hour + time.Second, 10100, 150, 50, 0, 0},
+			trade:    &Trade{Price: 101, Quantity: 50, LastTradedQuantity: 50, Side: Buy},
+		},
+		{
+			name:     "no quotes, same price",
+			snapshot: snapshot{time.Hour + 2*time.Second, 10100, 160, 10, 0, 0},
+			trade:    &Trade{Price: 101, Quantity: 10, LastTradedQuantity: 10, Side: Buy},
+		},
+	}
+
+	var trades []Trade
+	inferrer := NewTradeInferrer(func(trade Trade) { trades = append(trades, trade) })
+	for _, test := range tests {
+		at := session.Add(test.snapshot.offset)
+		tick := mwTick(at, test.snapshot.ltp, test.snapshot.volume, test.snapshot.quantity)
+		tick.BestBidPrice = test.snapshot.bid
+		tick.BestAskPrice = test.snapshot.ask
+
+		trade, ok := inferrer.Update("nseeq/2885", tick)
+		if ok != (test.trade != nil) {
+			t.Fatalf("%s: Update returned a trade %v, want %v", test.name, ok, test.trade != nil)
+		}
+		if !ok {
+			continue
+		}
+		want := *test.trade
+		want.Topic = "nseeq/2885"
+		want.Time = at
+		if !trade.Time.Equal(want.Time) {
+			t.Errorf("%s: trade at %v, want %v", test.name, trade.Time, want.Time)
+		}
+		trade.Time = want.Time
+		if !reflect.DeepEqual(trade, want) {
+			t.Errorf("%s: trade %+v, want %+v", test.name, trade, want)
+		}
+	}
+	if len(trades) != 7 {
+		t.Errorf("onTrade called %d times, want 7", len(trades))
+	}
+}
+
+func TestTradeInferrerTopics(t *testing.T) {
+	inferrer := NewTradeInferrer(nil)
+	inferrer.Update("nseeq/2885", mwTick(session, 10000, 1000, 10))
+	if _, ok := inferrer.Update("nseeq/1594", mwTick(session.Add(time.Second), 15000, 2000, 10)); ok {
+		t.Error("first snapshot of a topic inferred a trade")
+	}
+
+	payload, err := connector.EncodeFeed(mwTick(session.Add(time.Second), 10010, 1010, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inferrer.Handle(payload, "nseeq/2885")
+	if _, ok := inferrer.Update("nseeq/2885", mwTick(session.Add(time.Second), 10010, 1010, 10)); ok {
+		t.Error("snapshot repeating the handled one inferred a trade")
+	}
+}
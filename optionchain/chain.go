@@ -0,0 +1,499 @@
+// Package optionchain assembles a live option chain of one underlying and expiry from
+// the MarketWatch and Open Interest feeds, subscribing only the strikes around the
+// money.
+package optionchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+	"github.com/IIFLSecurities/bridgeGo/pricing"
+)
+
+// Config configures a Chain.
+type Config struct {
+	// Underlying is the name of the underlying in the instrument master, e.g. "NIFTY".
+	Underlying string
+	// Expiry is the expiry date of the options.
+	Expiry time.Time
+	// ReferenceTopic is the MarketWatch topic whose last traded price centres the
+	// window, e.g. the topic of the near month future. When empty, the price is set with
+	// SetUnderlyingPrice, e.g. from the index feed.
+	ReferenceTopic string
+	// Strikes is the number of strikes subscribed on each side of the at-the-money
+	// strike. Defaults to 10.
+	Strikes int
+	// OpenInterest also subscribes the Open Interest feed of the options in the window.
+	OpenInterest bool
+	// Pricer, when set, computes the implied volatility and greeks of each option tick
+	// at the underlying price, see pricing.Pricer.Evaluate. Use pricing.Black76 when the
+	// reference is a future and pricing.BlackScholes when it is the spot.
+	Pricer *pricing.Pricer
+	// OnUpdate is called with the row of a strike each time one of its quotes changes.
+	OnUpdate func(Row)
+	// CheckInterval is how often the chain checks that its subscriptions survived the
+	// session, to take them again after the connector reconnects. Defaults to one second.
+	CheckInterval time.Duration
+	// OnError is called when the window cannot be subscribed.
+	OnError func(error)
+}
+
+// Quote is the live data of one option.
+type Quote struct {
+	Instrument  *connector.Instrument
+	Ltp         float64
+	Bid         float64
+	Ask         float64
+	BidQuantity uint32
+	AskQuantity uint32
+	Volume      uint32
+	// OpenInterest and OpenInterestChange, against the previous day, are only filled
+	// with Config.OpenInterest.
+	OpenInterest       int32
+	OpenInterestChange int32
+	// Updated is the LastTradedTime of the last MarketWatch tick.
+	Updated time.Time
+	// Analytics are computed on each tick with Config.Pricer, once the underlying price
+	// is known. They are zero when the price of the tick has no implied volatility.
+	Analytics pricing.Analytics
+}
+
+// Row is one strike of the chain.
+type Row struct {
+	Strike float64
+	// Call and Put have a nil Instrument when the strike has no such option.
+	Call Quote
+	Put  Quote
+}
+
+// Chain is a live option chain. It subscribes the options of the strikes within a
+// window around the at-the-money strike, and moves the window as the price of the
+// underlying moves. Topics are held with connector.Subscription handles, so options
+// that stay in the window are never unsubscribed and other subscribers of the same
+// topics are not disturbed. The handles end with the session, so once the connector
+// has reconnected after losing its connection, the chain subscribes its topics again.
+//
+//	chain, err := optionchain.New(conn, optionchain.Config{
+//		Underlying:     "NIFTY",
+//		Expiry:         expiry,
+//		ReferenceTopic: "nsefo/35001",
+//		Strikes:        10,
+//		OpenInterest:   true,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	conn.MWHandler = chain.HandleMW
+//	conn.OpenInterstHandler = chain.HandleOI
+//	if err := chain.Start(); err != nil {
+//		return err
+//	}
+//	defer chain.Close()
+//	for _, row := range chain.Rows() {
+//		fmt.Println(row.Strike, row.Call.Ltp, row.Put.Ltp)
+//	}
+type Chain struct {
+	conn   *connector.Connect
+	config Config
+
+	// strikes lists the strikes of the expiry in ascending order.
+	strikes []float64
+	rows    map[float64]*Row
+	topics  map[string]*Quote
+
+	mu         sync.Mutex
+	underlying float64
+	// atm is the index in strikes of the centre of the subscribed window, or -1.
+	atm int
+	// target is the index of the strike nearest to the underlying price, or -1.
+	target int
+
+	recenter  chan struct{}
+	done      chan struct{}
+	stopped   sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+	reference *connector.Subscription
+	options   *connector.Subscription
+	interest  *connector.Subscription
+}
+
+// New builds the chain of the underlying and expiry from the instrument master of the
+// connector. Nothing is subscribed before Start.
+func New(conn *connector.Connect, config Config) (*Chain, error) {
+	if conn.Instruments == nil {
+		return nil, errors.New("optionchain: the connector has no instrument master")
+	}
+	if config.Strikes <= 0 {
+		config.Strikes = 10
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Second
+	}
+
+	chain := &Chain{
+		conn:     conn,
+		config:   config,
+		rows:     map[float64]*Row{},
+		topics:   map[string]*Quote{},
+		atm:      -1,
+		target:   -1,
+		recenter: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for _, instrument := range conn.Instruments.Derivatives(config.Underlying, config.Expiry, 0, "") {
+		if !instrument.IsOption() {
+			continue
+		}
+		row := chain.rows[instrument.Strike]
+		if row == nil {
+			row = &Row{Strike: instrument.Strike}
+			chain.rows[instrument.Strike] = row
+			chain.strikes = append(chain.strikes, instrument.Strike)
+		}
+		quote := &row.Call
+		if instrument.OptionType == "PE" {
+			quote = &row.Put
+		}
+		quote.Instrument = instrument
+		chain.topics[instrument.Topic()] = quote
+	}
+	if len(chain.strikes) == 0 {
+		return nil, fmt.Errorf("optionchain: no options on %s expiring %s", config.Underlying, config.Expiry.Format(time.DateOnly))
+	}
+	sort.Float64s(chain.strikes)
+	return chain, nil
+}
+
+// Start subscribes the reference topic and starts moving the window. The options are
+// subscribed once the price of the underlying is known.
+func (c *Chain) Start() error {
+	if c.config.ReferenceTopic != "" {
+		subscription, err := c.acquire(connector.FeedMarketWatch, []string{c.config.ReferenceTopic})
+		if err != nil {
+			return err
+		}
+		c.reference = subscription
+	}
+	c.stopped.Add(1)
+	go c.run()
+	return nil
+}
+
+// Close stops moving the window and releases the subscriptions of the chain. Later
+// calls return the result of the first.
+func (c *Chain) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.stopped.Wait()
+
+		var errs []error
+		for _, subscription := range []*connector.Subscription{c.options, c.interest, c.reference} {
+			if subscription != nil {
+				if _, err := subscription.Release(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		c.closeErr = errors.Join(errs...)
+	})
+	return c.closeErr
+}
+
+// HandleMW decodes a MarketWatch payload of an option or of the reference topic. It has
+// the signature of the Connect handler fields, so that it can be set as MWHandler.
+func (c *Chain) HandleMW(payload []byte, topic string) {
+	if topic != c.config.ReferenceTopic {
+		if _, ok := c.topics[topic]; !ok {
+			return
+		}
+	}
+	tick, err := connector.DecodeMW(payload)
+	if err != nil {
+		return
+	}
+	c.UpdateMW(topic, &tick)
+}
+
+// HandleOI decodes an Open Interest payload of an option.
+func (c *Chain) HandleOI(payload []byte, topic string) {
+	if _, ok := c.topics[topic]; !ok {
+		return
+	}
+	data, err := connector.DecodeOpenInterest(payload)
+	if err != nil {
+		return
+	}
+	c.UpdateOI(topic, &data)
+}
+
+// UpdateMW updates the quote of an option, or the underlying price from the reference
+// topic.
+func (c *Chain) UpdateMW(topic string, tick *connector.MWBOCombined) {
+	if topic == c.config.ReferenceTopic {
+		if tick.Ltp > 0 {
+			c.SetUnderlyingPrice(tick.Price(tick.Ltp))
+		}
+		return
+	}
+	quote, ok := c.topics[topic]
+	if !ok {
+		return
+	}
+
+	var analytics pricing.Analytics
+	if underlying := c.Underlying(); c.config.Pricer != nil && underlying > 0 {
+		analytics, _ = c.config.Pricer.Evaluate(quote.Instrument, tick, underlying)
+	}
+
+	c.mu.Lock()
+	quote.Ltp = tick.Price(tick.Ltp)
+	quote.Bid = tick.Price(tick.BestBidPrice)
+	quote.Ask = tick.Price(tick.BestAskPrice)
+	quote.BidQuantity = tick.BestBidQuantity
+	quote.AskQuantity = tick.BestAskQuantity
+	quote.Volume = tick.TradedVolume
+	if tick.LastTradedTime != 0 {
+		quote.Updated = tick.TradedAt()
+	}
+	quote.Analytics = analytics
+	row := *c.rows[quote.Instrument.Strike]
+	c.mu.Unlock()
+
+	if c.config.OnUpdate != nil {
+		c.config.OnUpdate(row)
+	}
+}
+
+// UpdateOI updates the open interest of an option.
+func (c *Chain) UpdateOI(topic string, data *connector.OpenInterestData) {
+	quote, ok := c.topics[topic]
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	quote.OpenInterest = data.OpenInterest
+	quote.OpenInterestChange = data.OpenInterest - data.PreviousOi
+	row := *c.rows[quote.Instrument.Strike]
+	c.mu.Unlock()
+
+	if c.config.OnUpdate != nil {
+		c.config.OnUpdate(row)
+	}
+}
+
+// SetUnderlyingPrice sets the price of the underlying. When the at-the-money strike
+// changes, the window is moved in the background.
+func (c *Chain) SetUnderlyingPrice(price float64) {
+	c.mu.Lock()
+	c.underlying = price
+	target := c.nearest(price)
+	changed := target != c.target
+	c.target = target
+	c.mu.Unlock()
+
+	if changed {
+		select {
+		case c.recenter <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Underlying returns the last price of the underlying.
+func (c *Chain) Underlying() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.underlying
+}
+
+// ATM returns the strike at the centre of the subscribed window. It is false before
+// the window is subscribed.
+func (c *Chain) ATM() (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.atm < 0 {
+		return 0, false
+	}
+	return c.strikes[c.atm], true
+}
+
+// Rows returns the rows of the subscribed window by ascending strike.
+func (c *Chain) Rows() []Row {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.atm < 0 {
+		return nil
+	}
+	low, high := c.window(c.atm)
+	rows := make([]Row, 0, high-low)
+	for _, strike := range c.strikes[low:high] {
+		rows = append(rows, *c.rows[strike])
+	}
+	return rows
+}
+
+// Row returns the row of a strike, subscribed or not.
+func (c *Chain) Row(strike float64) (Row, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row, ok := c.rows[strike]
+	if !ok {
+		return Row{}, false
+	}
+	return *row, true
+}
+
+// Strikes returns every strike of the expiry in ascending order.
+func (c *Chain) Strikes() []float64 {
+	return append([]float64(nil), c.strikes...)
+}
+
+// run moves the window. It runs outside the message handlers, since subscribing waits
+// for the broker and the handlers are called in order.
+func (c *Chain) run() {
+	defer c.stopped.Done()
+	ticker := time.NewTicker(c.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.recenter:
+		case <-ticker.C:
+			if err := c.reacquire(); err != nil && c.config.OnError != nil {
+				c.config.OnError(err)
+			}
+		}
+
+		c.mu.Lock()
+		target := c.target
+		current := c.atm
+		c.mu.Unlock()
+		if target < 0 || target == current {
+			continue
+		}
+		if err := c.move(target); err != nil && c.config.OnError != nil {
+			c.config.OnError(err)
+		}
+	}
+}
+
+// reacquire takes the reference topic again when its handle ended with the previous
+// session, and marks the window as unsubscribed so that run moves it back in place.
+// It waits for the connector to reconnect.
+func (c *Chain) reacquire() error {
+	if !c.conn.IsConnected() {
+		return nil
+	}
+	if c.reference != nil && !c.reference.Active() {
+		subscription, err := c.acquire(connector.FeedMarketWatch, []string{c.config.ReferenceTopic})
+		if err != nil {
+			return err
+		}
+		c.reference.Release()
+		c.reference = subscription
+	}
+	if c.options != nil && !c.options.Active() {
+		c.mu.Lock()
+		c.atm = -1
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// move subscribes the window around the target strike, then releases the previous one.
+func (c *Chain) move(target int) error {
+	low, high := c.window(target)
+	var topics []string
+	for _, strike := range c.strikes[low:high] {
+		row := c.rows[strike]
+		for _, quote := range []*Quote{&row.Call, &row.Put} {
+			if quote.Instrument != nil {
+				topics = append(topics, quote.Instrument.Topic())
+			}
+		}
+	}
+
+	options, err := c.acquire(connector.FeedMarketWatch, topics)
+	if err != nil {
+		return err
+	}
+	var interest *connector.Subscription
+	if c.config.OpenInterest {
+		interest, err = c.acquire(connector.FeedOpenInterest, topics)
+		if err != nil {
+			options.Release()
+			return err
+		}
+	}
+
+	previousOptions, previousInterest := c.options, c.interest
+	c.options, c.interest = options, interest
+	c.mu.Lock()
+	c.atm = target
+	c.mu.Unlock()
+
+	if previousOptions != nil {
+		previousOptions.Release()
+	}
+	if previousInterest != nil {
+		previousInterest.Release()
+	}
+	return nil
+}
+
+func (c *Chain) acquire(feed connector.Feed, topics []string) (*connector.Subscription, error) {
+	subscription, response, err := c.conn.Acquire(feed, topics...)
+	if err == nil {
+		err = responseError(response)
+	}
+	if err != nil {
+		if subscription != nil {
+			subscription.Release()
+		}
+		return nil, fmt.Errorf("optionchain: %s: %w", feed.Name(), err)
+	}
+	return subscription, nil
+}
+
+// window returns the bounds in strikes of the window around the strike at index centre.
+func (c *Chain) window(centre int) (int, int) {
+	low := max(centre-c.config.Strikes, 0)
+	high := min(centre+c.config.Strikes+1, len(c.strikes))
+	return low, high
+}
+
+// nearest returns the index of the strike nearest to the price.
+func (c *Chain) nearest(price float64) int {
+	index := sort.SearchFloat64s(c.strikes, price)
+	if index == len(c.strikes) {
+		return index - 1
+	}
+	if index > 0 && math.Abs(c.strikes[index-1]-price) <= math.Abs(c.strikes[index]-price) {
+		return index - 1
+	}
+	return index
+}
+
+// responseError returns the message of a JSON response with a non-zero status.
+func responseError(response string) error {
+	var status struct {
+		Status  int
+		Message string
+	}
+	if err := json.Unmarshal([]byte(response), &status); err != nil {
+		return err
+	}
+	if status.Status != 0 {
+		return fmt.Errorf("status %d: %s", status.Status, status.Message)
+	}
+	return nil
+}
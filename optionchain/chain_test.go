@@ -0,0 +1,269 @@
+package optionchain
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/bridgetest"
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+var expiry = time.Date(2024, 10, 31, 0, 0, 0, 0, connector.IST)
+
+// master returns the NIFTY options of the expiry from 24000 to 26000 every 100, with
+// ids 1000 + 2 * strike index for calls and one more for puts, and the future 35001.
+// The 26000 strike only has a call.
+func master() *connector.InstrumentMaster {
+	instruments := []*connector.Instrument{
+		{Segment: "nsefo", InstrumentId: 35001, Name: "NIFTY", Expiry: expiry, PriceDivisor: 100},
+	}
+	for i := 0; i <= 20; i++ {
+		for j, optionType := range []string{"CE", "PE"} {
+			if i == 20 && optionType == "PE" {
+				continue
+			}
+			instruments = append(instruments, &connector.Instrument{
+				Segment:      "nsefo",
+				InstrumentId: uint32(1000 + 2*i + j),
+				Name:         "NIFTY",
+				Expiry:       expiry,
+				Strike:       24000 + 100*float64(i),
+				OptionType:   optionType,
+				PriceDivisor: 100,
+			})
+		}
+	}
+	return connector.NewInstrumentMaster(instruments)
+}
+
+// windowTopics returns the full MQTT topics of the options between the strikes.
+func windowTopics(feed connector.Feed, low float64, high float64) []string {
+	var topics []string
+	for i := 0; i <= 20; i++ {
+		strike := 24000 + 100*float64(i)
+		if strike < low || strike > high {
+			continue
+		}
+		topics = append(topics, fmt.Sprintf("%snsefo/%d", feed, 1000+2*i))
+		if i != 20 {
+			topics = append(topics, fmt.Sprintf("%snsefo/%d", feed, 1000+2*i+1))
+		}
+	}
+	return topics
+}
+
+// connectTest starts a fake bridge and connects the connector instance to it. The
+// instance is not reset between tests, since the connection lost handler of a dropped
+// connection may still be reading it.
+func connectTest(t *testing.T) (*bridgetest.Server, *connector.Connect) {
+	t.Helper()
+	srv, err := bridgetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.SetValidateTokenUrl(srv.TokenURL())
+	c := connector.GetInstance()
+	t.Cleanup(func() {
+		if c.IsConnected() {
+			c.DisconnectHost()
+		}
+		srv.Close()
+	})
+	c.Instruments = master()
+	if res, err := c.ConnectHost(srv.ConnectRequest("testuser")); err != nil {
+		t.Fatalf("ConnectHost: %s %v", res, err)
+	}
+	return srv, c
+}
+
+func newChain(t *testing.T, c *connector.Connect, config Config) *Chain {
+	t.Helper()
+	config.Underlying = "NIFTY"
+	config.Expiry = expiry
+	config.CheckInterval = 10 * time.Millisecond
+	config.OnError = func(err error) { t.Error(err) }
+	chain, err := New(c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Close() })
+	return chain
+}
+
+// eventually fails the test if condition does not hold within five seconds.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func subscribed(srv *bridgetest.Server, want ...[]string) func() bool {
+	var all []string
+	for _, topics := range want {
+		all = append(all, topics...)
+	}
+	sort.Strings(all)
+	return func() bool { return reflect.DeepEqual(srv.Subscriptions(), all) }
+}
+
+func TestNearest(t *testing.T) {
+	chain, err := New(&connector.Connect{Instruments: master()}, Config{Underlying: "NIFTY", Expiry: expiry, Strikes: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		price     float64
+		atm       float64
+		low, high float64
+	}{
+		{25000, 25000, 24800, 25200},
+		{25049.95, 25000, 24800, 25200},
+		{25050, 25000, 24800, 25200},
+		{25050.05, 25100, 24900, 25300},
+		{23000, 24000, 24000, 24200},
+		{24040, 24000, 24000, 24200},
+		{24140, 24100, 24000, 24300},
+		{25990, 26000, 25800, 26000},
+		{30000, 26000, 25800, 26000},
+	}
+	for _, test := range tests {
+		index := chain.nearest(test.price)
+		low, high := chain.window(index)
+		if chain.strikes[index] != test.atm || chain.strikes[low] != test.low || chain.strikes[high-1] != test.high {
+			t.Errorf("price %v: atm %v, window %v - %v; want %v, %v - %v",
+				test.price, chain.strikes[index], chain.strikes[low], chain.strikes[high-1], test.atm, test.low, test.high)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(&connector.Connect{}, Config{Underlying: "NIFTY", Expiry: expiry}); err == nil {
+		t.Error("New without an instrument master succeeded")
+	}
+	if _, err := New(&connector.Connect{Instruments: master()}, Config{Underlying: "NIFTY", Expiry: expiry.AddDate(0, 1, 0)}); err == nil {
+		t.Error("New for an expiry without options succeeded")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	srv, c := connectTest(t)
+	chain := newChain(t, c, Config{Strikes: 2, OpenInterest: true})
+	if _, ok := chain.ATM(); ok || chain.Rows() != nil {
+		t.Error("window subscribed before the underlying price is known")
+	}
+
+	chain.SetUnderlyingPrice(25040)
+	eventually(t, "the window around 25000", subscribed(srv,
+		windowTopics(connector.FeedMarketWatch, 24800, 25200), windowTopics(connector.FeedOpenInterest, 24800, 25200)))
+	if atm, ok := chain.ATM(); !ok || atm != 25000 {
+		t.Errorf("ATM = %v, %v; want 25000", atm, ok)
+	}
+	var strikes []float64
+	for _, row := range chain.Rows() {
+		strikes = append(strikes, row.Strike)
+	}
+	if !reflect.DeepEqual(strikes, []float64{24800, 24900, 25000, 25100, 25200}) {
+		t.Errorf("Rows have the strikes %v", strikes)
+	}
+
+	packets := len(srv.SubscribePackets())
+	chain.SetUnderlyingPrice(25120)
+	eventually(t, "the window around 25100", subscribed(srv,
+		windowTopics(connector.FeedMarketWatch, 24900, 25300), windowTopics(connector.FeedOpenInterest, 24900, 25300)))
+	if atm, _ := chain.ATM(); atm != 25100 {
+		t.Errorf("ATM = %v, want 25100", atm)
+	}
+	// Only the new strike is subscribed, and only the strike that left is unsubscribed.
+	if got := srv.SubscribePackets()[packets:]; !reflect.DeepEqual(got, []int{2, 2}) {
+		t.Errorf("re-centring sent SUBSCRIBE packets of %v topics, want the new strike on each feed", got)
+	}
+	if got := srv.UnsubscribePackets(); !reflect.DeepEqual(got, []int{2, 2}) {
+		t.Errorf("re-centring sent UNSUBSCRIBE packets of %v topics, want the old strike on each feed", got)
+	}
+
+	chain.SetUnderlyingPrice(26500)
+	eventually(t, "the window at the top of the chain", subscribed(srv,
+		windowTopics(connector.FeedMarketWatch, 25800, 26000), windowTopics(connector.FeedOpenInterest, 25800, 26000)))
+	if row, ok := chain.Row(26000); !ok || row.Put.Instrument != nil || row.Call.Instrument == nil {
+		t.Errorf("Row(26000) = %+v, %v; want a call only", row, ok)
+	}
+
+	if err := chain.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Subscriptions(); len(got) != 0 {
+		t.Errorf("subscriptions %v left after Close", got)
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	chain, err := New(&connector.Connect{Instruments: master()}, Config{Underlying: "NIFTY", Expiry: expiry, ReferenceTopic: "nsefo/35001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []Row
+	chain.config.OnUpdate = func(row Row) { rows = append(rows, row) }
+
+	tick := &connector.MWBOCombined{Ltp: 12050, BestBidPrice: 12000, BestAskPrice: 12100, BestBidQuantity: 50, BestAskQuantity: 75, TradedVolume: 1000, PriceDivisor: 100, LastTradedTime: 1729224000}
+	payload, err := connector.EncodeFeed(tick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.HandleMW(payload, "nsefo/1020")
+	chain.HandleMW(payload, "nsefo/9999")
+	oi, err := connector.EncodeFeed(&connector.OpenInterestData{OpenInterest: 5000, PreviousOi: 4000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.HandleOI(oi, "nsefo/1021")
+
+	row, _ := chain.Row(25000)
+	call, put := row.Call, row.Put
+	if call.Ltp != 120.5 || call.Bid != 120 || call.Ask != 121 || call.BidQuantity != 50 || call.AskQuantity != 75 || call.Volume != 1000 || !call.Updated.Equal(time.Unix(1729224000, 0)) {
+		t.Errorf("call %+v", call)
+	}
+	if put.OpenInterest != 5000 || put.OpenInterestChange != 1000 {
+		t.Errorf("put %+v", put)
+	}
+	if len(rows) != 2 {
+		t.Errorf("OnUpdate called %d times, want 2", len(rows))
+	}
+
+	chain.HandleMW(payload, "nsefo/35001")
+	if got := chain.Underlying(); got != 120.5 {
+		t.Errorf("Underlying = %v, want the price of the reference topic", got)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv, c := connectTest(t)
+	chain := newChain(t, c, Config{ReferenceTopic: "nsefo/35001", Strikes: 1})
+	reference := []string{string(connector.FeedMarketWatch) + "nsefo/35001"}
+	chain.SetUnderlyingPrice(25000)
+	eventually(t, "the window", subscribed(srv, reference, windowTopics(connector.FeedMarketWatch, 24900, 25100)))
+
+	srv.DropConnections()
+	eventually(t, "the session to end", func() bool { return !c.IsConnected() && !chain.reference.Active() })
+	if res, err := c.ConnectHost(srv.ConnectRequest("testuser")); err != nil {
+		t.Fatalf("reconnecting: %s %v", res, err)
+	}
+	eventually(t, "the window to be subscribed again", subscribed(srv, reference, windowTopics(connector.FeedMarketWatch, 24900, 25100)))
+	if atm, ok := chain.ATM(); !ok || atm != 25000 {
+		t.Errorf("ATM = %v, %v after reconnecting; want 25000", atm, ok)
+	}
+
+	// The handles of the new session move the window as before.
+	chain.SetUnderlyingPrice(25300)
+	eventually(t, "the window to move", subscribed(srv, reference, windowTopics(connector.FeedMarketWatch, 25200, 25400)))
+}
@@ -0,0 +1,238 @@
+// Package pricing values options with the Black-76 and Black-Scholes models, and solves
+// the implied volatility of option prices from the feed.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrExpired is returned for an option without time to expiry.
+	ErrExpired = errors.New("pricing: option expired")
+	// ErrOutOfBounds is returned when a price is below the discounted intrinsic value or
+	// above the discounted underlying, so that no volatility matches it.
+	ErrOutOfBounds = errors.New("pricing: price outside the no-arbitrage bounds")
+	// ErrNoConvergence is returned when the implied volatility search does not converge.
+	ErrNoConvergence = errors.New("pricing: implied volatility did not converge")
+)
+
+const (
+	// minVolatility and maxVolatility bound the implied volatility search.
+	minVolatility = 1e-6
+	maxVolatility = 10.0
+	// priceTolerance is the relative accuracy of the implied volatility search.
+	priceTolerance = 1e-10
+	maxIterations  = 100
+)
+
+// Model is the option pricing model.
+type Model int
+
+const (
+	// Black76 values options on a forward or a future; the Underlying of the Option is
+	// the price of the future.
+	Black76 Model = iota
+	// BlackScholes values options on a spot price, e.g. an index or an equity, with a
+	// continuous dividend yield.
+	BlackScholes
+)
+
+var modelNames = map[Model]string{
+	Black76:      "Black-76",
+	BlackScholes: "Black-Scholes",
+}
+
+// String returns the name of the model, e.g. "Black-76".
+func (m Model) String() string {
+	if name, ok := modelNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// Option describes a European option for valuation.
+type Option struct {
+	Model Model
+	// Call is true for a call and false for a put.
+	Call bool
+	// Underlying is the price of the future with Black76 and the spot price with
+	// BlackScholes.
+	Underlying float64
+	Strike     float64
+	// Years is the time to expiry in years, see YearsToExpiry.
+	Years float64
+	// Rate is the continuously compounded risk-free rate, e.g. 0.065.
+	Rate float64
+	// Dividend is the continuous dividend yield. It is ignored by Black76.
+	Dividend float64
+}
+
+// Greeks are the sensitivities of the value of an option.
+type Greeks struct {
+	// Delta is the change of value per unit change of the underlying.
+	Delta float64
+	// Gamma is the change of Delta per unit change of the underlying.
+	Gamma float64
+	// Vega is the change of value per one point of volatility, i.e. 0.01.
+	Vega float64
+	// Theta is the change of value per calendar day.
+	Theta float64
+}
+
+// forward returns the forward price, and its derivative with respect to the underlying.
+func (o Option) forward() (float64, float64) {
+	if o.Model == BlackScholes {
+		carry := math.Exp((o.Rate - o.Dividend) * o.Years)
+		return o.Underlying * carry, carry
+	}
+	return o.Underlying, 1
+}
+
+func (o Option) discount() float64 {
+	return math.Exp(-o.Rate * o.Years)
+}
+
+// bounds returns the range of values the option can take at any volatility.
+func (o Option) bounds() (float64, float64) {
+	forward, _ := o.forward()
+	discount := o.discount()
+	if o.Call {
+		return discount * math.Max(forward-o.Strike, 0), discount * forward
+	}
+	return discount * math.Max(o.Strike-forward, 0), discount * o.Strike
+}
+
+// d returns d1 and d2 of the Black formula.
+func (o Option) d(forward float64, volatility float64) (float64, float64) {
+	deviation := volatility * math.Sqrt(o.Years)
+	d1 := (math.Log(forward/o.Strike) + deviation*deviation/2) / deviation
+	return d1, d1 - deviation
+}
+
+// Price returns the value of the option at the volatility, e.g. 0.15 for 15%. Without
+// time to expiry or volatility, it is the discounted intrinsic value.
+func (o Option) Price(volatility float64) float64 {
+	if o.Years <= 0 || volatility <= 0 {
+		low, _ := o.bounds()
+		return low
+	}
+	forward, _ := o.forward()
+	d1, d2 := o.d(forward, volatility)
+	if o.Call {
+		return o.discount() * (forward*normCDF(d1) - o.Strike*normCDF(d2))
+	}
+	return o.discount() * (o.Strike*normCDF(-d2) - forward*normCDF(-d1))
+}
+
+// Greeks returns the sensitivities of the option at the volatility. Without time to
+// expiry or volatility, Delta is that of the intrinsic value and the others are zero.
+func (o Option) Greeks(volatility float64) Greeks {
+	forward, carry := o.forward()
+	discount := o.discount()
+	if o.Years <= 0 || volatility <= 0 {
+		var greeks Greeks
+		switch {
+		case o.Call && forward > o.Strike:
+			greeks.Delta = discount * carry
+		case !o.Call && forward < o.Strike:
+			greeks.Delta = -discount * carry
+		}
+		return greeks
+	}
+
+	d1, _ := o.d(forward, volatility)
+	root := math.Sqrt(o.Years)
+	density := normPDF(d1)
+
+	// The greeks are taken with respect to the forward, then carried to the underlying.
+	delta := discount * normCDF(d1)
+	if !o.Call {
+		delta = -discount * normCDF(-d1)
+	}
+	gamma := discount * density / (forward * volatility * root)
+
+	// Theta is minus the derivative by the time to expiry, with the underlying fixed.
+	price := o.Price(volatility)
+	decay := discount * forward * density * volatility / (2 * root)
+	theta := -decay + o.Rate*price
+	if o.Model == BlackScholes {
+		// The forward also moves with time at the cost of carry.
+		theta -= (o.Rate - o.Dividend) * forward * delta
+	}
+
+	return Greeks{
+		Delta: delta * carry,
+		Gamma: gamma * carry * carry,
+		Vega:  discount * forward * density * root / 100,
+		Theta: theta / 365,
+	}
+}
+
+// ImpliedVolatility returns the volatility at which the option is worth price. It
+// combines Newton steps with bisection, so that it converges for deep in and out of the
+// money options where the vega vanishes.
+func (o Option) ImpliedVolatility(price float64) (float64, error) {
+	if o.Years <= 0 {
+		return 0, ErrExpired
+	}
+	if o.Underlying <= 0 || o.Strike <= 0 {
+		return 0, fmt.Errorf("pricing: invalid underlying %v or strike %v", o.Underlying, o.Strike)
+	}
+	low, high := o.bounds()
+	if price < low*(1-priceTolerance) || price >= high {
+		return 0, fmt.Errorf("%w: %v not in [%v, %v)", ErrOutOfBounds, price, low, high)
+	}
+
+	lower, upper := minVolatility, maxVolatility
+	if o.Price(lower) >= price {
+		return lower, nil
+	}
+	if o.Price(upper) < price {
+		return 0, fmt.Errorf("%w: above %v", ErrOutOfBounds, upper)
+	}
+
+	// Brenner and Subrahmanyam's approximation for at the money options starts the search.
+	forward, _ := o.forward()
+	volatility := price / (o.discount() * forward) * math.Sqrt(2*math.Pi/o.Years)
+	if volatility <= lower || volatility >= upper {
+		volatility = (lower + upper) / 2
+	}
+
+	// Newton steps that leave the bracket, or do not halve the step before the last,
+	// fall back to bisection.
+	step := upper - lower
+	for i := 0; i < maxIterations; i++ {
+		difference := o.Price(volatility) - price
+		if math.Abs(difference) <= priceTolerance*price {
+			return volatility, nil
+		}
+		if difference > 0 {
+			upper = volatility
+		} else {
+			lower = volatility
+		}
+		if upper-lower <= minVolatility*1e-3 {
+			return volatility, nil
+		}
+
+		previous := step
+		vega := o.Greeks(volatility).Vega * 100
+		next := volatility - difference/vega
+		if vega <= 0 || math.IsNaN(next) || next <= lower || next >= upper || math.Abs(next-volatility) > previous/2 {
+			next = (lower + upper) / 2
+		}
+		step = math.Abs(next - volatility)
+		volatility = next
+	}
+	return 0, ErrNoConvergence
+}
+
+func normCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
@@ -0,0 +1,129 @@
+package pricing
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		option Option
+		vol    float64
+		want   float64
+	}{
+		{"black-scholes call", Option{Model: BlackScholes, Call: true, Underlying: 100, Strike: 100, Years: 1, Rate: 0.05}, 0.2, 10.4506},
+		{"black-scholes put", Option{Model: BlackScholes, Underlying: 100, Strike: 100, Years: 1, Rate: 0.05}, 0.2, 5.5735},
+		{"black-76 call", Option{Model: Black76, Call: true, Underlying: 100, Strike: 100, Years: 1, Rate: 0.05}, 0.2, 7.5771},
+		{"black-76 put", Option{Model: Black76, Underlying: 100, Strike: 100, Years: 1, Rate: 0.05}, 0.2, 7.5771},
+		{"expired call", Option{Call: true, Underlying: 110, Strike: 100}, 0.2, 10},
+		{"expired put", Option{Underlying: 110, Strike: 100}, 0.2, 0},
+	}
+	for _, test := range tests {
+		if got := test.option.Price(test.vol); math.Abs(got-test.want) > 1e-4 {
+			t.Errorf("%s: price %.5f, want %.4f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPutCallParity(t *testing.T) {
+	for _, model := range []Model{Black76, BlackScholes} {
+		call := Option{Model: model, Call: true, Underlying: 24850, Strike: 25000, Years: 12.0 / 365, Rate: 0.065, Dividend: 0.012}
+		put := call
+		put.Call = false
+		forward, _ := call.forward()
+		want := call.discount() * (forward - call.Strike)
+		if got := call.Price(0.14) - put.Price(0.14); math.Abs(got-want) > 1e-8 {
+			t.Errorf("%v: call - put = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestGreeksMatchFiniteDifferences(t *testing.T) {
+	const vol = 0.18
+	for _, option := range []Option{
+		{Model: Black76, Call: true, Underlying: 25000, Strike: 25200, Years: 20.0 / 365, Rate: 0.065},
+		{Model: Black76, Underlying: 25000, Strike: 24500, Years: 3.0 / 365, Rate: 0.065},
+		{Model: BlackScholes, Call: true, Underlying: 1500, Strike: 1450, Years: 0.25, Rate: 0.065, Dividend: 0.01},
+		{Model: BlackScholes, Underlying: 1500, Strike: 1600, Years: 0.5, Rate: 0.065, Dividend: 0.01},
+	} {
+		greeks := option.Greeks(vol)
+		shifted := func(underlying float64, years float64) float64 {
+			o := option
+			o.Underlying, o.Years = underlying, years
+			return o.Price(vol)
+		}
+		h := option.Underlying * 1e-4
+		delta := (shifted(option.Underlying+h, option.Years) - shifted(option.Underlying-h, option.Years)) / (2 * h)
+		gamma := (shifted(option.Underlying+h, option.Years) - 2*option.Price(vol) + shifted(option.Underlying-h, option.Years)) / (h * h)
+		vega := (option.Price(vol+1e-4) - option.Price(vol-1e-4)) / 2e-4 / 100
+		day := 1.0 / 365
+		theta := (shifted(option.Underlying, option.Years-day/100) - option.Price(vol)) * 100
+
+		for _, check := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"delta", greeks.Delta, delta},
+			{"gamma", greeks.Gamma, gamma},
+			{"vega", greeks.Vega, vega},
+			{"theta", greeks.Theta, theta},
+		} {
+			if math.Abs(check.got-check.want) > 1e-3*math.Max(1, math.Abs(check.want)) {
+				t.Errorf("%+v: %s %v, want %v", option, check.name, check.got, check.want)
+			}
+		}
+	}
+}
+
+func TestImpliedVolatilityRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		option Option
+	}{
+		{"at the money", Option{Model: Black76, Call: true, Underlying: 25000, Strike: 25000, Years: 7.0 / 365, Rate: 0.065}},
+		{"deep in the money call", Option{Model: Black76, Call: true, Underlying: 25000, Strike: 22000, Years: 7.0 / 365, Rate: 0.065}},
+		{"far out of the money put", Option{Model: Black76, Underlying: 25000, Strike: 23500, Years: 7.0 / 365, Rate: 0.065}},
+		{"expiry day", Option{Model: Black76, Call: true, Underlying: 25000, Strike: 25050, Years: 2.0 / (365 * 24), Rate: 0.065}},
+		{"long dated", Option{Model: BlackScholes, Underlying: 1500, Strike: 1800, Years: 2, Rate: 0.065, Dividend: 0.01}},
+	}
+	for _, test := range tests {
+		for _, vol := range []float64{0.05, 0.15, 0.4, 1.5} {
+			price := test.option.Price(vol)
+			if low, _ := test.option.bounds(); price-low < 1e-6*price {
+				// The price carries no information on the volatility.
+				continue
+			}
+			got, err := test.option.ImpliedVolatility(price)
+			if err != nil {
+				t.Errorf("%s at %v: %v", test.name, vol, err)
+				continue
+			}
+			if math.Abs(got-vol) > 1e-6*math.Max(1, vol) && math.Abs(test.option.Price(got)-price) > 1e-9*price {
+				t.Errorf("%s: implied volatility %v of price %v, want %v", test.name, got, price, vol)
+			}
+		}
+	}
+}
+
+func TestImpliedVolatilityErrors(t *testing.T) {
+	call := Option{Model: Black76, Call: true, Underlying: 100, Strike: 90, Years: 0.1, Rate: 0.05}
+	expired := call
+	expired.Years = 0
+	tests := []struct {
+		name   string
+		option Option
+		price  float64
+		err    error
+	}{
+		{"expired", expired, 10, ErrExpired},
+		{"below intrinsic", call, 5, ErrOutOfBounds},
+		{"above the underlying", call, 120, ErrOutOfBounds},
+	}
+	for _, test := range tests {
+		if _, err := test.option.ImpliedVolatility(test.price); !errors.Is(err, test.err) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
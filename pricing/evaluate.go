@@ -0,0 +1,125 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// ExpiryClock is the time of day options expire on their expiry date, in IST.
+var ExpiryClock = 15*time.Hour + 30*time.Minute
+
+// year is the length of a year for YearsToExpiry.
+const year = 365 * 24 * time.Hour
+
+// ExpiryTime returns the expiry of a contract expiring on the date of expiry, e.g. the
+// Expiry of an Instrument, at ExpiryClock IST.
+func ExpiryTime(expiry time.Time) time.Time {
+	y, m, d := expiry.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, connector.IST).Add(ExpiryClock)
+}
+
+// YearsToExpiry returns the time from now to the expiry of a contract expiring on the
+// date of expiry, in years of 365 days. It is zero once the contract expired.
+func YearsToExpiry(expiry time.Time, now time.Time) float64 {
+	remaining := ExpiryTime(expiry).Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	return float64(remaining) / float64(year)
+}
+
+// Analytics are the implied volatility and greeks of an option at one tick.
+type Analytics struct {
+	// Price is the option price solved for, and Underlying the underlying price used.
+	Price      float64
+	Underlying float64
+	// ImpliedVolatility is annualised, e.g. 0.15 for 15%.
+	ImpliedVolatility float64
+	Greeks
+	// Time is the time the option was priced at, from which the time to expiry runs.
+	Time time.Time
+}
+
+// Pricer computes the analytics of option ticks.
+//
+//	pricer := &pricing.Pricer{Model: pricing.Black76, Rate: 0.065}
+//	analytics, err := pricer.Evaluate(instrument, &tick, futurePrice)
+//	if err == nil {
+//		fmt.Println(analytics.ImpliedVolatility, analytics.Delta)
+//	}
+type Pricer struct {
+	Model Model
+	// Rate is the continuously compounded risk-free rate, e.g. 0.065.
+	Rate float64
+	// Dividend is the continuous dividend yield of the underlying, for BlackScholes.
+	Dividend float64
+	// Now returns the evaluation time of quoted prices. Defaults to time.Now.
+	Now func() time.Time
+}
+
+func (p *Pricer) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// Option returns the option of the instrument at the underlying price and time.
+func (p *Pricer) Option(instrument *connector.Instrument, underlying float64, now time.Time) (Option, error) {
+	if !instrument.IsOption() {
+		return Option{}, fmt.Errorf("pricing: %s is not an option", instrument.Topic())
+	}
+	return Option{
+		Model:      p.Model,
+		Call:       instrument.OptionType == "CE",
+		Underlying: underlying,
+		Strike:     instrument.Strike,
+		Years:      YearsToExpiry(instrument.Expiry, now),
+		Rate:       p.Rate,
+		Dividend:   p.Dividend,
+	}, nil
+}
+
+// Evaluate computes the analytics of a MarketWatch tick of the option instrument, at
+// the price of the underlying: the future with Black76, or the spot with BlackScholes.
+// The option is priced at the middle of the best bid and ask when both are quoted, with
+// the time to expiry measured from now, as the quotes are current. Otherwise it is
+// priced at the last traded price, with the time to expiry measured from the
+// LastTradedTime of the tick, which may be much older for an illiquid strike.
+func (p *Pricer) Evaluate(instrument *connector.Instrument, tick *connector.MWBOCombined, underlying float64) (Analytics, error) {
+	if tick.BestBidPrice > 0 && tick.BestAskPrice > tick.BestBidPrice {
+		price := (tick.Price(tick.BestBidPrice) + tick.Price(tick.BestAskPrice)) / 2
+		return p.EvaluatePrice(instrument, price, underlying, p.now())
+	}
+	price := tick.Price(tick.Ltp)
+	if price <= 0 {
+		return Analytics{}, fmt.Errorf("pricing: %s has no price", instrument.Topic())
+	}
+	at := p.now()
+	if tick.LastTradedTime != 0 {
+		at = tick.TradedAt()
+	}
+	return p.EvaluatePrice(instrument, price, underlying, at)
+}
+
+// EvaluatePrice computes the analytics of the option instrument worth price at the
+// underlying price and time.
+func (p *Pricer) EvaluatePrice(instrument *connector.Instrument, price float64, underlying float64, at time.Time) (Analytics, error) {
+	option, err := p.Option(instrument, underlying, at)
+	if err != nil {
+		return Analytics{}, err
+	}
+	volatility, err := option.ImpliedVolatility(price)
+	if err != nil {
+		return Analytics{}, fmt.Errorf("%s: %w", instrument.Topic(), err)
+	}
+	return Analytics{
+		Price:             price,
+		Underlying:        underlying,
+		ImpliedVolatility: volatility,
+		Greeks:            option.Greeks(volatility),
+		Time:              at,
+	}, nil
+}
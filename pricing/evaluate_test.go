@@ -0,0 +1,79 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestYearsToExpiry(t *testing.T) {
+	expiry := time.Date(2024, 10, 24, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		now  time.Time
+		want float64
+	}{
+		{time.Date(2024, 10, 23, 15, 30, 0, 0, connector.IST), 1.0 / 365},
+		{time.Date(2024, 10, 24, 9, 30, 0, 0, connector.IST), 0.25 / 365},
+		{time.Date(2024, 10, 24, 15, 30, 0, 0, connector.IST), 0},
+		{time.Date(2024, 10, 25, 0, 0, 0, 0, connector.IST), 0},
+	}
+	for _, test := range tests {
+		if got := YearsToExpiry(expiry, test.now); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("YearsToExpiry at %v: %v, want %v", test.now, got, test.want)
+		}
+	}
+}
+
+func TestEvaluateTime(t *testing.T) {
+	instrument := &connector.Instrument{Segment: "nsefo", InstrumentId: 54452, OptionType: "CE", Strike: 25000,
+		Expiry: time.Date(2024, 10, 24, 0, 0, 0, 0, time.UTC)}
+	now := time.Date(2024, 10, 24, 14, 0, 0, 0, connector.IST)
+	traded := time.Date(2024, 10, 23, 11, 0, 0, 0, connector.IST)
+	pricer := &Pricer{Model: Black76, Rate: 0.065, Now: func() time.Time { return now }}
+
+	tests := []struct {
+		name  string
+		tick  connector.MWBOCombined
+		price float64
+		time  time.Time
+	}{
+		{
+			name:  "quoted",
+			tick:  connector.MWBOCombined{Ltp: 9000, BestBidPrice: 4000, BestAskPrice: 4200, PriceDivisor: 100, LastTradedTime: int32(traded.Unix())},
+			price: 41,
+			time:  now,
+		},
+		{
+			name:  "last trade",
+			tick:  connector.MWBOCombined{Ltp: 9000, PriceDivisor: 100, LastTradedTime: int32(traded.Unix())},
+			price: 90,
+			time:  traded,
+		},
+		{
+			name:  "last trade without time",
+			tick:  connector.MWBOCombined{Ltp: 4100, PriceDivisor: 100},
+			price: 41,
+			time:  now,
+		},
+	}
+	for _, test := range tests {
+		analytics, err := pricer.Evaluate(instrument, &test.tick, 25000)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if analytics.Price != test.price || !analytics.Time.Equal(test.time) {
+			t.Errorf("%s: priced %v at %v, want %v at %v", test.name, analytics.Price, analytics.Time, test.price, test.time)
+		}
+		option, _ := pricer.Option(instrument, 25000, test.time)
+		if got := option.Price(analytics.ImpliedVolatility); math.Abs(got-test.price) > 1e-6 {
+			t.Errorf("%s: implied volatility reprices to %v, want %v", test.name, got, test.price)
+		}
+	}
+
+	if _, err := pricer.Evaluate(instrument, &connector.MWBOCombined{PriceDivisor: 100}, 25000); err == nil {
+		t.Error("Evaluate succeeded without a price")
+	}
+}
@@ -0,0 +1,438 @@
+// Package risk raises client side pre-trade safety signals from the feeds the client
+// already receives: the exposure and P&L of the trade updates and the circuit limits.
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+	"github.com/IIFLSecurities/bridgeGo/trading"
+)
+
+// Rule is a risk rule of a Guard.
+type Rule int
+
+const (
+	// ExposureLimit is the value of the net position of an instrument at its last
+	// traded price above its MaxExposure.
+	ExposureLimit Rule = iota + 1
+	// QuantityLimit is the net quantity of an instrument above its MaxNetQuantity.
+	QuantityLimit
+	// GrossExposureLimit is the sum of the exposures of all instruments above
+	// MaxGrossExposure.
+	GrossExposureLimit
+	// DailyLossLimit is a loss, realized and unrealized, of MaxDailyLoss or more.
+	DailyLossLimit
+	// NearUpperCircuit is a last traded price within CircuitProximityPercent of the
+	// upper circuit.
+	NearUpperCircuit
+	// NearLowerCircuit is a last traded price within CircuitProximityPercent of the
+	// lower circuit.
+	NearLowerCircuit
+	// MissingPrice is an order checked without a price while no last traded price of
+	// its instrument is known, so that its exposure cannot be measured. It is only
+	// reported by Check.
+	MissingPrice
+)
+
+var ruleNames = map[Rule]string{
+	ExposureLimit:      "exposure limit",
+	QuantityLimit:      "quantity limit",
+	GrossExposureLimit: "gross exposure limit",
+	DailyLossLimit:     "daily loss limit",
+	NearUpperCircuit:   "near upper circuit",
+	NearLowerCircuit:   "near lower circuit",
+	MissingPrice:       "missing price",
+}
+
+// String returns the name of the rule, e.g. "daily loss limit".
+func (r Rule) String() string {
+	if name, ok := ruleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Rule(%d)", int(r))
+}
+
+// Breach is a rule that started, or stopped, to be breached.
+type Breach struct {
+	Rule Rule
+	// Topic is the instrument of the rule, e.g. "nseeq/2885", or empty for the account
+	// wide rules.
+	Topic string
+	// Value is the measure of the rule, e.g. the exposure or the loss, and Limit its
+	// limit. For the circuit rules, Value is the last traded price and Limit the
+	// circuit limit.
+	Value float64
+	Limit float64
+	// Active is true when the breach starts and false when it ends.
+	Active bool
+	Time   time.Time
+}
+
+// String describes the breach, e.g. "daily loss limit breached: 52000 of 50000".
+func (b Breach) String() string {
+	subject := b.Rule.String()
+	if b.Topic != "" {
+		subject = b.Topic + " " + subject
+	}
+	if b.Rule == MissingPrice {
+		return subject + ": no price to measure the exposure"
+	}
+	if !b.Active {
+		return fmt.Sprintf("%s cleared: %v of %v", subject, b.Value, b.Limit)
+	}
+	return fmt.Sprintf("%s breached: %v of %v", subject, b.Value, b.Limit)
+}
+
+// InstrumentLimits are the limits of one instrument.
+type InstrumentLimits struct {
+	// MaxExposure is the highest absolute value of the net position. Zero disables the
+	// rule.
+	MaxExposure float64
+	// MaxNetQuantity is the highest absolute net quantity. Zero disables the rule.
+	MaxNetQuantity int64
+}
+
+// Limits are the limits of a Guard. Zero limits disable their rule.
+type Limits struct {
+	// InstrumentLimits apply to every instrument without an entry in Instruments.
+	InstrumentLimits
+	// Instruments holds the limits of specific instruments by topic.
+	Instruments map[string]InstrumentLimits
+	// MaxGrossExposure is the highest sum of the absolute exposures of all instruments.
+	MaxGrossExposure float64
+	// MaxDailyLoss is the highest loss, as a positive amount, of the realized and
+	// unrealized P&L of the positions.
+	MaxDailyLoss float64
+	// CircuitProximityPercent breaches the circuit rules of an instrument when its last
+	// traded price is within this percentage of a circuit limit.
+	CircuitProximityPercent float64
+}
+
+func (l *Limits) instrument(topic string) InstrumentLimits {
+	if limits, ok := l.Instruments[topic]; ok {
+		return limits
+	}
+	return l.InstrumentLimits
+}
+
+// GuardConfig configures a Guard.
+type GuardConfig struct {
+	Limits Limits
+	// Positions is the position book the limits apply to. When nil, the Guard keeps its
+	// own, without multipliers. A shared book may also be fed by its owner: fills with an
+	// exchange trade id are applied once. The exposures use the Multipliers of its
+	// configuration.
+	Positions *trading.PositionBook
+	// OnBreach is called when a rule starts or stops being breached.
+	OnBreach func(Breach)
+}
+
+// Guard evaluates risk rules on each trade update, MarketWatch tick and circuit update,
+// and reports the rules that start or stop being breached. Check tells whether an order
+// would breach a rule before it is sent. The loss is measured from the trades seen by
+// the position book, so a Guard is created for each trading day.
+//
+//	guard := risk.NewGuard(risk.GuardConfig{
+//		Limits: risk.Limits{
+//			InstrumentLimits:        risk.InstrumentLimits{MaxExposure: 500000},
+//			MaxDailyLoss:            25000,
+//			CircuitProximityPercent: 1,
+//		},
+//		OnBreach: func(breach risk.Breach) {
+//			fmt.Println(breach)
+//		},
+//	})
+//	conn.TradeUpdatesHandler = guard.HandleTrade
+//	conn.MWHandler = guard.HandleMW
+//	conn.UpperCircuitHandler = guard.HandleUpperCircuit
+//	conn.LowerCircuitHandler = guard.HandleLowerCircuit
+//
+//	if breaches := guard.Check("nseeq/2885", 100, 1520.5); len(breaches) != 0 {
+//		return fmt.Errorf("order blocked: %v", breaches[0])
+//	}
+type Guard struct {
+	positions *trading.PositionBook
+	onBreach  func(Breach)
+
+	mu     sync.Mutex
+	limits Limits
+	prices map[string]float64
+	upper  map[string]float64
+	lower  map[string]float64
+	active map[breachKey]Breach
+}
+
+type breachKey struct {
+	rule  Rule
+	topic string
+}
+
+// NewGuard returns a Guard.
+func NewGuard(config GuardConfig) *Guard {
+	positions := config.Positions
+	if positions == nil {
+		positions = trading.NewPositionBook(trading.PositionConfig{})
+	}
+	return &Guard{
+		positions: positions,
+		onBreach:  config.OnBreach,
+		limits:    config.Limits,
+		prices:    map[string]float64{},
+		upper:     map[string]float64{},
+		lower:     map[string]float64{},
+		active:    map[breachKey]Breach{},
+	}
+}
+
+// Positions returns the position book of the guard.
+func (g *Guard) Positions() *trading.PositionBook {
+	return g.positions
+}
+
+// SetLimits replaces the limits and evaluates every rule against them.
+func (g *Guard) SetLimits(limits Limits) {
+	g.mu.Lock()
+	g.limits = limits
+	topics := make([]string, 0, len(g.prices))
+	for topic := range g.prices {
+		topics = append(topics, topic)
+	}
+	for _, position := range g.positions.Positions() {
+		if _, ok := g.prices[position.Topic]; !ok {
+			topics = append(topics, position.Topic)
+		}
+	}
+	var breaches []Breach
+	for _, topic := range topics {
+		breaches = g.evaluateInstrument(breaches, topic)
+	}
+	breaches = g.evaluateAccount(breaches)
+	g.mu.Unlock()
+
+	g.report(breaches)
+}
+
+// HandleTrade decodes a Trade Updates payload and applies it. It has the signature of
+// the Connect handler fields, so that it can be set as TradeUpdatesHandler.
+func (g *Guard) HandleTrade(payload []byte, topic string) {
+	trade, err := connector.DecodeTradeUpdate(payload)
+	if err != nil {
+		return
+	}
+	g.ApplyTrade(trade)
+}
+
+// HandleMW decodes a MarketWatch payload and applies its last traded price.
+func (g *Guard) HandleMW(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil || tick.Ltp <= 0 {
+		return
+	}
+	g.ApplyPrice(topic, tick.Price(tick.Ltp))
+}
+
+// HandleUpperCircuit records the upper circuit limit carried by the payload.
+func (g *Guard) HandleUpperCircuit(payload []byte, topic string) {
+	if data, err := connector.DecodeUpperCircuit(payload); err == nil {
+		g.SetCircuits(connector.InstrumentTopic(topic, data.InstrumentId), data.Price(), 0)
+	}
+}
+
+// HandleLowerCircuit records the lower circuit limit carried by the payload.
+func (g *Guard) HandleLowerCircuit(payload []byte, topic string) {
+	if data, err := connector.DecodeLowerCircuit(payload); err == nil {
+		g.SetCircuits(connector.InstrumentTopic(topic, data.InstrumentId), 0, data.Price())
+	}
+}
+
+// ApplyTrade applies a fill to the position book and evaluates the rules.
+func (g *Guard) ApplyTrade(trade connector.TradeUpdate) {
+	g.positions.Apply(trade)
+	topic := trade.Topic()
+
+	g.mu.Lock()
+	breaches := g.evaluateInstrument(nil, topic)
+	breaches = g.evaluateAccount(breaches)
+	g.mu.Unlock()
+
+	g.report(breaches)
+}
+
+// ApplyPrice marks the instrument to its last traded price and evaluates the rules.
+func (g *Guard) ApplyPrice(topic string, price float64) {
+	g.positions.Mark(topic, price)
+
+	g.mu.Lock()
+	g.prices[topic] = price
+	breaches := g.evaluateInstrument(nil, topic)
+	breaches = g.evaluateAccount(breaches)
+	g.mu.Unlock()
+
+	g.report(breaches)
+}
+
+// SetCircuits sets the circuit limits of the topic, e.g. "nseeq/2885"; zero leaves a
+// limit unchanged.
+func (g *Guard) SetCircuits(topic string, upper float64, lower float64) {
+	g.mu.Lock()
+	if upper > 0 {
+		g.upper[topic] = upper
+	}
+	if lower > 0 {
+		g.lower[topic] = lower
+	}
+	breaches := g.evaluateInstrument(nil, topic)
+	g.mu.Unlock()
+
+	g.report(breaches)
+}
+
+// evaluateInstrument evaluates the rules of the topic and appends the changes.
+func (g *Guard) evaluateInstrument(breaches []Breach, topic string) []Breach {
+	limits := g.limits.instrument(topic)
+	quantity, value := g.positions.Exposure(topic)
+	exposure := math.Abs(value)
+	net := quantity
+	if net < 0 {
+		net = -net
+	}
+	breaches = g.set(breaches, ExposureLimit, topic, exposure, limits.MaxExposure, limits.MaxExposure > 0 && exposure > limits.MaxExposure)
+	breaches = g.set(breaches, QuantityLimit, topic, float64(net), float64(limits.MaxNetQuantity), limits.MaxNetQuantity > 0 && net > limits.MaxNetQuantity)
+
+	price, proximity := g.prices[topic], g.limits.CircuitProximityPercent
+	upper, lower := g.upper[topic], g.lower[topic]
+	breaches = g.set(breaches, NearUpperCircuit, topic, price, upper,
+		proximity > 0 && price > 0 && upper > 0 && (upper-price)/upper*100 <= proximity)
+	breaches = g.set(breaches, NearLowerCircuit, topic, price, lower,
+		proximity > 0 && price > 0 && lower > 0 && (price-lower)/lower*100 <= proximity)
+	return breaches
+}
+
+// evaluateAccount evaluates the account wide rules and appends the changes.
+func (g *Guard) evaluateAccount(breaches []Breach) []Breach {
+	gross := g.positions.GrossExposure()
+	breaches = g.set(breaches, GrossExposureLimit, "", gross, g.limits.MaxGrossExposure,
+		g.limits.MaxGrossExposure > 0 && gross > g.limits.MaxGrossExposure)
+
+	realized, unrealized := g.positions.PnL()
+	loss := math.Max(-(realized + unrealized), 0)
+	return g.set(breaches, DailyLossLimit, "", loss, g.limits.MaxDailyLoss,
+		g.limits.MaxDailyLoss > 0 && loss >= g.limits.MaxDailyLoss)
+}
+
+// set records whether the rule is breached and appends a Breach when that changed.
+func (g *Guard) set(breaches []Breach, rule Rule, topic string, value float64, limit float64, breached bool) []Breach {
+	key := breachKey{rule: rule, topic: topic}
+	if _, active := g.active[key]; active == breached {
+		if breached {
+			g.active[key] = Breach{Rule: rule, Topic: topic, Value: value, Limit: limit, Active: true, Time: g.active[key].Time}
+		}
+		return breaches
+	}
+	breach := Breach{Rule: rule, Topic: topic, Value: value, Limit: limit, Active: breached, Time: time.Now()}
+	if breached {
+		g.active[key] = breach
+	} else {
+		delete(g.active, key)
+	}
+	return append(breaches, breach)
+}
+
+func (g *Guard) report(breaches []Breach) {
+	if g.onBreach == nil {
+		return
+	}
+	for _, breach := range breaches {
+		g.onBreach(breach)
+	}
+}
+
+// Breaches returns the rules currently breached, with their latest values.
+func (g *Guard) Breaches() []Breach {
+	g.mu.Lock()
+	breaches := make([]Breach, 0, len(g.active))
+	for _, breach := range g.active {
+		breaches = append(breaches, breach)
+	}
+	g.mu.Unlock()
+
+	sort.Slice(breaches, func(i, j int) bool {
+		if breaches[i].Topic != breaches[j].Topic {
+			return breaches[i].Topic < breaches[j].Topic
+		}
+		return breaches[i].Rule < breaches[j].Rule
+	})
+	return breaches
+}
+
+// Check returns the rules an order of quantity, negative for a sell, on the topic at
+// price would breach, without changing the state of the guard. It reports:
+//   - the exposure and quantity limits the position after a full fill would exceed,
+//     unless the order reduces the position
+//   - the gross exposure limit, under the same condition
+//   - the daily loss limit, when breached, for orders that are not reducing
+//   - the circuit rules in the direction of the order: buys near the upper circuit and
+//     sells near the lower circuit
+//   - MissingPrice, instead of the exposure limits, when price is zero, no last traded
+//     price is known and an exposure limit is set
+//
+// The exposure uses the multiplier of the topic configured on the position book.
+func (g *Guard) Check(topic string, quantity int64, price float64) []Breach {
+	now := time.Now()
+	net, value := g.positions.Exposure(topic)
+	after := net + quantity
+	reducing := abs(after) <= abs(net)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	limits := g.limits.instrument(topic)
+	if price <= 0 {
+		price = g.prices[topic]
+	}
+	var breaches []Breach
+	breach := func(rule Rule, value float64, limit float64) {
+		breaches = append(breaches, Breach{Rule: rule, Topic: topic, Value: value, Limit: limit, Active: true, Time: now})
+	}
+
+	if !reducing {
+		if limits.MaxNetQuantity > 0 && abs(after) > limits.MaxNetQuantity {
+			breach(QuantityLimit, float64(abs(after)), float64(limits.MaxNetQuantity))
+		}
+		switch {
+		case limits.MaxExposure <= 0 && g.limits.MaxGrossExposure <= 0:
+		case price <= 0:
+			breach(MissingPrice, 0, 0)
+		default:
+			exposure := math.Abs(float64(after)) * price * g.positions.Multiplier(topic)
+			if limits.MaxExposure > 0 && exposure > limits.MaxExposure {
+				breach(ExposureLimit, exposure, limits.MaxExposure)
+			}
+			gross := g.positions.GrossExposure() - math.Abs(value) + exposure
+			if g.limits.MaxGrossExposure > 0 && gross > g.limits.MaxGrossExposure {
+				breaches = append(breaches, Breach{Rule: GrossExposureLimit, Value: gross, Limit: g.limits.MaxGrossExposure, Active: true, Time: now})
+			}
+		}
+		if loss, ok := g.active[breachKey{rule: DailyLossLimit}]; ok {
+			breaches = append(breaches, loss)
+		}
+	}
+	if active, ok := g.active[breachKey{rule: NearUpperCircuit, topic: topic}]; ok && quantity > 0 {
+		breaches = append(breaches, active)
+	}
+	if active, ok := g.active[breachKey{rule: NearLowerCircuit, topic: topic}]; ok && quantity < 0 {
+		breaches = append(breaches, active)
+	}
+	return breaches
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,225 @@
+package risk
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+	"github.com/IIFLSecurities/bridgeGo/trading"
+)
+
+const topic = "nseeq/2885"
+
+func fill(id string, quantity int64, price float64) connector.TradeUpdate {
+	side := connector.TransactionBuy
+	if quantity < 0 {
+		side, quantity = connector.TransactionSell, -quantity
+	}
+	return connector.TradeUpdate{
+		Exchange:        "NSEEQ",
+		InstrumentId:    2885,
+		ExchangeTradeId: id,
+		TransactionType: side,
+		Product:         "INTRADAY",
+		TradedQuantity:  quantity,
+		TradedPrice:     price,
+	}
+}
+
+// event is a Breach without its values and time.
+type event struct {
+	rule   Rule
+	topic  string
+	active bool
+}
+
+func events(breaches []Breach) []event {
+	result := []event{}
+	for _, breach := range breaches {
+		result = append(result, event{breach.Rule, breach.Topic, breach.Active})
+	}
+	return result
+}
+
+func TestGuardBreaches(t *testing.T) {
+	limits := Limits{
+		InstrumentLimits:        InstrumentLimits{MaxExposure: 150000, MaxNetQuantity: 120},
+		MaxGrossExposure:        200000,
+		MaxDailyLoss:            5000,
+		CircuitProximityPercent: 1,
+	}
+	tests := []struct {
+		name   string
+		apply  func(g *Guard)
+		events []event
+	}{
+		{
+			name:  "within limits",
+			apply: func(g *Guard) { g.ApplyTrade(fill("1", 100, 1000)) },
+		},
+		{
+			name:   "exposure",
+			apply:  func(g *Guard) { g.ApplyTrade(fill("1", 100, 1000)); g.ApplyPrice(topic, 1600) },
+			events: []event{{ExposureLimit, topic, true}},
+		},
+		{
+			name: "exposure cleared",
+			apply: func(g *Guard) {
+				g.ApplyTrade(fill("1", 100, 1000))
+				g.ApplyPrice(topic, 1600)
+				g.ApplyPrice(topic, 1700)
+				g.ApplyPrice(topic, 1400)
+			},
+			events: []event{{ExposureLimit, topic, true}, {ExposureLimit, topic, false}},
+		},
+		{
+			name:   "quantity",
+			apply:  func(g *Guard) { g.ApplyTrade(fill("1", -130, 100)) },
+			events: []event{{QuantityLimit, topic, true}},
+		},
+		{
+			name: "gross exposure",
+			apply: func(g *Guard) {
+				g.ApplyTrade(fill("1", 100, 1000))
+				g.ApplyTrade(connector.TradeUpdate{Exchange: "NSEEQ", InstrumentId: 1594, ExchangeTradeId: "2",
+					TransactionType: connector.TransactionBuy, Product: "INTRADAY", TradedQuantity: 100, TradedPrice: 1100})
+			},
+			events: []event{{GrossExposureLimit, "", true}},
+		},
+		{
+			name:   "daily loss",
+			apply:  func(g *Guard) { g.ApplyTrade(fill("1", 100, 1000)); g.ApplyPrice(topic, 950) },
+			events: []event{{DailyLossLimit, "", true}},
+		},
+		{
+			name: "near upper circuit",
+			apply: func(g *Guard) {
+				g.SetCircuits(topic, 1100, 900)
+				g.ApplyPrice(topic, 1095)
+				g.ApplyPrice(topic, 1000)
+			},
+			events: []event{{NearUpperCircuit, topic, true}, {NearUpperCircuit, topic, false}},
+		},
+		{
+			name:   "near lower circuit",
+			apply:  func(g *Guard) { g.ApplyPrice(topic, 905); g.SetCircuits(topic, 1100, 900) },
+			events: []event{{NearLowerCircuit, topic, true}},
+		},
+		{
+			name: "instrument limits",
+			apply: func(g *Guard) {
+				g.SetLimits(Limits{Instruments: map[string]InstrumentLimits{topic: {MaxNetQuantity: 50}}})
+				g.ApplyTrade(fill("1", 100, 1000))
+			},
+			events: []event{{QuantityLimit, topic, true}},
+		},
+		{
+			name: "limits raised",
+			apply: func(g *Guard) {
+				g.ApplyTrade(fill("1", -130, 100))
+				g.SetLimits(Limits{})
+			},
+			events: []event{{QuantityLimit, topic, true}, {QuantityLimit, topic, false}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var reported []Breach
+			guard := NewGuard(GuardConfig{Limits: limits, OnBreach: func(breach Breach) {
+				reported = append(reported, breach)
+			}})
+			test.apply(guard)
+			if got := events(reported); len(got)+len(test.events) > 0 && !reflect.DeepEqual(got, test.events) {
+				t.Errorf("reported %v, want %v", got, test.events)
+			}
+			active := []event{}
+			for _, event := range test.events {
+				if event.active {
+					active = append(active, event)
+				} else if len(active) > 0 {
+					active = active[:len(active)-1]
+				}
+			}
+			if got := events(guard.Breaches()); !reflect.DeepEqual(got, active) {
+				t.Errorf("active %v, want %v", got, active)
+			}
+		})
+	}
+}
+
+func TestGuardCheck(t *testing.T) {
+	positions := trading.NewPositionBook(trading.PositionConfig{Multipliers: map[string]float64{"nsefo/35001": 50}})
+	guard := NewGuard(GuardConfig{
+		Positions: positions,
+		Limits: Limits{
+			InstrumentLimits:        InstrumentLimits{MaxExposure: 150000, MaxNetQuantity: 200},
+			MaxDailyLoss:            5000,
+			CircuitProximityPercent: 1,
+		},
+	})
+	guard.ApplyTrade(fill("1", 100, 1000))
+	guard.ApplyPrice(topic, 1000)
+	guard.SetCircuits(topic, 1005, 900)
+
+	tests := []struct {
+		name     string
+		topic    string
+		quantity int64
+		price    float64
+		rules    []Rule
+	}{
+		{"within limits", topic, -50, 1000, nil},
+		{"buy near the upper circuit", topic, 10, 1000, []Rule{NearUpperCircuit}},
+		{"exposure", topic, 60, 0, []Rule{ExposureLimit, NearUpperCircuit}},
+		{"quantity", topic, 110, 1, []Rule{QuantityLimit, NearUpperCircuit}},
+		{"reducing", topic, -150, 1000, nil},
+		{"flip beyond the position", topic, -300, 1000, []Rule{ExposureLimit}},
+		{"multiplier", "nsefo/35001", 50, 100, []Rule{ExposureLimit}},
+		{"missing price", "nseeq/1594", 10, 0, []Rule{MissingPrice}},
+	}
+	for _, test := range tests {
+		var rules []Rule
+		for _, breach := range guard.Check(test.topic, test.quantity, test.price) {
+			rules = append(rules, breach.Rule)
+		}
+		if !reflect.DeepEqual(rules, test.rules) {
+			t.Errorf("%s: Check breaches %v, want %v", test.name, rules, test.rules)
+		}
+	}
+	if breaches := guard.Breaches(); len(breaches) != 1 || breaches[0].Rule != NearUpperCircuit {
+		t.Errorf("Check changed the breaches to %v", breaches)
+	}
+
+	guard.ApplyPrice(topic, 940)
+	var rules []Rule
+	for _, breach := range guard.Check(topic, 10, 940) {
+		rules = append(rules, breach.Rule)
+	}
+	if !reflect.DeepEqual(rules, []Rule{DailyLossLimit}) {
+		t.Errorf("Check after the daily loss breaches %v, want the daily loss limit", rules)
+	}
+}
+
+func TestGuardHandlers(t *testing.T) {
+	var reported []Breach
+	guard := NewGuard(GuardConfig{
+		Limits:   Limits{CircuitProximityPercent: 1},
+		OnBreach: func(breach Breach) { reported = append(reported, breach) },
+	})
+	encode := func(data interface{}) []byte {
+		payload, err := connector.EncodeFeed(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payload
+	}
+	// The circuit feeds are published on the segment topic.
+	guard.HandleUpperCircuit(encode(connector.UpperCircuitData{InstrumentId: 2885, UpperCircuit: 110000, PriceDivisor: 100}), "nseeq")
+	guard.HandleLowerCircuit(encode(connector.LowerCircuitData{InstrumentId: 2885, LowerCircuit: 90000, PriceDivisor: 100}), "nseeq")
+	guard.HandleMW(encode(&connector.MWBOCombined{Ltp: 90500, PriceDivisor: 100}), topic)
+	guard.HandleMW([]byte{1, 2, 3}, topic)
+
+	if got := events(reported); !reflect.DeepEqual(got, []event{{NearLowerCircuit, topic, true}}) {
+		t.Errorf("reported %v, want near the lower circuit of %s", got, topic)
+	}
+}
@@ -0,0 +1,346 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// searchDays bounds the search for the next session, which spans long holiday runs.
+const searchDays = 400
+
+// Hours are the session timings of a segment on a trading day, as offsets from midnight.
+// PreOpen and PostClose are zero when the segment has no such phase.
+type Hours struct {
+	PreOpen   time.Duration
+	Open      time.Duration
+	Close     time.Duration
+	PostClose time.Duration
+}
+
+// start returns the beginning of the pre-open, or of the open when there is none.
+func (h Hours) start() time.Duration {
+	if h.PreOpen != 0 {
+		return h.PreOpen
+	}
+	return h.Open
+}
+
+// end returns the end of the post-close, or the close when there is none.
+func (h Hours) end() time.Duration {
+	if h.PostClose != 0 {
+		return h.PostClose
+	}
+	return h.Close
+}
+
+// Calendar holds the trading days and session timings of the segments. It is loaded
+// from a JSON file such as:
+//
+//	{
+//	    "timeZone": "Asia/Kolkata",
+//	    "sessions": {
+//	        "nseeq": {"preOpen": "09:00", "open": "09:15", "close": "15:30", "postClose": "16:00"},
+//	        "nsefo": {"open": "09:15", "close": "15:30"},
+//	        "mcxcomm": {"open": "09:00", "close": "23:30"}
+//	    },
+//	    "holidays": {
+//	        "*": ["2024-10-02", "2024-11-15"],
+//	        "mcxcomm": ["2024-12-25"]
+//	    },
+//	    "specialSessions": {
+//	        "2024-11-01": {"nseeq": {"preOpen": "17:45", "open": "18:00", "close": "19:00"}}
+//	    },
+//	    "statusCodes": {
+//	        "*": {"6": "halted"},
+//	        "mcxcomm": {"1": "unknown"}
+//	    }
+//	}
+//
+// Saturdays and Sundays are closed unless they have a special session. Holidays under
+// "*" apply to every segment. The status codes are merged into DefaultStatusCodes,
+// where the codes under "*" apply to the segments without their own. The time zone
+// defaults to IST.
+type Calendar struct {
+	// Location is the time zone of the session timings.
+	Location *time.Location
+	// StatusCodes holds DefaultStatusCodes with the "statusCodes" of the file merged in,
+	// for NewTracker.
+	StatusCodes StatusCodes
+
+	sessions map[string]Hours
+	holidays map[string]map[string]bool
+	special  map[string]map[string]Hours
+}
+
+type calendarFile struct {
+	TimeZone        string                          `json:"timeZone"`
+	Sessions        map[string]hoursFile            `json:"sessions"`
+	Holidays        map[string][]string             `json:"holidays"`
+	SpecialSessions map[string]map[string]hoursFile `json:"specialSessions"`
+	StatusCodes     map[string]map[string]Status    `json:"statusCodes"`
+}
+
+type hoursFile struct {
+	PreOpen   string `json:"preOpen"`
+	Open      string `json:"open"`
+	Close     string `json:"close"`
+	PostClose string `json:"postClose"`
+}
+
+// LoadCalendar reads a calendar file.
+func LoadCalendar(path string) (*Calendar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := ParseCalendar(data)
+	if err != nil {
+		return nil, fmt.Errorf("calendar %s: %w", path, err)
+	}
+	return calendar, nil
+}
+
+// ParseCalendar parses the JSON content of a calendar file.
+func ParseCalendar(data []byte) (*Calendar, error) {
+	var file calendarFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	calendar := &Calendar{
+		Location:    connector.IST,
+		StatusCodes: DefaultStatusCodes(),
+		sessions:    map[string]Hours{},
+		holidays:    map[string]map[string]bool{},
+		special:     map[string]map[string]Hours{},
+	}
+	if file.TimeZone != "" {
+		location, err := time.LoadLocation(file.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		calendar.Location = location
+	}
+	for segment, timings := range file.Sessions {
+		hours, err := timings.parse()
+		if err != nil {
+			return nil, fmt.Errorf("sessions of %s: %w", segment, err)
+		}
+		calendar.sessions[strings.ToLower(segment)] = hours
+	}
+	for segment, dates := range file.Holidays {
+		days := map[string]bool{}
+		for _, date := range dates {
+			if _, err := time.Parse(time.DateOnly, date); err != nil {
+				return nil, fmt.Errorf("holidays of %s: %w", segment, err)
+			}
+			days[date] = true
+		}
+		calendar.holidays[strings.ToLower(segment)] = days
+	}
+	for date, segments := range file.SpecialSessions {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("special sessions: %w", err)
+		}
+		calendar.special[date] = map[string]Hours{}
+		for segment, timings := range segments {
+			hours, err := timings.parse()
+			if err != nil {
+				return nil, fmt.Errorf("special session of %s on %s: %w", segment, date, err)
+			}
+			calendar.special[date][strings.ToLower(segment)] = hours
+		}
+	}
+	overrides := StatusCodes{}
+	for segment, codes := range file.StatusCodes {
+		statuses := map[uint16]Status{}
+		for code, status := range codes {
+			value, err := strconv.ParseUint(code, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("status codes of %s: %w", segment, err)
+			}
+			statuses[uint16(value)] = status
+		}
+		overrides[segment] = statuses
+	}
+	calendar.StatusCodes = calendar.StatusCodes.Merge(overrides)
+	return calendar, nil
+}
+
+func (h hoursFile) parse() (Hours, error) {
+	var hours Hours
+	var err error
+	if hours.Open, err = parseClock(h.Open, true); err != nil {
+		return hours, fmt.Errorf("open: %w", err)
+	}
+	if hours.Close, err = parseClock(h.Close, true); err != nil {
+		return hours, fmt.Errorf("close: %w", err)
+	}
+	if hours.PreOpen, err = parseClock(h.PreOpen, false); err != nil {
+		return hours, fmt.Errorf("preOpen: %w", err)
+	}
+	if hours.PostClose, err = parseClock(h.PostClose, false); err != nil {
+		return hours, fmt.Errorf("postClose: %w", err)
+	}
+	if hours.Close <= hours.Open ||
+		(hours.PreOpen != 0 && hours.PreOpen >= hours.Open) ||
+		(hours.PostClose != 0 && hours.PostClose <= hours.Close) {
+		return hours, fmt.Errorf("timings should be in order within a day")
+	}
+	return hours, nil
+}
+
+func parseClock(value string, required bool) (time.Duration, error) {
+	if value == "" {
+		if required {
+			return 0, fmt.Errorf("missing")
+		}
+		return 0, nil
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// Hours returns the session timings of the segment, e.g. "nsefo", on the day of t. It
+// is false on holidays, weekends and for segments without sessions.
+func (c *Calendar) Hours(segment string, t time.Time) (Hours, bool) {
+	segment = strings.ToLower(segment)
+	date := t.In(c.Location).Format(time.DateOnly)
+	if hours, ok := c.special[date][segment]; ok {
+		return hours, true
+	}
+	hours, ok := c.sessions[segment]
+	if !ok || c.holidays["*"][date] || c.holidays[segment][date] {
+		return Hours{}, false
+	}
+	if weekday := t.In(c.Location).Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return Hours{}, false
+	}
+	return hours, true
+}
+
+// IsTradingDay reports whether the segment has a session on the day of t.
+func (c *Calendar) IsTradingDay(segment string, t time.Time) bool {
+	_, ok := c.Hours(segment, t)
+	return ok
+}
+
+// StatusAt returns the scheduled status of the segment at t. It does not know about
+// halts; use a Tracker for the status published by the exchange.
+func (c *Calendar) StatusAt(segment string, t time.Time) Status {
+	hours, ok := c.Hours(segment, t)
+	if !ok {
+		return Closed
+	}
+	offset := t.Sub(c.midnight(t))
+	switch {
+	case hours.PreOpen != 0 && offset >= hours.PreOpen && offset < hours.Open:
+		return PreOpen
+	case offset >= hours.Open && offset < hours.Close:
+		return Open
+	case hours.PostClose != 0 && offset >= hours.Close && offset < hours.PostClose:
+		return PostClose
+	default:
+		return Closed
+	}
+}
+
+// IsOpen reports whether the segment is scheduled to be open for normal trading at t,
+// e.g. calendar.IsOpen("nsefo", time.Now()).
+func (c *Calendar) IsOpen(segment string, t time.Time) bool {
+	return c.StatusAt(segment, t) == Open
+}
+
+// NextOpen returns the first start of normal trading of the segment after t. It is
+// false when there is none within a year.
+func (c *Calendar) NextOpen(segment string, t time.Time) (time.Time, bool) {
+	return c.next(segment, t, func(h Hours) time.Duration { return h.Open })
+}
+
+// NextClose returns the first end of normal trading of the segment after t. It is false
+// when there is none within a year.
+func (c *Calendar) NextClose(segment string, t time.Time) (time.Time, bool) {
+	return c.next(segment, t, func(h Hours) time.Duration { return h.Close })
+}
+
+// Schedule calls onStart at the beginning of each session of the segment and onEnd at
+// its end, until the context is done. A session runs from the pre-open, or the open
+// when there is none, to the end of the post-close, or the close. lead moves both
+// calls earlier, e.g. to subscribe a minute before the session. If a session is under
+// way when Schedule is called, onStart is called at once. Schedule blocks; run it in
+// its own goroutine:
+//
+//	go calendar.Schedule(ctx, "nsefo", time.Minute,
+//		func() { conn.SetSubscriptions(connector.FeedMarketWatch, topics) },
+//		func() { conn.SetSubscriptions(connector.FeedMarketWatch, nil) })
+func (c *Calendar) Schedule(ctx context.Context, segment string, lead time.Duration, onStart func(), onEnd func()) {
+	start := func(h Hours) time.Duration { return h.start() - lead }
+	end := func(h Hours) time.Duration { return h.end() - lead }
+
+	now := time.Now()
+	inSession := false
+	if hours, ok := c.Hours(segment, now); ok {
+		offset := now.Sub(c.midnight(now))
+		inSession = offset >= start(hours) && offset < end(hours)
+	}
+	if inSession && onStart != nil {
+		onStart()
+	}
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+	for {
+		next := start
+		if inSession {
+			next = end
+		}
+		at, ok := c.next(segment, time.Now(), next)
+		if !ok {
+			return
+		}
+		timer.Reset(time.Until(at))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		inSession = !inSession
+		if inSession && onStart != nil {
+			onStart()
+		} else if !inSession && onEnd != nil {
+			onEnd()
+		}
+	}
+}
+
+// next returns the first time after t at the offset chosen by at on a trading day of
+// the segment.
+func (c *Calendar) next(segment string, t time.Time, at func(Hours) time.Duration) (time.Time, bool) {
+	day := c.midnight(t)
+	for i := 0; i < searchDays; i++ {
+		if hours, ok := c.Hours(segment, day.Add(12*time.Hour)); ok {
+			if when := day.Add(at(hours)); when.After(t) {
+				return when, true
+			}
+		}
+		year, month, date := day.Date()
+		day = time.Date(year, month, date+1, 0, 0, 0, 0, c.Location)
+	}
+	return time.Time{}, false
+}
+
+func (c *Calendar) midnight(t time.Time) time.Time {
+	year, month, day := t.In(c.Location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, c.Location)
+}
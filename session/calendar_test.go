@@ -0,0 +1,234 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+const calendarJSON = `{
+    "sessions": {
+        "nseeq": {"preOpen": "09:00", "open": "09:15", "close": "15:30", "postClose": "16:00"},
+        "nsefo": {"open": "09:15", "close": "15:30"},
+        "mcxcomm": {"open": "09:00", "close": "23:30"}
+    },
+    "holidays": {
+        "*": ["2024-11-15"],
+        "nsefo": ["2024-10-21"]
+    },
+    "specialSessions": {
+        "2024-11-02": {"nseeq": {"preOpen": "17:45", "open": "18:00", "close": "19:00"}}
+    },
+    "statusCodes": {
+        "nsefo": {"6": "halted"}
+    }
+}`
+
+// at returns the time of day on the date, in IST.
+func at(date string, clock string) time.Time {
+	t, err := time.ParseInLocation(time.DateOnly+" 15:04", date+" "+clock, connector.IST)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parseCalendar(t *testing.T) *Calendar {
+	t.Helper()
+	calendar, err := ParseCalendar([]byte(calendarJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calendar
+}
+
+func TestStatusAt(t *testing.T) {
+	calendar := parseCalendar(t)
+	tests := []struct {
+		segment string
+		time    time.Time
+		want    Status
+	}{
+		// 2024-10-18 is a Friday.
+		{"nsefo", at("2024-10-18", "09:14"), Closed},
+		{"nsefo", at("2024-10-18", "09:15"), Open},
+		{"NSEFO", at("2024-10-18", "15:29"), Open},
+		{"nsefo", at("2024-10-18", "15:30"), Closed},
+		{"nsefo", at("2024-10-18", "09:30").UTC(), Open},
+		{"nseeq", at("2024-10-18", "08:59"), Closed},
+		{"nseeq", at("2024-10-18", "09:00"), PreOpen},
+		{"nseeq", at("2024-10-18", "09:15"), Open},
+		{"nseeq", at("2024-10-18", "15:30"), PostClose},
+		{"nseeq", at("2024-10-18", "16:00"), Closed},
+		{"mcxcomm", at("2024-10-18", "23:00"), Open},
+		// Weekend.
+		{"nsefo", at("2024-10-19", "10:00"), Closed},
+		// Holiday of the segment only.
+		{"nsefo", at("2024-10-21", "10:00"), Closed},
+		{"nseeq", at("2024-10-21", "10:00"), Open},
+		// Holiday of every segment.
+		{"nseeq", at("2024-11-15", "10:00"), Closed},
+		{"mcxcomm", at("2024-11-15", "10:00"), Closed},
+		// Special session on a Saturday.
+		{"nseeq", at("2024-11-02", "10:00"), Closed},
+		{"nseeq", at("2024-11-02", "17:50"), PreOpen},
+		{"nseeq", at("2024-11-02", "18:30"), Open},
+		{"nsefo", at("2024-11-02", "18:30"), Closed},
+		// Segment without sessions.
+		{"bseeq", at("2024-10-18", "10:00"), Closed},
+	}
+	for _, test := range tests {
+		if got := calendar.StatusAt(test.segment, test.time); got != test.want {
+			t.Errorf("StatusAt(%s, %v) = %v, want %v", test.segment, test.time, got, test.want)
+		}
+		if got := calendar.IsOpen(test.segment, test.time); got != (test.want == Open) {
+			t.Errorf("IsOpen(%s, %v) = %v", test.segment, test.time, got)
+		}
+	}
+}
+
+func TestHours(t *testing.T) {
+	calendar := parseCalendar(t)
+	hours, ok := calendar.Hours("nseeq", at("2024-10-18", "00:00"))
+	want := Hours{PreOpen: 9 * time.Hour, Open: 9*time.Hour + 15*time.Minute, Close: 15*time.Hour + 30*time.Minute, PostClose: 16 * time.Hour}
+	if !ok || hours != want {
+		t.Errorf("Hours = %+v, %v; want %+v", hours, ok, want)
+	}
+	if calendar.IsTradingDay("nsefo", at("2024-10-21", "12:00")) {
+		t.Error("IsTradingDay on a holiday of the segment")
+	}
+	if !calendar.IsTradingDay("nseeq", at("2024-11-02", "12:00")) {
+		t.Error("IsTradingDay is false on a special session")
+	}
+}
+
+func TestNextOpenClose(t *testing.T) {
+	calendar := parseCalendar(t)
+	tests := []struct {
+		name            string
+		segment         string
+		time            time.Time
+		nextOpen, close time.Time
+	}{
+		{"before the open", "nsefo", at("2024-10-18", "08:00"), at("2024-10-18", "09:15"), at("2024-10-18", "15:30")},
+		{"during the session", "nsefo", at("2024-10-18", "10:00"), at("2024-10-22", "09:15"), at("2024-10-18", "15:30")},
+		{"over the weekend and a holiday", "nsefo", at("2024-10-18", "16:00"), at("2024-10-22", "09:15"), at("2024-10-22", "15:30")},
+		{"at the open", "nseeq", at("2024-10-18", "09:15"), at("2024-10-21", "09:15"), at("2024-10-18", "15:30")},
+		{"special session", "nseeq", at("2024-11-01", "16:00"), at("2024-11-02", "18:00"), at("2024-11-02", "19:00")},
+		{"global holiday", "mcxcomm", at("2024-11-14", "23:45"), at("2024-11-18", "09:00"), at("2024-11-18", "23:30")},
+	}
+	for _, test := range tests {
+		if got, ok := calendar.NextOpen(test.segment, test.time); !ok || !got.Equal(test.nextOpen) {
+			t.Errorf("%s: NextOpen = %v, %v; want %v", test.name, got, ok, test.nextOpen)
+		}
+		if got, ok := calendar.NextClose(test.segment, test.time); !ok || !got.Equal(test.close) {
+			t.Errorf("%s: NextClose = %v, %v; want %v", test.name, got, ok, test.close)
+		}
+	}
+	if got, ok := calendar.NextOpen("bseeq", at("2024-10-18", "08:00")); ok {
+		t.Errorf("NextOpen of a segment without sessions = %v", got)
+	}
+}
+
+func TestCalendarStatusCodes(t *testing.T) {
+	calendar := parseCalendar(t)
+	tests := []struct {
+		segment string
+		code    uint16
+		want    Status
+	}{
+		{"nsefo", 6, Halted},
+		{"nsefo", 2, Unknown},
+		{"nseeq", 2, Open},
+		{"nseeq", 6, Unknown},
+		{"mcxcomm", 2, Open},
+	}
+	for _, test := range tests {
+		if got := calendar.StatusCodes.Decode(test.segment, test.code); got != test.want {
+			t.Errorf("Decode(%s, %d) = %v, want %v", test.segment, test.code, got, test.want)
+		}
+	}
+
+	calendar, err := ParseCalendar([]byte(`{"sessions": {"nsefo": {"open": "09:15", "close": "15:30"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := calendar.StatusCodes.Decode("nsefo", 2); got != Open {
+		t.Errorf("a calendar without status codes decodes 2 to %v, want the default", got)
+	}
+}
+
+func TestParseCalendarErrors(t *testing.T) {
+	tests := map[string]string{
+		"json":           `{`,
+		"time zone":      `{"timeZone": "Mars/Olympus"}`,
+		"missing open":   `{"sessions": {"nsefo": {"close": "15:30"}}}`,
+		"clock":          `{"sessions": {"nsefo": {"open": "9h15", "close": "15:30"}}}`,
+		"order":          `{"sessions": {"nsefo": {"open": "15:30", "close": "09:15"}}}`,
+		"pre-open order": `{"sessions": {"nseeq": {"preOpen": "09:20", "open": "09:15", "close": "15:30"}}}`,
+		"holiday":        `{"holidays": {"*": ["15-11-2024"]}}`,
+		"special date":   `{"specialSessions": {"2024-13-01": {}}}`,
+		"special hours":  `{"specialSessions": {"2024-11-01": {"nseeq": {"open": "18:00"}}}}`,
+		"status code":    `{"statusCodes": {"*": {"one": "open"}}}`,
+		"status":         `{"statusCodes": {"*": {"1": "trading"}}}`,
+	}
+	for name, data := range tests {
+		if _, err := ParseCalendar([]byte(data)); err == nil {
+			t.Errorf("%s: ParseCalendar succeeded", name)
+		}
+	}
+}
+
+func TestLoadCalendar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.json")
+	if err := os.WriteFile(path, []byte(`{"timeZone": "UTC", "sessions": {"nsefo": {"open": "03:45", "close": "10:00"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	calendar, err := LoadCalendar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !calendar.IsOpen("nsefo", at("2024-10-18", "09:15")) {
+		t.Error("session timings are not read in the time zone of the file")
+	}
+	if _, err := LoadCalendar(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadCalendar of a missing file succeeded")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Now().In(connector.IST)
+	if now.Hour() == 23 && now.Minute() >= 55 {
+		t.Skip("the session of the test would cross midnight")
+	}
+	// A session under way that ends at least four minutes from now.
+	open := now.Truncate(time.Minute)
+	calendar, err := ParseCalendar([]byte(`{"specialSessions": {"` + now.Format(time.DateOnly) + `": {"nsefo": {"open": "` +
+		open.Format("15:04") + `", "close": "` + open.Add(4*time.Minute).Format("15:04") + `"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		calendar.Schedule(ctx, "nsefo", 0, func() { started <- struct{}{} }, func() { t.Error("onEnd called before the close") })
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onStart not called for the session under way")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Schedule did not return when the context was cancelled")
+	}
+}
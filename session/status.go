@@ -0,0 +1,214 @@
+// Package session interprets the Market Status feed and keeps a local calendar of the
+// exchange sessions.
+package session
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Status is the trading status of an exchange segment.
+type Status int
+
+const (
+	Unknown Status = iota
+	PreOpen
+	Open
+	Closed
+	PostClose
+	Halted
+)
+
+var statusNames = map[Status]string{
+	Unknown:   "unknown",
+	PreOpen:   "pre-open",
+	Open:      "open",
+	Closed:    "closed",
+	PostClose: "post-close",
+	Halted:    "halted",
+}
+
+// String returns the name of the status, e.g. "pre-open".
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// UnmarshalText parses the name of a status, e.g. "pre-open".
+func (s *Status) UnmarshalText(text []byte) error {
+	for status, name := range statusNames {
+		if strings.EqualFold(name, string(text)) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+// MarshalText returns the name of the status.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// StatusCodes maps the MarketStatusCode values of each segment, e.g. "nsefo", to
+// statuses. The codes under "*" apply to every segment without its own entry.
+type StatusCodes map[string]map[uint16]Status
+
+// DefaultStatusCodes returns the built-in mapping: 1 pre-open, 2 open, 3 closed,
+// 4 post-close and 5 halted, without the pre-open and post-close phases on the
+// commodity segments. The codes are not documented by the bridge, so the mapping is
+// provisional; override the codes that differ with Merge, e.g. from the "statusCodes"
+// of a calendar file.
+func DefaultStatusCodes() StatusCodes {
+	return StatusCodes{
+		"*":         {1: PreOpen, 2: Open, 3: Closed, 4: PostClose, 5: Halted},
+		"mcxcomm":   {2: Open, 3: Closed, 5: Halted},
+		"ncdexcomm": {2: Open, 3: Closed, 5: Halted},
+	}
+}
+
+// Merge returns a copy of the codes with the codes of overrides added, replacing those
+// of the same segment and value. Map a code to Unknown to remove it.
+func (c StatusCodes) Merge(overrides StatusCodes) StatusCodes {
+	merged := make(StatusCodes, len(c)+len(overrides))
+	for _, codes := range []StatusCodes{c, overrides} {
+		for segment, statuses := range codes {
+			segment = strings.ToLower(segment)
+			if merged[segment] == nil {
+				merged[segment] = map[uint16]Status{}
+			}
+			for code, status := range statuses {
+				merged[segment][code] = status
+			}
+		}
+	}
+	return merged
+}
+
+// Decode returns the status of a MarketStatusCode on the segment, or Unknown when the
+// code is not mapped.
+func (c StatusCodes) Decode(segment string, code uint16) Status {
+	codes, ok := c[strings.ToLower(segment)]
+	if !ok {
+		codes = c["*"]
+	}
+	if status, ok := codes[code]; ok {
+		return status
+	}
+	return Unknown
+}
+
+// transitions lists the expected successors of each status.
+var transitions = map[Status][]Status{
+	PreOpen:   {Open, Halted, Closed},
+	Open:      {Halted, Closed, PostClose},
+	Halted:    {Open, PreOpen, Closed},
+	PostClose: {Closed},
+	Closed:    {PreOpen, Open},
+}
+
+// Transition is a change of the status of a segment.
+type Transition struct {
+	Segment string
+	From    Status
+	To      Status
+	// Code is the MarketStatusCode that caused the transition.
+	Code uint16
+	// Time is the time the status was received.
+	Time time.Time
+	// Unexpected is set when the exchange does not normally move from From to To,
+	// e.g. from PostClose to Open, which suggests missed status messages.
+	Unexpected bool
+}
+
+// Tracker keeps the status of each segment from the Market Status feed and reports its
+// transitions.
+//
+//	codes := session.DefaultStatusCodes().Merge(session.StatusCodes{
+//		"nsefo": {6: session.Halted},
+//	})
+//	tracker := session.NewTracker(codes, func(transition session.Transition) {
+//		fmt.Println(transition.Segment, transition.From, "->", transition.To)
+//	})
+//	conn.MarketStatusHandler = tracker.Handle
+type Tracker struct {
+	codes        StatusCodes
+	onTransition func(Transition)
+
+	mu       sync.Mutex
+	statuses map[string]Status
+}
+
+// NewTracker returns a tracker that decodes the status codes with codes, or with
+// DefaultStatusCodes when nil, and calls onTransition, if not nil, with each
+// transition. Codes that are not mapped decode to Unknown.
+func NewTracker(codes StatusCodes, onTransition func(Transition)) *Tracker {
+	if codes == nil {
+		codes = DefaultStatusCodes()
+	}
+	return &Tracker{codes: codes, onTransition: onTransition, statuses: map[string]Status{}}
+}
+
+// Handle decodes a Market Status payload of the segment topic, e.g. "nsefo". It has the
+// signature of the Connect handler fields, so that it can be set as MarketStatusHandler.
+func (t *Tracker) Handle(payload []byte, topic string) {
+	data, err := connector.DecodeMarketStatus(payload)
+	if err != nil {
+		return
+	}
+	t.Update(topic, data.MarketStatusCode)
+}
+
+// Update sets the status of the segment from a MarketStatusCode and returns the
+// transition, if the status changed.
+func (t *Tracker) Update(segment string, code uint16) (Transition, bool) {
+	segment = strings.ToLower(segment)
+	status := t.codes.Decode(segment, code)
+
+	t.mu.Lock()
+	previous := t.statuses[segment]
+	if previous == status {
+		t.mu.Unlock()
+		return Transition{}, false
+	}
+	t.statuses[segment] = status
+	t.mu.Unlock()
+
+	transition := Transition{Segment: segment, From: previous, To: status, Code: code, Time: time.Now()}
+	if previous != Unknown && status != Unknown {
+		transition.Unexpected = true
+		for _, next := range transitions[previous] {
+			if next == status {
+				transition.Unexpected = false
+			}
+		}
+	}
+	if t.onTransition != nil {
+		t.onTransition(transition)
+	}
+	return transition, true
+}
+
+// Status returns the last status of the segment, or Unknown.
+func (t *Tracker) Status(segment string) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.statuses[strings.ToLower(segment)]
+}
+
+// Statuses returns the last status of every segment seen.
+func (t *Tracker) Statuses() map[string]Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	statuses := make(map[string]Status, len(t.statuses))
+	for segment, status := range t.statuses {
+		statuses[segment] = status
+	}
+	return statuses
+}
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestStatusText(t *testing.T) {
+	for status := range statusNames {
+		text, err := status.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed Status
+		if err := parsed.UnmarshalText(text); err != nil || parsed != status {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v", text, parsed, err, status)
+		}
+	}
+	var status Status
+	if err := status.UnmarshalText([]byte("Pre-Open")); err != nil || status != PreOpen {
+		t.Errorf("UnmarshalText(Pre-Open) = %v, %v", status, err)
+	}
+	if err := status.UnmarshalText([]byte("suspended")); err == nil {
+		t.Error("UnmarshalText(suspended) succeeded")
+	}
+	if got := Status(42).String(); got != "Status(42)" {
+		t.Errorf("Status(42).String() = %q", got)
+	}
+}
+
+func TestDefaultStatusCodes(t *testing.T) {
+	codes := DefaultStatusCodes()
+	tests := []struct {
+		segment string
+		code    uint16
+		want    Status
+	}{
+		{"nseeq", 1, PreOpen},
+		{"nsefo", 2, Open},
+		{"NSEFO", 3, Closed},
+		{"bseeq", 4, PostClose},
+		{"nsecurr", 5, Halted},
+		{"nsefo", 0, Unknown},
+		{"nsefo", 9, Unknown},
+		{"mcxcomm", 1, Unknown},
+		{"mcxcomm", 2, Open},
+		{"ncdexcomm", 4, Unknown},
+	}
+	for _, test := range tests {
+		if got := codes.Decode(test.segment, test.code); got != test.want {
+			t.Errorf("Decode(%s, %d) = %v, want %v", test.segment, test.code, got, test.want)
+		}
+	}
+
+	codes["*"][2] = Halted
+	if got := DefaultStatusCodes().Decode("nsefo", 2); got != Open {
+		t.Errorf("DefaultStatusCodes shares its maps: code 2 is %v", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defaults := DefaultStatusCodes()
+	merged := defaults.Merge(StatusCodes{
+		"*":     {6: Halted},
+		"NSEFO": {2: PreOpen, 3: Open},
+		"bseeq": {5: Unknown},
+	})
+
+	want := StatusCodes{
+		"*":         {1: PreOpen, 2: Open, 3: Closed, 4: PostClose, 5: Halted, 6: Halted},
+		"mcxcomm":   {2: Open, 3: Closed, 5: Halted},
+		"ncdexcomm": {2: Open, 3: Closed, 5: Halted},
+		"nsefo":     {2: PreOpen, 3: Open},
+		"bseeq":     {5: Unknown},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merge = %v, want %v", merged, want)
+	}
+	if !reflect.DeepEqual(defaults, DefaultStatusCodes()) {
+		t.Errorf("Merge modified its receiver: %v", defaults)
+	}
+	if got := merged.Decode("nsefo", 1); got != Unknown {
+		t.Errorf("a segment entry does not fall back to *: code 1 is %v", got)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tests := []struct {
+		segment    string
+		code       uint16
+		changed    bool
+		from, to   Status
+		unexpected bool
+	}{
+		{segment: "nsefo", code: 1, changed: true, from: Unknown, to: PreOpen},
+		{segment: "nsefo", code: 1},
+		{segment: "NSEFO", code: 2, changed: true, from: PreOpen, to: Open},
+		{segment: "nsefo", code: 5, changed: true, from: Open, to: Halted},
+		{segment: "nsefo", code: 2, changed: true, from: Halted, to: Open},
+		{segment: "nsefo", code: 4, changed: true, from: Open, to: PostClose},
+		{segment: "nsefo", code: 2, changed: true, from: PostClose, to: Open, unexpected: true},
+		{segment: "nsefo", code: 9, changed: true, from: Open, to: Unknown},
+		{segment: "nsefo", code: 3, changed: true, from: Unknown, to: Closed},
+		{segment: "nsefo", code: 2, changed: true, from: Closed, to: Open},
+		{segment: "nseeq", code: 3, changed: true, from: Unknown, to: Closed},
+		{segment: "nseeq", code: 4, changed: true, from: Closed, to: PostClose, unexpected: true},
+	}
+
+	var reported []Transition
+	tracker := NewTracker(nil, func(transition Transition) { reported = append(reported, transition) })
+	changes := 0
+	for i, test := range tests {
+		transition, changed := tracker.Update(test.segment, test.code)
+		if changed != test.changed {
+			t.Fatalf("update %d: changed %v, want %v", i, changed, test.changed)
+		}
+		if !changed {
+			continue
+		}
+		changes++
+		if transition.Segment != "nsefo" && transition.Segment != "nseeq" {
+			t.Errorf("update %d: segment %q is not lower case", i, transition.Segment)
+		}
+		if transition.From != test.from || transition.To != test.to || transition.Unexpected != test.unexpected || transition.Code != test.code {
+			t.Errorf("update %d: transition %+v, want %v -> %v unexpected %v", i, transition, test.from, test.to, test.unexpected)
+		}
+		if transition.Time.IsZero() {
+			t.Errorf("update %d: transition without a time", i)
+		}
+	}
+	if len(reported) != changes {
+		t.Errorf("onTransition called %d times, want %d", len(reported), changes)
+	}
+	if got := tracker.Status("NSEFO"); got != Open {
+		t.Errorf("Status(NSEFO) = %v, want open", got)
+	}
+	if got := tracker.Statuses(); !reflect.DeepEqual(got, map[string]Status{"nsefo": Open, "nseeq": PostClose}) {
+		t.Errorf("Statuses = %v", got)
+	}
+}
+
+func TestTrackerHandle(t *testing.T) {
+	tracker := NewTracker(StatusCodes{"mcxcomm": {7: Open}}, nil)
+	payload, err := connector.EncodeFeed(&connector.MarketStatusData{MarketStatusCode: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Handle(payload, "mcxcomm")
+	tracker.Handle(payload[:1], "nsefo")
+	tracker.Handle(payload, "nsefo")
+
+	if got := tracker.Statuses(); !reflect.DeepEqual(got, map[string]Status{"mcxcomm": Open}) {
+		t.Errorf("Statuses = %v, want mcxcomm open and nsefo unmapped", got)
+	}
+}
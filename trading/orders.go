@@ -0,0 +1,419 @@
+package trading
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// OrderState is the state of an order in its lifecycle.
+type OrderState int
+
+const (
+	// OrderUnknown is the state of an order before its first valid update.
+	OrderUnknown OrderState = iota
+	OrderOpen
+	OrderModified
+	OrderPartiallyFilled
+	OrderFilled
+	OrderCancelled
+	OrderRejected
+)
+
+var orderStateNames = map[OrderState]string{
+	OrderUnknown:         "unknown",
+	OrderOpen:            "open",
+	OrderModified:        "modified",
+	OrderPartiallyFilled: "partially filled",
+	OrderFilled:          "filled",
+	OrderCancelled:       "cancelled",
+	OrderRejected:        "rejected",
+}
+
+// String returns the name of the state, e.g. "partially filled".
+func (s OrderState) String() string {
+	if name, ok := orderStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("OrderState(%d)", int(s))
+}
+
+// IsTerminal reports whether no further update is expected in the state.
+func (s OrderState) IsTerminal() bool {
+	return s == OrderFilled || s == OrderCancelled || s == OrderRejected
+}
+
+// orderStatuses maps the OrderStatus values of the order updates, without spaces,
+// hyphens and underscores, to states.
+var orderStatuses = map[string]OrderState{
+	"OPEN":            OrderOpen,
+	"PENDING":         OrderOpen,
+	"NEW":             OrderOpen,
+	"TRIGGERPENDING":  OrderOpen,
+	"MODIFIED":        OrderModified,
+	"REPLACED":        OrderModified,
+	"PARTIALLYFILLED": OrderPartiallyFilled,
+	"PARTFILLED":      OrderPartiallyFilled,
+	"FILLED":          OrderFilled,
+	"COMPLETE":        OrderFilled,
+	"COMPLETED":       OrderFilled,
+	"TRADED":          OrderFilled,
+	"FULLYEXECUTED":   OrderFilled,
+	"CANCELLED":       OrderCancelled,
+	"CANCELED":        OrderCancelled,
+	"EXPIRED":         OrderCancelled,
+	"REJECTED":        OrderRejected,
+}
+
+// ParseOrderState returns the state of an OrderStatus, e.g. "PARTIALLY FILLED". It is
+// false for unknown statuses.
+func ParseOrderState(status string) (OrderState, bool) {
+	normalised := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToUpper(status))
+	state, ok := orderStatuses[normalised]
+	return state, ok
+}
+
+// orderTransitions lists the valid successors of each state.
+var orderTransitions = map[OrderState][]OrderState{
+	OrderOpen:            {OrderOpen, OrderModified, OrderPartiallyFilled, OrderFilled, OrderCancelled, OrderRejected},
+	OrderModified:        {OrderOpen, OrderModified, OrderPartiallyFilled, OrderFilled, OrderCancelled, OrderRejected},
+	OrderPartiallyFilled: {OrderModified, OrderPartiallyFilled, OrderFilled, OrderCancelled},
+}
+
+// Outcome is the result of applying an order update.
+type Outcome int
+
+const (
+	// Applied updates changed the order.
+	Applied Outcome = iota
+	// Duplicate updates repeat the last update of the order.
+	Duplicate
+	// Stale updates are older than the state of the order, e.g. an open status received
+	// after a fill, and are ignored.
+	Stale
+	// Invalid updates have an unknown status or a transition the state machine does
+	// not allow, e.g. from partially filled to rejected, and are ignored. A rejection
+	// of an order with fills is the rejection of a modification, and is invalid too.
+	Invalid
+)
+
+var outcomeNames = map[Outcome]string{
+	Applied:   "applied",
+	Duplicate: "duplicate",
+	Stale:     "stale",
+	Invalid:   "invalid",
+}
+
+// String returns the name of the outcome, e.g. "stale".
+func (o Outcome) String() string {
+	if name, ok := outcomeNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// Order is the tracked state of an order.
+type Order struct {
+	BrokerOrderId   string
+	ExchangeOrderId string
+	// Topic is the market feed topic of the instrument, e.g. "nseeq/2885".
+	Topic           string
+	TradingSymbol   string
+	TransactionType string
+	Product         string
+	OrderType       string
+	State           OrderState
+	Quantity        int64
+	FilledQuantity  int64
+	PendingQuantity int64
+	Price           float64
+	TriggerPrice    float64
+	AveragePrice    float64
+	RejectionReason string
+	// Updated is the ExchangeTime of the last applied update.
+	Updated time.Time
+	// Updates is the number of applied updates.
+	Updates int
+}
+
+// OrderEvent reports the outcome of an order update.
+type OrderEvent struct {
+	// Order is the order after the update.
+	Order    Order
+	Previous OrderState
+	Update   connector.OrderUpdate
+	Outcome  Outcome
+}
+
+// OrderConfig configures an OrderTracker.
+type OrderConfig struct {
+	// OnEvent is called with the outcome of every order update.
+	OnEvent func(OrderEvent)
+}
+
+// OrderTracker keeps the orders of the account from the Order Updates feed. Each update
+// goes through a state machine: updates older than the order, judged by the filled
+// quantity and the exchange time, are stale, repeated updates are duplicates, and
+// transitions out of a terminal state or otherwise not allowed are invalid. None of
+// them change the order.
+//
+//	tracker := trading.NewOrderTracker(trading.OrderConfig{
+//		OnEvent: func(event trading.OrderEvent) {
+//			fmt.Println(event.Order.BrokerOrderId, event.Previous, "->", event.Order.State, event.Outcome)
+//		},
+//	})
+//	conn.OrderUpdatesHandler = tracker.HandleOrder
+//
+//	order, err := tracker.Wait(ctx, brokerOrderId)
+type OrderTracker struct {
+	config OrderConfig
+
+	mu     sync.Mutex
+	orders map[string]*trackedOrder
+	// byExchangeId indexes the orders by exchange order id once known.
+	byExchangeId map[string]*trackedOrder
+	waiters      map[string][]chan Order
+}
+
+type trackedOrder struct {
+	Order
+	last connector.OrderUpdate
+}
+
+// NewOrderTracker returns an empty order tracker.
+func NewOrderTracker(config OrderConfig) *OrderTracker {
+	return &OrderTracker{
+		config:       config,
+		orders:       map[string]*trackedOrder{},
+		byExchangeId: map[string]*trackedOrder{},
+		waiters:      map[string][]chan Order{},
+	}
+}
+
+// HandleOrder decodes an Order Updates payload and applies it. It has the signature of
+// the Connect handler fields, so that it can be set as OrderUpdatesHandler.
+func (t *OrderTracker) HandleOrder(payload []byte, topic string) {
+	update, err := connector.DecodeOrderUpdate(payload)
+	if err != nil {
+		return
+	}
+	t.Apply(update)
+}
+
+// Apply applies an order update and returns the order and the outcome. Orders are keyed
+// by broker order id, or by exchange order id for updates without one.
+func (t *OrderTracker) Apply(update connector.OrderUpdate) (Order, Outcome) {
+	state, known := ParseOrderState(update.OrderStatus)
+	if state == OrderOpen && update.FilledQuantity > 0 {
+		state = OrderPartiallyFilled
+	}
+
+	if !known || (update.BrokerOrderId == "" && update.ExchangeOrderId == "") {
+		t.mu.Lock()
+		order := t.lookup(update.BrokerOrderId, update.ExchangeOrderId)
+		snapshot := Order{BrokerOrderId: update.BrokerOrderId, ExchangeOrderId: update.ExchangeOrderId}
+		if order != nil {
+			snapshot = order.Order
+		}
+		t.mu.Unlock()
+		if t.config.OnEvent != nil {
+			t.config.OnEvent(OrderEvent{Order: snapshot, Previous: snapshot.State, Update: update, Outcome: Invalid})
+		}
+		return snapshot, Invalid
+	}
+
+	t.mu.Lock()
+	order := t.lookup(update.BrokerOrderId, update.ExchangeOrderId)
+	if order == nil {
+		order = &trackedOrder{Order: Order{BrokerOrderId: update.BrokerOrderId}}
+		if order.BrokerOrderId == "" {
+			order.BrokerOrderId = update.ExchangeOrderId
+		}
+		t.orders[order.BrokerOrderId] = order
+	}
+	previous := order.State
+
+	var outcome Outcome
+	switch {
+	case order.Updates != 0 && sameUpdate(order.last, update):
+		outcome = Duplicate
+	case order.Updates != 0 && isStale(&order.Order, state, update):
+		outcome = Stale
+	case order.Updates != 0 && !allowed(previous, state):
+		outcome = Invalid
+	case state == OrderRejected && update.FilledQuantity > 0:
+		// A rejected modification; the filled part of the order stands.
+		outcome = Invalid
+	default:
+		outcome = Applied
+		if update.BrokerOrderId != "" && update.BrokerOrderId != order.BrokerOrderId {
+			// The order was first seen by its exchange order id.
+			delete(t.orders, order.BrokerOrderId)
+			order.BrokerOrderId = update.BrokerOrderId
+			t.orders[order.BrokerOrderId] = order
+		}
+		order.apply(state, update)
+		if order.ExchangeOrderId != "" {
+			t.byExchangeId[order.ExchangeOrderId] = order
+		}
+	}
+	snapshot := order.Order
+
+	var waiters []chan Order
+	if outcome == Applied && state.IsTerminal() {
+		for _, id := range []string{order.BrokerOrderId, order.ExchangeOrderId} {
+			waiters = append(waiters, t.waiters[id]...)
+			delete(t.waiters, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, waiter := range waiters {
+		waiter <- snapshot
+	}
+	if t.config.OnEvent != nil {
+		t.config.OnEvent(OrderEvent{Order: snapshot, Previous: previous, Update: update, Outcome: outcome})
+	}
+	return snapshot, outcome
+}
+
+func (o *trackedOrder) apply(state OrderState, update connector.OrderUpdate) {
+	o.last = update
+	o.Updates++
+	o.State = state
+	if update.ExchangeOrderId != "" {
+		o.ExchangeOrderId = update.ExchangeOrderId
+	}
+	o.Topic = update.Topic()
+	o.TradingSymbol = update.TradingSymbol
+	o.TransactionType = update.TransactionType
+	o.Product = update.Product
+	o.OrderType = update.OrderType
+	o.Quantity = update.OrderQuantity
+	o.FilledQuantity = update.FilledQuantity
+	o.PendingQuantity = update.PendingQuantity
+	o.Price = update.OrderPrice
+	o.TriggerPrice = update.TriggerPrice
+	o.AveragePrice = update.AverageTradedPrice
+	o.RejectionReason = update.RejectionReason
+	if !update.ExchangeTime.IsZero() {
+		o.Updated = update.ExchangeTime
+	}
+}
+
+// isStale reports whether an update in state is older than the order.
+func isStale(order *Order, state OrderState, update connector.OrderUpdate) bool {
+	switch {
+	case update.FilledQuantity < order.FilledQuantity:
+		return true
+	case update.FilledQuantity > order.FilledQuantity:
+		return false
+	case order.State.IsTerminal():
+		// Without a new fill, nothing follows a terminal state.
+		return !state.IsTerminal()
+	default:
+		return !update.ExchangeTime.IsZero() && update.ExchangeTime.Before(order.Updated)
+	}
+}
+
+func allowed(from OrderState, to OrderState) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func sameUpdate(a connector.OrderUpdate, b connector.OrderUpdate) bool {
+	return a.OrderStatus == b.OrderStatus &&
+		a.ExchangeOrderId == b.ExchangeOrderId &&
+		a.OrderQuantity == b.OrderQuantity &&
+		a.FilledQuantity == b.FilledQuantity &&
+		a.PendingQuantity == b.PendingQuantity &&
+		a.OrderPrice == b.OrderPrice &&
+		a.TriggerPrice == b.TriggerPrice &&
+		a.ExchangeTime.Equal(b.ExchangeTime)
+}
+
+func (t *OrderTracker) lookup(brokerOrderId string, exchangeOrderId string) *trackedOrder {
+	if order, ok := t.orders[brokerOrderId]; ok && brokerOrderId != "" {
+		return order
+	}
+	if order, ok := t.byExchangeId[exchangeOrderId]; ok && exchangeOrderId != "" {
+		return order
+	}
+	return nil
+}
+
+// Order returns the order with the broker or exchange order id.
+func (t *OrderTracker) Order(id string) (Order, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	order := t.lookup(id, id)
+	if order == nil {
+		return Order{}, false
+	}
+	return order.Order, true
+}
+
+// Live returns the orders not in a terminal state, by broker order id.
+func (t *OrderTracker) Live() []Order {
+	return t.list(func(order *Order) bool { return !order.State.IsTerminal() })
+}
+
+// Orders returns every order seen, by broker order id.
+func (t *OrderTracker) Orders() []Order {
+	return t.list(func(*Order) bool { return true })
+}
+
+func (t *OrderTracker) list(keep func(*Order) bool) []Order {
+	t.mu.Lock()
+	var orders []Order
+	for _, order := range t.orders {
+		if keep(&order.Order) {
+			orders = append(orders, order.Order)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(orders, func(i, j int) bool { return orders[i].BrokerOrderId < orders[j].BrokerOrderId })
+	return orders
+}
+
+// Wait blocks until the order with the broker or exchange order id reaches a terminal
+// state, and returns it. The order need not have been seen yet. It returns the error of
+// the context when the context is done first.
+func (t *OrderTracker) Wait(ctx context.Context, id string) (Order, error) {
+	t.mu.Lock()
+	if order := t.lookup(id, id); order != nil && order.State.IsTerminal() {
+		t.mu.Unlock()
+		return order.Order, nil
+	}
+	waiter := make(chan Order, 1)
+	t.waiters[id] = append(t.waiters[id], waiter)
+	t.mu.Unlock()
+
+	select {
+	case order := <-waiter:
+		return order, nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		waiters := t.waiters[id]
+		for n, candidate := range waiters {
+			if candidate == waiter {
+				t.waiters[id] = append(waiters[:n:n], waiters[n+1:]...)
+				break
+			}
+		}
+		if len(t.waiters[id]) == 0 {
+			delete(t.waiters, id)
+		}
+		t.mu.Unlock()
+		return Order{}, ctx.Err()
+	}
+}
@@ -0,0 +1,153 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestParseOrderState(t *testing.T) {
+	tests := []struct {
+		status string
+		state  OrderState
+		known  bool
+	}{
+		{"OPEN", OrderOpen, true},
+		{"trigger pending", OrderOpen, true},
+		{"PARTIALLY FILLED", OrderPartiallyFilled, true},
+		{"Partially_Filled", OrderPartiallyFilled, true},
+		{"COMPLETE", OrderFilled, true},
+		{"CANCELED", OrderCancelled, true},
+		{"REJECTED", OrderRejected, true},
+		{"PARKED", OrderUnknown, false},
+	}
+	for _, test := range tests {
+		state, known := ParseOrderState(test.status)
+		if state != test.state || known != test.known {
+			t.Errorf("ParseOrderState(%q) = %v, %v; want %v, %v", test.status, state, known, test.state, test.known)
+		}
+	}
+}
+
+type orderStep struct {
+	status  string
+	filled  int64
+	at      int
+	outcome Outcome
+}
+
+func TestOrderStateMachine(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []orderStep
+		state OrderState
+	}{
+		{"filled in parts", []orderStep{
+			{"OPEN", 0, 1, Applied},
+			{"PARTIALLY FILLED", 40, 2, Applied},
+			{"FILLED", 100, 3, Applied},
+		}, OrderFilled},
+		{"repeated update", []orderStep{
+			{"OPEN", 0, 1, Applied},
+			{"OPEN", 0, 1, Duplicate},
+		}, OrderOpen},
+		{"open after a fill", []orderStep{
+			{"OPEN", 0, 1, Applied},
+			{"FILLED", 100, 3, Applied},
+			{"OPEN", 0, 2, Stale},
+		}, OrderFilled},
+		{"older exchange time", []orderStep{
+			{"MODIFIED", 0, 5, Applied},
+			{"OPEN", 0, 4, Stale},
+		}, OrderModified},
+		{"open with fills", []orderStep{
+			{"OPEN", 20, 1, Applied},
+		}, OrderPartiallyFilled},
+		{"modification rejected after fills", []orderStep{
+			{"PARTIALLY FILLED", 40, 1, Applied},
+			{"REJECTED", 40, 2, Invalid},
+		}, OrderPartiallyFilled},
+		{"modified after cancel", []orderStep{
+			{"OPEN", 0, 1, Applied},
+			{"CANCELLED", 0, 2, Applied},
+			{"MODIFIED", 0, 3, Stale},
+		}, OrderCancelled},
+		{"filled after cancel", []orderStep{
+			{"CANCELLED", 0, 1, Applied},
+			{"FILLED", 100, 2, Invalid},
+		}, OrderCancelled},
+		{"unknown status", []orderStep{
+			{"OPEN", 0, 1, Applied},
+			{"PARKED", 0, 2, Invalid},
+		}, OrderOpen},
+	}
+	base := time.Date(2024, 10, 18, 10, 0, 0, 0, connector.IST)
+	for _, test := range tests {
+		tracker := NewOrderTracker(OrderConfig{})
+		for n, step := range test.steps {
+			_, outcome := tracker.Apply(connector.OrderUpdate{
+				BrokerOrderId:   "B1",
+				ExchangeOrderId: "E1",
+				OrderStatus:     step.status,
+				OrderQuantity:   100,
+				FilledQuantity:  step.filled,
+				PendingQuantity: 100 - step.filled,
+				ExchangeTime:    base.Add(time.Duration(step.at) * time.Second),
+			})
+			if outcome != step.outcome {
+				t.Errorf("%s: step %d (%s) is %v, want %v", test.name, n, step.status, outcome, step.outcome)
+			}
+		}
+		if order, _ := tracker.Order("B1"); order.State != test.state {
+			t.Errorf("%s: state %v, want %v", test.name, order.State, test.state)
+		}
+	}
+}
+
+func TestOrderFirstSeenByExchangeId(t *testing.T) {
+	tracker := NewOrderTracker(OrderConfig{})
+	tracker.Apply(connector.OrderUpdate{ExchangeOrderId: "E1", OrderStatus: "OPEN", OrderQuantity: 10})
+	tracker.Apply(connector.OrderUpdate{BrokerOrderId: "B1", ExchangeOrderId: "E1", OrderStatus: "FILLED", OrderQuantity: 10, FilledQuantity: 10})
+
+	for _, id := range []string{"B1", "E1"} {
+		if order, ok := tracker.Order(id); !ok || order.BrokerOrderId != "B1" || order.State != OrderFilled {
+			t.Errorf("Order(%q) = %+v, %v", id, order, ok)
+		}
+	}
+	if orders := tracker.Orders(); len(orders) != 1 {
+		t.Errorf("tracking %d orders, want 1", len(orders))
+	}
+}
+
+func TestOrderWait(t *testing.T) {
+	tracker := NewOrderTracker(OrderConfig{})
+	tracker.Apply(connector.OrderUpdate{BrokerOrderId: "B1", OrderStatus: "OPEN", OrderQuantity: 10})
+
+	done := make(chan Order)
+	go func() {
+		order, err := tracker.Wait(context.Background(), "B1")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- order
+	}()
+	time.Sleep(10 * time.Millisecond)
+	tracker.Apply(connector.OrderUpdate{BrokerOrderId: "B1", OrderStatus: "CANCELLED", OrderQuantity: 10})
+	select {
+	case order := <-done:
+		if order.State != OrderCancelled {
+			t.Errorf("Wait returned %v, want cancelled", order.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tracker.Wait(ctx, "B2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait on an unknown order returned %v, want the context error", err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package trading keeps the client side view of the account from the order and trade
+// update feeds: the lifecycle and fills of orders, and positions and their P&L.
+package trading
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// Position is the net position of one instrument and product.
+type Position struct {
+	// Topic is the market feed topic of the instrument, e.g. "nseeq/2885".
+	Topic         string
+	Product       string
+	TradingSymbol string
+	// NetQuantity is positive when long and negative when short.
+	NetQuantity int64
+	// AveragePrice is the weighted average price of the open quantity.
+	AveragePrice float64
+	BuyQuantity  int64
+	SellQuantity int64
+	BuyValue     float64
+	SellValue    float64
+	// RealizedPnL is the P&L of the closed quantity.
+	RealizedPnL float64
+	// LastPrice is the last traded price of the instrument from the MarketWatch feed, or
+	// the last fill price before a tick was seen.
+	LastPrice float64
+	// UnrealizedPnL marks the open quantity to LastPrice.
+	UnrealizedPnL float64
+	// Multiplier is the value of one unit of quantity per unit of price.
+	Multiplier float64
+	// Trades is the number of fills applied.
+	Trades  int
+	Updated time.Time
+}
+
+// PnL returns the realized and unrealized P&L.
+func (p Position) PnL() float64 {
+	return p.RealizedPnL + p.UnrealizedPnL
+}
+
+// PositionChange is an event of a PositionBook.
+type PositionChange struct {
+	Position Position
+	// Fill is the trade applied, or nil when the position was marked to a new price.
+	Fill *connector.TradeUpdate
+}
+
+// PositionConfig configures a PositionBook.
+type PositionConfig struct {
+	// Multipliers holds the value of one unit of quantity per unit of price by topic,
+	// e.g. the lot size of commodities quoted per unit but traded in lots. Defaults to 1.
+	Multipliers map[string]float64
+	// OnChange is called after each fill and, for open positions, after each change of
+	// the last traded price.
+	OnChange func(PositionChange)
+}
+
+// PositionBook keeps the net positions of the account from the Trade Updates feed and
+// marks them to market with the MarketWatch feed. Average prices use the weighted
+// average cost of the open quantity; fills reducing a position realize P&L against it.
+// Repeated trade updates with the same exchange trade id are applied once.
+//
+//	book := trading.NewPositionBook(trading.PositionConfig{
+//		OnChange: func(change trading.PositionChange) {
+//			fmt.Println(change.Position.Topic, change.Position.NetQuantity, change.Position.PnL())
+//		},
+//	})
+//	conn.TradeUpdatesHandler = book.HandleTrade
+//	conn.MWHandler = book.HandleMW
+type PositionBook struct {
+	config PositionConfig
+
+	mu        sync.Mutex
+	positions map[positionKey]*Position
+	// byTopic lists the positions of each instrument, for marking.
+	byTopic map[string][]*Position
+	prices  map[string]float64
+	seen    map[string]bool
+}
+
+type positionKey struct {
+	topic   string
+	product string
+}
+
+// NewPositionBook returns an empty position book.
+func NewPositionBook(config PositionConfig) *PositionBook {
+	return &PositionBook{
+		config:    config,
+		positions: map[positionKey]*Position{},
+		byTopic:   map[string][]*Position{},
+		prices:    map[string]float64{},
+		seen:      map[string]bool{},
+	}
+}
+
+// HandleTrade decodes a Trade Updates payload and applies it. It has the signature of
+// the Connect handler fields, so that it can be set as TradeUpdatesHandler.
+func (b *PositionBook) HandleTrade(payload []byte, topic string) {
+	trade, err := connector.DecodeTradeUpdate(payload)
+	if err != nil {
+		return
+	}
+	b.Apply(trade)
+}
+
+// HandleMW decodes a MarketWatch payload and marks the positions of its topic.
+func (b *PositionBook) HandleMW(payload []byte, topic string) {
+	tick, err := connector.DecodeMW(payload)
+	if err != nil || tick.Ltp <= 0 {
+		return
+	}
+	b.Mark(topic, tick.Price(tick.Ltp))
+}
+
+// Apply applies a fill and returns the resulting position. It is false for fills
+// without quantity and for repeated trade ids.
+func (b *PositionBook) Apply(trade connector.TradeUpdate) (Position, bool) {
+	quantity := trade.SignedQuantity()
+	if quantity == 0 {
+		return Position{}, false
+	}
+	topic := trade.Topic()
+
+	b.mu.Lock()
+	if trade.ExchangeTradeId != "" {
+		id := topic + "/" + trade.ExchangeTradeId
+		if b.seen[id] {
+			b.mu.Unlock()
+			return Position{}, false
+		}
+		b.seen[id] = true
+	}
+
+	key := positionKey{topic: topic, product: strings.ToUpper(trade.Product)}
+	position := b.positions[key]
+	if position == nil {
+		position = &Position{Topic: topic, Product: key.product, Multiplier: b.Multiplier(topic)}
+		b.positions[key] = position
+		b.byTopic[topic] = append(b.byTopic[topic], position)
+	}
+	if trade.TradingSymbol != "" {
+		position.TradingSymbol = trade.TradingSymbol
+	}
+	position.fill(quantity, trade.TradedPrice)
+	if price, ok := b.prices[topic]; ok {
+		position.LastPrice = price
+	} else {
+		position.LastPrice = trade.TradedPrice
+	}
+	position.mark()
+	position.Updated = trade.ExchangeTime
+	if position.Updated.IsZero() {
+		position.Updated = time.Now()
+	}
+	snapshot := *position
+	b.mu.Unlock()
+
+	if b.config.OnChange != nil {
+		b.config.OnChange(PositionChange{Position: snapshot, Fill: &trade})
+	}
+	return snapshot, true
+}
+
+// Mark sets the last traded price of the topic and revalues its positions.
+func (b *PositionBook) Mark(topic string, price float64) {
+	b.mu.Lock()
+	if b.prices[topic] == price {
+		b.mu.Unlock()
+		return
+	}
+	b.prices[topic] = price
+	var changes []PositionChange
+	for _, position := range b.byTopic[topic] {
+		position.LastPrice = price
+		if position.NetQuantity == 0 {
+			continue
+		}
+		position.mark()
+		changes = append(changes, PositionChange{Position: *position})
+	}
+	b.mu.Unlock()
+
+	if b.config.OnChange != nil {
+		for _, change := range changes {
+			b.config.OnChange(change)
+		}
+	}
+}
+
+// fill applies a signed quantity at price.
+func (p *Position) fill(quantity int64, price float64) {
+	p.Trades++
+	if quantity > 0 {
+		p.BuyQuantity += quantity
+		p.BuyValue += float64(quantity) * price
+	} else {
+		p.SellQuantity -= quantity
+		p.SellValue -= float64(quantity) * price
+	}
+
+	net := p.NetQuantity + quantity
+	switch {
+	case p.NetQuantity == 0 || (p.NetQuantity > 0) == (quantity > 0):
+		// Opening or adding to the position.
+		p.AveragePrice = (p.AveragePrice*float64(p.NetQuantity) + price*float64(quantity)) / float64(net)
+	case (net > 0) == (p.NetQuantity > 0) && net != 0:
+		// Reducing the position.
+		p.RealizedPnL += float64(-quantity) * (price - p.AveragePrice) * p.Multiplier
+	default:
+		// Closing the position, and opening the rest on the other side.
+		p.RealizedPnL += float64(p.NetQuantity) * (price - p.AveragePrice) * p.Multiplier
+		p.AveragePrice = 0
+		if net != 0 {
+			p.AveragePrice = price
+		}
+	}
+	p.NetQuantity = net
+}
+
+// mark revalues the open quantity at LastPrice.
+func (p *Position) mark() {
+	p.UnrealizedPnL = float64(p.NetQuantity) * (p.LastPrice - p.AveragePrice) * p.Multiplier
+}
+
+// Multiplier returns the configured value of one unit of quantity per unit of price of
+// the topic, or 1.
+func (b *PositionBook) Multiplier(topic string) float64 {
+	if multiplier, ok := b.config.Multipliers[topic]; ok {
+		return multiplier
+	}
+	return 1
+}
+
+// Position returns the position of the topic, e.g. "nseeq/2885", and product.
+func (b *PositionBook) Position(topic string, product string) (Position, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	position, ok := b.positions[positionKey{topic: topic, product: strings.ToUpper(product)}]
+	if !ok {
+		return Position{}, false
+	}
+	return *position, true
+}
+
+// Positions returns every position traded, including closed ones, by topic and product.
+func (b *PositionBook) Positions() []Position {
+	b.mu.Lock()
+	positions := make([]Position, 0, len(b.positions))
+	for _, position := range b.positions {
+		positions = append(positions, *position)
+	}
+	b.mu.Unlock()
+
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Topic != positions[j].Topic {
+			return positions[i].Topic < positions[j].Topic
+		}
+		return positions[i].Product < positions[j].Product
+	})
+	return positions
+}
+
+// PnL returns the realized and unrealized P&L of all positions.
+func (b *PositionBook) PnL() (realized float64, unrealized float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, position := range b.positions {
+		realized += position.RealizedPnL
+		unrealized += position.UnrealizedPnL
+	}
+	return realized, unrealized
+}
+
+// Exposure returns the net quantity of the topic over all products, and its value at
+// the last traded price.
+func (b *PositionBook) Exposure(topic string) (quantity int64, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exposure(topic)
+}
+
+// GrossExposure returns the sum of the absolute values of the net positions of every
+// instrument at their last traded price.
+func (b *PositionBook) GrossExposure() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var gross float64
+	for topic := range b.byTopic {
+		_, value := b.exposure(topic)
+		gross += math.Abs(value)
+	}
+	return gross
+}
+
+func (b *PositionBook) exposure(topic string) (quantity int64, value float64) {
+	for _, position := range b.byTopic[topic] {
+		quantity += position.NetQuantity
+		value += float64(position.NetQuantity) * position.LastPrice * position.Multiplier
+	}
+	return quantity, value
+}
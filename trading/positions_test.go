@@ -0,0 +1,128 @@
+package trading
+
+import (
+	"math"
+	"testing"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func fill(id string, side string, quantity int64, price float64) connector.TradeUpdate {
+	return connector.TradeUpdate{
+		Exchange:        "NSEEQ",
+		InstrumentId:    2885,
+		ExchangeTradeId: id,
+		TransactionType: side,
+		Product:         "INTRADAY",
+		TradedQuantity:  quantity,
+		TradedPrice:     price,
+	}
+}
+
+func TestPositionFills(t *testing.T) {
+	book := NewPositionBook(PositionConfig{})
+	steps := []struct {
+		name     string
+		fill     connector.TradeUpdate
+		applied  bool
+		net      int64
+		average  float64
+		realized float64
+	}{
+		{"open long", fill("1", connector.TransactionBuy, 100, 10), true, 100, 10, 0},
+		{"add", fill("2", connector.TransactionBuy, 100, 12), true, 200, 11, 0},
+		{"reduce", fill("3", connector.TransactionSell, 50, 15), true, 150, 11, 200},
+		{"repeated trade id", fill("3", connector.TransactionSell, 50, 15), false, 150, 11, 200},
+		{"flip short", fill("4", connector.TransactionSell, 250, 9), true, -100, 9, -100},
+		{"add short", fill("5", connector.TransactionSell, 100, 7), true, -200, 8, -100},
+		{"close", fill("6", connector.TransactionBuy, 200, 8.5), true, 0, 0, -200},
+		{"no quantity", fill("7", connector.TransactionBuy, 0, 8), false, 0, 0, -200},
+	}
+	for _, step := range steps {
+		_, applied := book.Apply(step.fill)
+		position, _ := book.Position("nseeq/2885", "intraday")
+		if applied != step.applied || position.NetQuantity != step.net ||
+			math.Abs(position.AveragePrice-step.average) > 1e-9 || math.Abs(position.RealizedPnL-step.realized) > 1e-9 {
+			t.Errorf("%s: applied %v, net %d at %v, realized %v; want %v, %d at %v, %v", step.name,
+				applied, position.NetQuantity, position.AveragePrice, position.RealizedPnL,
+				step.applied, step.net, step.average, step.realized)
+		}
+	}
+}
+
+func TestPositionMark(t *testing.T) {
+	var changes []PositionChange
+	book := NewPositionBook(PositionConfig{
+		Multipliers: map[string]float64{"mcxcomm/1": 100},
+		OnChange:    func(change PositionChange) { changes = append(changes, change) },
+	})
+	book.HandleTrade([]byte(`{"exchange":"MCXCOMM","instrumentId":1,"exchangeTradeId":"1","transactionType":"BUY","product":"NRML","tradedQuantity":2,"tradedPrice":600}`), "")
+	book.HandleTrade([]byte(`{"exchange":`), "")
+	book.Apply(fill("2", connector.TransactionSell, 10, 1500))
+	book.Mark("mcxcomm/1", 610)
+	book.Mark("mcxcomm/1", 610)
+	payload, err := connector.EncodeFeed(&connector.MWBOCombined{Ltp: 149000, PriceDivisor: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.HandleMW(payload, "nseeq/2885")
+
+	tests := []struct {
+		topic, product string
+		unrealized     float64
+	}{
+		{"mcxcomm/1", "nrml", 2000},
+		{"nseeq/2885", "intraday", 100},
+	}
+	for _, test := range tests {
+		position, ok := book.Position(test.topic, test.product)
+		if !ok || math.Abs(position.UnrealizedPnL-test.unrealized) > 1e-9 {
+			t.Errorf("%s: position %+v, %v; want %v unrealized", test.topic, position, ok, test.unrealized)
+		}
+	}
+	if realized, unrealized := book.PnL(); realized != 0 || math.Abs(unrealized-2100) > 1e-9 {
+		t.Errorf("P&L %v realized and %v unrealized, want 0 and 2100", realized, unrealized)
+	}
+	if positions := book.Positions(); len(positions) != 2 || positions[0].Topic != "mcxcomm/1" {
+		t.Errorf("Positions = %+v", positions)
+	}
+	// Two fills and a change of price of each instrument.
+	if len(changes) != 4 || changes[0].Fill == nil || changes[2].Fill != nil {
+		t.Errorf("OnChange called with %+v", changes)
+	}
+}
+
+func TestPositionExposure(t *testing.T) {
+	book := NewPositionBook(PositionConfig{Multipliers: map[string]float64{"mcxcomm/1": 100}})
+	book.Apply(connector.TradeUpdate{Exchange: "MCXCOMM", InstrumentId: 1, ExchangeTradeId: "1", TransactionType: connector.TransactionBuy, Product: "NRML", TradedQuantity: 2, TradedPrice: 600})
+	book.Apply(fill("2", connector.TransactionSell, 10, 1500))
+	book.Apply(connector.TradeUpdate{Exchange: "NSEEQ", InstrumentId: 2885, ExchangeTradeId: "3", TransactionType: connector.TransactionBuy, Product: "DELIVERY", TradedQuantity: 4, TradedPrice: 1500})
+	book.Mark("mcxcomm/1", 610)
+	book.Mark("nseeq/2885", 1490)
+
+	tests := []struct {
+		topic    string
+		quantity int64
+		value    float64
+	}{
+		{"mcxcomm/1", 2, 122000},
+		// Netted over the intraday and delivery products.
+		{"nseeq/2885", -6, -8940},
+		{"nseeq/1594", 0, 0},
+	}
+	for _, test := range tests {
+		quantity, value := book.Exposure(test.topic)
+		if quantity != test.quantity || math.Abs(value-test.value) > 1e-9 {
+			t.Errorf("%s: exposure %d worth %v, want %d worth %v", test.topic, quantity, value, test.quantity, test.value)
+		}
+	}
+	if got := book.GrossExposure(); math.Abs(got-130940) > 1e-9 {
+		t.Errorf("gross exposure %v, want 130940", got)
+	}
+	if got := book.Multiplier("mcxcomm/1"); got != 100 {
+		t.Errorf("multiplier %v, want 100", got)
+	}
+	if got := book.Multiplier("nseeq/2885"); got != 1 {
+		t.Errorf("default multiplier %v, want 1", got)
+	}
+}
@@ -0,0 +1,342 @@
+package trading
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+// OrderFill is the fill of an order as seen on the order and trade update feeds.
+type OrderFill struct {
+	BrokerOrderId   string
+	ExchangeOrderId string
+	// OrderFilled is the highest cumulative FilledQuantity of the order updates, and
+	// OrderAveragePrice its AverageTradedPrice.
+	OrderFilled       int64
+	OrderAveragePrice float64
+	// TradeFilled is the sum of the quantities of the trade updates, and
+	// TradeAveragePrice their average price.
+	TradeFilled       int64
+	TradeAveragePrice float64
+	Trades            int
+	// FilledQuantity is the quantity confirmed by both feeds, i.e. the lower of
+	// OrderFilled and TradeFilled.
+	FilledQuantity int64
+	// Consistent is true when both feeds agree.
+	Consistent bool
+	// Since is the time the feeds started to disagree, or zero when Consistent.
+	Since time.Time
+}
+
+// Mismatch reports an order whose feeds disagreed for longer than the settle time.
+type Mismatch struct {
+	Fill OrderFill
+	// Difference is OrderFilled - TradeFilled.
+	Difference int64
+	// Duration is how long the feeds have disagreed.
+	Duration time.Duration
+}
+
+// ReconcileConfig configures a Reconciler.
+type ReconcileConfig struct {
+	// SettleTime is how long the feeds of an order may disagree before a Mismatch is
+	// raised. Defaults to five seconds.
+	SettleTime time.Duration
+	// Now returns the time an update is applied, from which a disagreement is measured,
+	// and the time Run checks at. Defaults to time.Now.
+	Now func() time.Time
+	// OnMismatch is called once when the feeds of an order disagreed for SettleTime.
+	OnMismatch func(Mismatch)
+	// OnResolved is called when the feeds of an order agree again after a Mismatch.
+	OnResolved func(OrderFill)
+}
+
+// Reconciler cross-checks the cumulative filled quantity of the order updates of each
+// order against the sum of its trade updates. The two feeds are published separately
+// and often disagree for a moment; a disagreement is only reported once it lasted for
+// the settle time. Mismatches are raised by Check, which Run calls periodically. An
+// order first seen by its broker id on one feed and its exchange id on the other is
+// joined when an update carries both.
+//
+//	reconciler := trading.NewReconciler(trading.ReconcileConfig{
+//		SettleTime: 10 * time.Second,
+//		OnMismatch: func(mismatch trading.Mismatch) {
+//			fmt.Println(mismatch.Fill.BrokerOrderId, mismatch.Fill.OrderFilled, mismatch.Fill.TradeFilled)
+//		},
+//	})
+//	conn.OrderUpdatesHandler = reconciler.HandleOrder
+//	conn.TradeUpdatesHandler = reconciler.HandleTrade
+//	go reconciler.Run(ctx)
+type Reconciler struct {
+	config ReconcileConfig
+
+	mu           sync.Mutex
+	fills        map[string]*reconciledFill
+	byExchangeId map[string]*reconciledFill
+	trades       map[string]bool
+}
+
+type reconciledFill struct {
+	OrderFill
+	tradeValue float64
+	raised     bool
+}
+
+// NewReconciler returns a Reconciler.
+func NewReconciler(config ReconcileConfig) *Reconciler {
+	if config.SettleTime <= 0 {
+		config.SettleTime = 5 * time.Second
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &Reconciler{
+		config:       config,
+		fills:        map[string]*reconciledFill{},
+		byExchangeId: map[string]*reconciledFill{},
+		trades:       map[string]bool{},
+	}
+}
+
+// HandleOrder decodes an Order Updates payload and applies it. It has the signature of
+// the Connect handler fields, so that it can be set as OrderUpdatesHandler.
+func (r *Reconciler) HandleOrder(payload []byte, topic string) {
+	update, err := connector.DecodeOrderUpdate(payload)
+	if err != nil {
+		return
+	}
+	r.ApplyOrder(update)
+}
+
+// HandleTrade decodes a Trade Updates payload and applies it.
+func (r *Reconciler) HandleTrade(payload []byte, topic string) {
+	trade, err := connector.DecodeTradeUpdate(payload)
+	if err != nil {
+		return
+	}
+	r.ApplyTrade(trade)
+}
+
+// ApplyOrder applies the filled quantity of an order update and returns the fill.
+func (r *Reconciler) ApplyOrder(update connector.OrderUpdate) OrderFill {
+	r.mu.Lock()
+	fill := r.fill(update.BrokerOrderId, update.ExchangeOrderId)
+	if fill == nil {
+		r.mu.Unlock()
+		return OrderFill{}
+	}
+	// Order updates may arrive out of order; the cumulative quantity only grows.
+	if update.FilledQuantity >= fill.OrderFilled {
+		fill.OrderFilled = update.FilledQuantity
+		fill.OrderAveragePrice = update.AverageTradedPrice
+	}
+	snapshot, resolved := fill.settle(r.config.Now())
+	r.mu.Unlock()
+
+	r.notifyResolved(snapshot, resolved)
+	return snapshot
+}
+
+// ApplyTrade adds a trade update to its order and returns the fill. Repeated trade ids
+// are counted once.
+func (r *Reconciler) ApplyTrade(trade connector.TradeUpdate) OrderFill {
+	r.mu.Lock()
+	if trade.ExchangeTradeId != "" {
+		id := trade.Topic() + "/" + trade.ExchangeTradeId
+		if r.trades[id] {
+			fill := r.fill(trade.BrokerOrderId, trade.ExchangeOrderId)
+			r.mu.Unlock()
+			if fill == nil {
+				return OrderFill{}
+			}
+			return fill.OrderFill
+		}
+		r.trades[id] = true
+	}
+	fill := r.fill(trade.BrokerOrderId, trade.ExchangeOrderId)
+	if fill == nil {
+		r.mu.Unlock()
+		return OrderFill{}
+	}
+	fill.Trades++
+	fill.TradeFilled += trade.TradedQuantity
+	fill.tradeValue += float64(trade.TradedQuantity) * trade.TradedPrice
+	if fill.TradeFilled != 0 {
+		fill.TradeAveragePrice = fill.tradeValue / float64(fill.TradeFilled)
+	}
+	snapshot, resolved := fill.settle(r.config.Now())
+	r.mu.Unlock()
+
+	r.notifyResolved(snapshot, resolved)
+	return snapshot
+}
+
+// settle updates the consistency of the fill and returns it, and whether a raised
+// mismatch was resolved.
+func (f *reconciledFill) settle(now time.Time) (OrderFill, bool) {
+	f.FilledQuantity = min(f.OrderFilled, f.TradeFilled)
+	consistent := f.OrderFilled == f.TradeFilled
+	resolved := false
+	switch {
+	case consistent:
+		resolved = f.raised
+		f.raised = false
+		f.Since = time.Time{}
+	case f.Consistent:
+		f.Since = now
+	}
+	f.Consistent = consistent
+	return f.OrderFill, resolved
+}
+
+func (r *Reconciler) notifyResolved(fill OrderFill, resolved bool) {
+	if resolved && r.config.OnResolved != nil {
+		r.config.OnResolved(fill)
+	}
+}
+
+// fill returns the fill of the order, or nil without an order id.
+func (r *Reconciler) fill(brokerOrderId string, exchangeOrderId string) *reconciledFill {
+	var fill, other *reconciledFill
+	if brokerOrderId != "" {
+		fill = r.fills[brokerOrderId]
+	}
+	if exchangeOrderId != "" {
+		other = r.byExchangeId[exchangeOrderId]
+	}
+	switch {
+	case fill == nil:
+		fill = other
+	case other != nil && other != fill && other.BrokerOrderId == "":
+		// The order was seen by its broker id on one feed and by its exchange id on the
+		// other; the update carrying both joins them.
+		fill.merge(other)
+		delete(r.byExchangeId, exchangeOrderId)
+	}
+	if fill == nil {
+		if brokerOrderId == "" && exchangeOrderId == "" {
+			return nil
+		}
+		fill = &reconciledFill{OrderFill: OrderFill{Consistent: true}}
+	}
+	if brokerOrderId != "" && fill.BrokerOrderId == "" {
+		fill.BrokerOrderId = brokerOrderId
+		r.fills[brokerOrderId] = fill
+	}
+	if exchangeOrderId != "" && fill.ExchangeOrderId == "" {
+		fill.ExchangeOrderId = exchangeOrderId
+		r.byExchangeId[exchangeOrderId] = fill
+	}
+	return fill
+}
+
+// merge adds the fill of the same order seen by its exchange id only.
+func (f *reconciledFill) merge(other *reconciledFill) {
+	if other.OrderFilled > f.OrderFilled {
+		f.OrderFilled = other.OrderFilled
+		f.OrderAveragePrice = other.OrderAveragePrice
+	}
+	f.Trades += other.Trades
+	f.TradeFilled += other.TradeFilled
+	f.tradeValue += other.tradeValue
+	if f.TradeFilled != 0 {
+		f.TradeAveragePrice = f.tradeValue / float64(f.TradeFilled)
+	}
+	if f.Consistent || (!other.Consistent && other.Since.Before(f.Since)) {
+		f.Since = other.Since
+	}
+	f.Consistent = f.Consistent && other.Consistent
+	f.raised = f.raised || other.raised
+}
+
+// Check raises a Mismatch for each order whose feeds disagreed for longer than the
+// settle time at now, once per disagreement, and returns them.
+func (r *Reconciler) Check(now time.Time) []Mismatch {
+	r.mu.Lock()
+	var mismatches []Mismatch
+	for _, fill := range r.all() {
+		if fill.Consistent || fill.raised || now.Sub(fill.Since) < r.config.SettleTime {
+			continue
+		}
+		fill.raised = true
+		mismatches = append(mismatches, Mismatch{
+			Fill:       fill.OrderFill,
+			Difference: fill.OrderFilled - fill.TradeFilled,
+			Duration:   now.Sub(fill.Since),
+		})
+	}
+	r.mu.Unlock()
+
+	if r.config.OnMismatch != nil {
+		for _, mismatch := range mismatches {
+			r.config.OnMismatch(mismatch)
+		}
+	}
+	return mismatches
+}
+
+// Run calls Check with the configured Now four times per settle time until the context
+// is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.SettleTime / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check(r.config.Now())
+		}
+	}
+}
+
+// Fill returns the fill of the order with the broker or exchange order id.
+func (r *Reconciler) Fill(id string) (OrderFill, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fill := r.fills[id]
+	if fill == nil {
+		fill = r.byExchangeId[id]
+	}
+	if fill == nil {
+		return OrderFill{}, false
+	}
+	return fill.OrderFill, true
+}
+
+// Fills returns the fill of every order seen, by broker order id.
+func (r *Reconciler) Fills() []OrderFill {
+	r.mu.Lock()
+	all := r.all()
+	fills := make([]OrderFill, 0, len(all))
+	for _, fill := range all {
+		fills = append(fills, fill.OrderFill)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(fills, func(i, j int) bool {
+		if fills[i].BrokerOrderId != fills[j].BrokerOrderId {
+			return fills[i].BrokerOrderId < fills[j].BrokerOrderId
+		}
+		return fills[i].ExchangeOrderId < fills[j].ExchangeOrderId
+	})
+	return fills
+}
+
+// all returns each fill once, including those only known by exchange order id.
+func (r *Reconciler) all() []*reconciledFill {
+	seen := map[*reconciledFill]bool{}
+	var all []*reconciledFill
+	for _, index := range []map[string]*reconciledFill{r.fills, r.byExchangeId} {
+		for _, fill := range index {
+			if !seen[fill] {
+				seen[fill] = true
+				all = append(all, fill)
+			}
+		}
+	}
+	return all
+}
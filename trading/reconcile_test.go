@@ -0,0 +1,143 @@
+package trading
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IIFLSecurities/bridgeGo/connector"
+)
+
+func TestReconcilerSettleTime(t *testing.T) {
+	var mismatches []Mismatch
+	var resolved []OrderFill
+	start := time.Date(2024, 10, 18, 10, 0, 0, 0, connector.IST)
+	now := start
+	reconciler := NewReconciler(ReconcileConfig{
+		SettleTime: 5 * time.Second,
+		Now:        func() time.Time { return now },
+		OnMismatch: func(mismatch Mismatch) { mismatches = append(mismatches, mismatch) },
+		OnResolved: func(fill OrderFill) { resolved = append(resolved, fill) },
+	})
+	trade := func(id string, quantity int64, price float64) connector.TradeUpdate {
+		return connector.TradeUpdate{Exchange: "NSEEQ", InstrumentId: 2885, BrokerOrderId: "B1", ExchangeTradeId: id, TradedQuantity: quantity, TradedPrice: price}
+	}
+
+	reconciler.ApplyOrder(connector.OrderUpdate{BrokerOrderId: "B1", FilledQuantity: 100, AverageTradedPrice: 10.4})
+	now = start.Add(2 * time.Second)
+	fill := reconciler.ApplyTrade(trade("T1", 60, 10))
+	reconciler.ApplyTrade(trade("T1", 60, 10))
+	if fill.Consistent || fill.FilledQuantity != 60 || fill.TradeFilled != 60 || !fill.Since.Equal(start) {
+		t.Fatalf("fill %+v, want 60 of 100 confirmed, disagreeing since the order update", fill)
+	}
+
+	steps := []struct {
+		at         time.Duration
+		mismatches int
+	}{
+		{4 * time.Second, 0},
+		{6 * time.Second, 1},
+		{10 * time.Second, 1},
+	}
+	for _, step := range steps {
+		reconciler.Check(start.Add(step.at))
+		if len(mismatches) != step.mismatches {
+			t.Fatalf("%d mismatches after %v, want %d", len(mismatches), step.at, step.mismatches)
+		}
+	}
+	if mismatches[0].Difference != 40 || mismatches[0].Duration != 6*time.Second {
+		t.Errorf("mismatch %+v, want 40 apart for 6s", mismatches[0])
+	}
+
+	fill = reconciler.ApplyTrade(trade("T2", 40, 11))
+	if !fill.Consistent || fill.Trades != 2 || fill.TradeAveragePrice != 10.4 || !fill.Since.IsZero() {
+		t.Errorf("fill %+v, want consistent at 10.4 over 2 trades", fill)
+	}
+	if len(resolved) != 1 {
+		t.Errorf("%d resolutions, want 1", len(resolved))
+	}
+	if got := reconciler.Check(start.Add(time.Minute)); len(got) != 0 {
+		t.Errorf("mismatches %v after the feeds agreed", got)
+	}
+}
+
+func TestReconcilerJoinsOrderIds(t *testing.T) {
+	tests := []struct {
+		name string
+		// updates are order or trade updates, in arrival order.
+		updates []interface{}
+	}{
+		{
+			name: "trade by exchange id first",
+			updates: []interface{}{
+				connector.TradeUpdate{ExchangeOrderId: "E1", ExchangeTradeId: "T1", TradedQuantity: 10, TradedPrice: 5},
+				connector.OrderUpdate{BrokerOrderId: "B1", ExchangeOrderId: "E1", FilledQuantity: 10, AverageTradedPrice: 5},
+			},
+		},
+		{
+			name: "order update joins",
+			updates: []interface{}{
+				connector.OrderUpdate{BrokerOrderId: "B1", FilledQuantity: 10, AverageTradedPrice: 5},
+				connector.TradeUpdate{ExchangeOrderId: "E1", ExchangeTradeId: "T1", TradedQuantity: 10, TradedPrice: 5},
+				connector.OrderUpdate{BrokerOrderId: "B1", ExchangeOrderId: "E1", FilledQuantity: 10, AverageTradedPrice: 5},
+			},
+		},
+		{
+			name: "trade update joins",
+			updates: []interface{}{
+				connector.OrderUpdate{BrokerOrderId: "B1", FilledQuantity: 10, AverageTradedPrice: 5},
+				connector.TradeUpdate{ExchangeOrderId: "E1", ExchangeTradeId: "T1", TradedQuantity: 4, TradedPrice: 5},
+				connector.TradeUpdate{BrokerOrderId: "B1", ExchangeOrderId: "E1", ExchangeTradeId: "T2", TradedQuantity: 6, TradedPrice: 5},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reconciler := NewReconciler(ReconcileConfig{})
+			for _, update := range test.updates {
+				switch update := update.(type) {
+				case connector.OrderUpdate:
+					reconciler.ApplyOrder(update)
+				case connector.TradeUpdate:
+					reconciler.ApplyTrade(update)
+				}
+			}
+
+			for _, id := range []string{"B1", "E1"} {
+				fill, ok := reconciler.Fill(id)
+				if !ok || !fill.Consistent || fill.FilledQuantity != 10 || fill.TradeAveragePrice != 5 ||
+					fill.BrokerOrderId != "B1" || fill.ExchangeOrderId != "E1" {
+					t.Errorf("Fill(%s) = %+v, %v", id, fill, ok)
+				}
+			}
+			if fills := reconciler.Fills(); len(fills) != 1 {
+				t.Errorf("%d fills, want 1", len(fills))
+			}
+		})
+	}
+}
+
+func TestReconcilerJoinResolves(t *testing.T) {
+	var resolved []OrderFill
+	start := time.Date(2024, 10, 18, 10, 0, 0, 0, connector.IST)
+	now := start
+	reconciler := NewReconciler(ReconcileConfig{
+		Now:        func() time.Time { return now },
+		OnResolved: func(fill OrderFill) { resolved = append(resolved, fill) },
+	})
+	reconciler.ApplyOrder(connector.OrderUpdate{BrokerOrderId: "B1", FilledQuantity: 10})
+	now = start.Add(time.Second)
+	reconciler.ApplyTrade(connector.TradeUpdate{ExchangeOrderId: "E1", ExchangeTradeId: "T1", TradedQuantity: 10, TradedPrice: 5})
+
+	// Each half disagrees with itself until the orders are joined.
+	if mismatches := reconciler.Check(start.Add(6 * time.Second)); len(mismatches) != 2 {
+		t.Fatalf("%d mismatches before the join, want 2", len(mismatches))
+	}
+	now = start.Add(7 * time.Second)
+	fill := reconciler.ApplyOrder(connector.OrderUpdate{BrokerOrderId: "B1", ExchangeOrderId: "E1", FilledQuantity: 10})
+	if !fill.Consistent || fill.Trades != 1 || len(resolved) != 1 {
+		t.Errorf("fill %+v with %d resolutions, want consistent and resolved once", fill, len(resolved))
+	}
+	if mismatches := reconciler.Check(start.Add(time.Minute)); len(mismatches) != 0 {
+		t.Errorf("mismatches %+v after the join", mismatches)
+	}
+}